@@ -1,6 +1,10 @@
 package main
 
-import "github.com/gdamore/tcell/v2"
+import (
+	"log"
+
+	"github.com/gdamore/tcell/v2"
+)
 
 type App struct {
 	body View
@@ -11,6 +15,9 @@ type App struct {
 	mouseX int
 	mouseY int
 	keymap map[tcell.Key]func(*tcell.EventKey)
+
+	pressed  bool    // the button 1 is held
+	dragging dragger // the view dragged while the button is held
 }
 
 func NewApp() (*App, error) {
@@ -69,6 +76,10 @@ func (a *App) Focus(v View) {
 }
 
 func (a *App) GetHover() View {
+	// the focused overlay, such as the goto bar, is above the body
+	if a.focus != nil && !contains(a.body, a.focus) && inView(a.focus, a.mouseX, a.mouseY) {
+		return a.focus
+	}
 	return getHover(a.body, a.mouseX, a.mouseY)
 }
 
@@ -93,9 +104,73 @@ func getHover(view View, x, y int) View {
 			}
 		}
 	}
+	if t, ok := view.(*splitTree); ok {
+		for _, g := range t.visible() {
+			hover := getHover(g, x, y)
+			if hover != nil {
+				return hover
+			}
+		}
+	}
 	return view
 }
 
+// hoverer is a view reacting to the mouse moving over it
+type hoverer interface {
+	Hover(x, y int)
+}
+
+// dragger is a view dragged by the mouse, such as the border of splits
+type dragger interface {
+	// Press reports whether the drag starts at the point pressed
+	Press(x, y int) bool
+	Drag(x, y int)
+}
+
+// eventFunc carries a function to be run in the event loop,
+// after which the views are redrawn.
+type eventFunc struct {
+	tcell.EventTime
+	f func()
+}
+
+// post is used by other goroutines to update views in the event loop
+func post(screen tcell.Screen, f func()) {
+	ev := &eventFunc{f: f}
+	ev.SetEventNow()
+	if err := screen.PostEvent(ev); err != nil {
+		log.Print(err)
+	}
+}
+
+// reports whether view is v or one of its descendants
+func contains(v, view View) bool {
+	if v == view {
+		return true
+	}
+	switch s := v.(type) {
+	case *vstack:
+		for _, child := range s.Views {
+			if contains(child, view) {
+				return true
+			}
+		}
+	case *hstack:
+		for _, child := range s.Views {
+			if contains(child, view) {
+				return true
+			}
+		}
+	case *splitTree:
+		for _, g := range s.groups() {
+			if g == view {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (a *App) Handle(key tcell.Key, f func(*tcell.EventKey)) {
 	a.keymap[key] = f
 }
@@ -123,9 +198,30 @@ func (a *App) Run() {
 			x, y := ev.Position()
 			switch ev.Buttons() {
 			case tcell.Button1:
+				if a.dragging != nil {
+					a.dragging.Drag(x, y)
+					a.body.Draw(a.screen)
+					// the focused view may be moved
+					if a.focus != nil {
+						a.Focus(a.focus)
+					}
+					break
+				}
+				a.mouseX = x
+				a.mouseY = y
 				view := a.GetHover()
+				if d, ok := view.(dragger); ok && !a.pressed && d.Press(x, y) {
+					a.pressed = true
+					a.dragging = d
+					continue
+				}
+				a.pressed = true
+				focus := a.focus
 				view.Click(x, y)
-				a.Focus(view)
+				// the click may have moved the focus, such as opening a file
+				if a.focus == focus {
+					a.Focus(view)
+				}
 			case tcell.WheelUp:
 				view := a.GetHover()
 				delta := int(float32(y) * scrollSensitivity)
@@ -139,8 +235,14 @@ func (a *App) Run() {
 					view.Draw(a.screen)
 				}
 			default:
+				// released
+				a.pressed = false
+				a.dragging = nil
 				a.mouseX = x
 				a.mouseY = y
+				if h, ok := a.GetHover().(hoverer); ok {
+					h.Hover(x, y)
+				}
 				// do not render on mouse motion
 				continue
 			}
@@ -150,6 +252,13 @@ func (a *App) Run() {
 			} else {
 				a.focus.HandleEventKey(ev, a.screen)
 			}
+		case *eventFunc:
+			ev.f()
+			a.body.Draw(a.screen)
+			// the focused view may be drawn over the body, such as the find bar
+			if a.focus != nil && !contains(a.body, a.focus) {
+				a.focus.Draw(a.screen)
+			}
 		}
 	}
 }
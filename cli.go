@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// split is how the files on the command line are laid out
+type split int
+
+const (
+	splitNone       split = iota // as tabs of a group
+	splitVertical                // a group for each file, side by side
+	splitHorizontal              // a group for each file, stacked
+)
+
+// readOnly is set by -R, the buffers opened can not be changed or saved
+var readOnly bool
+
+var errReadOnly = errors.New("read-only")
+
+// cmdLine is the parsed command line
+type cmdLine struct {
+	files    []location // the files to open in order, at the cursors
+	root     string     // the directory to be the workspace root
+	stdin    bool       // read stdin into an untitled buffer
+	readOnly bool
+	split    split
+	config   string // the config file, instead of the default one
+}
+
+const usage = `usage: jo [flags] [+line[:column]] [file[:line[:column]] | dir | -]...
+
+Open the files as tabs, at the line and column if any.
+A directory becomes the workspace root, and - reads stdin into an untitled buffer.
+
+flags:
+`
+
+// parseArgs parses the arguments after the program name, writing the usage
+// to output on -h or an error. Flags may follow the files, but not "--".
+func parseArgs(args []string, output io.Writer) (cmdLine, error) {
+	var c cmdLine
+	fs := flag.NewFlagSet("jo", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&c.readOnly, "R", false, "read-only, the buffers can not be changed or saved")
+	vertical := fs.Bool("O", false, "open the files in vertical splits, side by side")
+	horizontal := fs.Bool("o", false, "open the files in horizontal splits, stacked")
+	fs.StringVar(&c.config, "config", "", "the config file (default "+configFile()+")")
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return cmdLine{}, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			// the rest are all files
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if *vertical && *horizontal {
+		return cmdLine{}, usageError(fs, "-o and -O are exclusive")
+	}
+	if *vertical {
+		c.split = splitVertical
+	} else if *horizontal {
+		c.split = splitHorizontal
+	}
+
+	// the position of +line for the next file
+	var next *pos
+	for _, arg := range positional {
+		if arg == "-" {
+			if c.stdin {
+				return cmdLine{}, usageError(fs, "- is given more than once")
+			}
+			c.stdin = true
+			continue
+		}
+		if s, ok := strings.CutPrefix(arg, "+"); ok {
+			cursor, ok := parseLine(s)
+			if !ok {
+				return cmdLine{}, usageError(fs, "invalid position "+arg)
+			}
+			next = &cursor
+			continue
+		}
+		name, cursor := arg, pos{}
+		info, err := os.Stat(arg)
+		if err != nil {
+			// a file may be named like file:1
+			if n, p, ok := splitFileLine(arg); ok {
+				name, cursor = n, p
+				info, err = os.Stat(name)
+			}
+		}
+		if err == nil && info.IsDir() {
+			if c.root != "" {
+				return cmdLine{}, usageError(fs, "more than one directory: "+c.root+", "+name)
+			}
+			c.root = name
+			continue
+		}
+		if next != nil {
+			cursor = *next
+			next = nil
+		}
+		// a new file is created on save
+		c.files = append(c.files, location{name, cursor})
+	}
+	if next != nil {
+		return cmdLine{}, usageError(fs, "no file after +line")
+	}
+	return c, nil
+}
+
+// groups returns the files of every editor group, a group for each file
+// if the files are split, or a group for all of them.
+func (c cmdLine) groups() [][]location {
+	if len(c.files) == 0 {
+		return nil
+	}
+	if c.split == splitNone {
+		return [][]location{c.files}
+	}
+	groups := make([][]location, len(c.files))
+	for i, f := range c.files {
+		groups[i] = []location{f}
+	}
+	return groups
+}
+
+// openFiles opens the files as tabs at their cursors, showing the first one.
+// The group must be laid out, to put the cursors in the middle of the page.
+func (g *EditorGroup) openFiles(files []location) {
+	for _, f := range files {
+		if f.cursor == (pos{}) {
+			g.Open(f.filename)
+		} else {
+			g.openAt(f)
+		}
+	}
+	if len(files) > 1 {
+		g.Open(files[0].filename)
+	}
+}
+
+// usageError reports the error with the usage, as the flag package does
+func usageError(fs *flag.FlagSet, msg string) error {
+	fmt.Fprintln(fs.Output(), msg)
+	fs.Usage()
+	return errors.New(msg)
+}
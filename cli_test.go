@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestParseArgs(t *testing.T) {
+	dir := t.TempDir()
+	a, b, colon := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), filepath.Join(dir, "c:2")
+	for _, name := range []string{a, b, colon} {
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want cmdLine
+	}{
+		{nil, cmdLine{}},
+		{[]string{a, b}, cmdLine{files: []location{{a, pos{}}, {b, pos{}}}}},
+		{[]string{a + ":12", b + ":3:4"}, cmdLine{files: []location{{a, pos{11, 0}}, {b, pos{2, 3}}}}},
+		{[]string{"+7", a, b}, cmdLine{files: []location{{a, pos{6, 0}}, {b, pos{}}}}},
+		{[]string{"+7:2", "new.go"}, cmdLine{files: []location{{"new.go", pos{6, 1}}}}},
+		// the existing file named like a position
+		{[]string{colon}, cmdLine{files: []location{{colon, pos{}}}}},
+		{[]string{sub, a}, cmdLine{root: sub, files: []location{{a, pos{}}}}},
+		{[]string{"-"}, cmdLine{stdin: true}},
+		{[]string{"-R", "-O", a, "-config", "c.json", b}, cmdLine{
+			files:    []location{{a, pos{}}, {b, pos{}}},
+			readOnly: true,
+			split:    splitVertical,
+			config:   "c.json",
+		}},
+		{[]string{"-o", a}, cmdLine{files: []location{{a, pos{}}}, split: splitHorizontal}},
+		{[]string{"--", "-R"}, cmdLine{files: []location{{"-R", pos{}}}}},
+	}
+	for _, tt := range tests {
+		got, err := parseArgs(tt.args, io.Discard)
+		if err != nil {
+			t.Errorf("parseArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseArgs(%q) = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-o", "-O"},
+		{"+x", a},
+		{a, "+3"},
+		{sub, dir},
+		{"-", "-"},
+		{"-unknown"},
+	} {
+		if _, err := parseArgs(args, io.Discard); err == nil {
+			t.Errorf("parseArgs(%q) is not an error", args)
+		}
+	}
+}
+
+func TestCmdLineGroups(t *testing.T) {
+	files := []location{{"a", pos{}}, {"b", pos{1, 0}}}
+	if got := (cmdLine{files: files}).groups(); !reflect.DeepEqual(got, [][]location{files}) {
+		t.Errorf("groups of tabs = %v", got)
+	}
+	want := [][]location{files[:1], files[1:]}
+	if got := (cmdLine{files: files, split: splitHorizontal}).groups(); !reflect.DeepEqual(got, want) {
+		t.Errorf("groups of splits = %v, want %v", got, want)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	defer func(v bool) { readOnly = v }(readOnly)
+	readOnly = true
+
+	e := newEditor(screen, "", BindStr("", nil))
+	e.setText([]byte("text\n"))
+	e.SetPos(0, 0, 80, 24)
+	e.HandleEventKey(tcell.NewEventKey(tcell.KeyRune, 'x', 0), screen)
+	e.HandleEventKey(tcell.NewEventKey(tcell.KeyEnter, 0, 0), screen)
+	e.delete(pos{0, 0}, pos{0, 2})
+	if got := string(e.bytes()); got != "text\n" {
+		t.Errorf("the read-only buffer is changed to %q", got)
+	}
+}
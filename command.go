@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+)
+
+// A command is run by name from the goto bar, after the '>' prefix.
+type command struct {
+	name string
+	run  func()
+}
+
+var commands []command
+
+func registerCommand(name string, run func()) {
+	commands = append(commands, command{name: name, run: run})
+}
+
+// return names of the commands containing keyword, case-insensitively
+func matchCommands(keyword string) []string {
+	keyword = strings.ToLower(keyword)
+	var names []string
+	for _, c := range commands {
+		if strings.Contains(strings.ToLower(c.name), keyword) {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+func runCommand(name string) bool {
+	for _, c := range commands {
+		if c.name == name {
+			c.run()
+			return true
+		}
+	}
+	return false
+}
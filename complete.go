@@ -0,0 +1,501 @@
+package main
+
+import (
+	"cmp"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// completionItem is an option in the suggestion popup
+type completionItem struct {
+	label  string
+	kind   string // such as "func", "field" and "method", empty for plain words
+	detail string // signature or type
+	doc    string // doc comment
+}
+
+// text shown in the popup
+func (c completionItem) String() string {
+	if c.kind == "" {
+		return c.label
+	}
+	return c.label + "  " + c.kind + " " + c.detail
+}
+
+// signature is the declaration shown in the documentation pane
+func (c completionItem) signature() string {
+	switch c.kind {
+	case "":
+		return ""
+	case "snippet":
+		return c.detail
+	case "func", "method":
+		return "func " + c.label + c.detail
+	}
+	return c.kind + " " + c.label + " " + c.detail
+}
+
+// members are the completion items after a selector
+type members struct {
+	row, dot int // position of the '.'
+	items    []completionItem
+}
+
+// loadMembers completes the selector before the cursor with go/types,
+// such as "x." and "pkg.", in the background. It returns false if the
+// cursor is not after a selector.
+func (e *Editor) loadMembers(prefix string) bool {
+	line := e.buf[e.cursor.row]
+	dot := e.cursor.col - len([]rune(prefix)) - 1
+	if e.lang == nil || e.lang.name != "go" || e.filename == "" || dot <= 0 || line[dot] != '.' {
+		return false
+	}
+
+	if e.members != nil && e.members.row == e.cursor.row && e.members.dot == dot {
+		e.showMembers(prefix)
+		return true
+	}
+
+	filename, err := filepath.Abs(e.filename)
+	if err != nil {
+		log.Print(err)
+		return true
+	}
+	row := e.cursor.row
+	src := e.bytes()
+	if prefix == "" {
+		// complete the selector so that it parses, such as "x._"
+		var off int
+		for i := 0; i < row; i++ {
+			off += len(string(e.buf[i])) + 1
+		}
+		off += len(string(line[:dot+1]))
+		src = slices.Insert(src, off, '_')
+	}
+	e.loading++
+	loading, version := e.loading, e.version
+	go func() {
+		items, err := selectorMembers(filename, src, row, dot)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		post(e.screen, func() {
+			// outdated, dismissed, or the cursor is gone
+			if e.loading != loading || e.version != version || e.cursor.row != row || e.cursor.col <= dot {
+				return
+			}
+			line := e.buf[row]
+			e.members = &members{row: row, dot: dot, items: items}
+			e.showMembers(string(line[dot+1 : e.cursor.col]))
+		})
+	}()
+	return true
+}
+
+// showMembers shows the members starting with prefix
+func (e *Editor) showMembers(prefix string) {
+	var items []completionItem
+	for _, item := range e.members.items {
+		if strings.HasPrefix(strings.ToLower(item.label), strings.ToLower(prefix)) {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		e.suggest = nil
+		return
+	}
+	e.suggest = &suggestion{
+		x:       e.cursorX - len([]rune(prefix)),
+		y:       e.cursorY,
+		options: items,
+	}
+}
+
+// selectorMembers type-checks src as the content of the file,
+// and returns the members of the selector whose '.' is at row and col.
+func selectorMembers(filename string, src []byte, row, dot int) ([]completionItem, error) {
+	p, err := checker.check(filename, map[string][]byte{filename: src})
+	if err != nil {
+		return nil, err
+	}
+	selPos := p.pos(filename, row, dot+1)
+	var sel *ast.SelectorExpr
+	ast.Inspect(p.files[filename], func(n ast.Node) bool {
+		if s, ok := n.(*ast.SelectorExpr); ok && s.Sel.Pos() == selPos {
+			sel = s
+		}
+		return sel == nil
+	})
+	if sel == nil {
+		return nil, nil
+	}
+
+	docs := &docFinder{fset: p.fset, files: make(map[string]docFile)}
+	for name, f := range p.files {
+		docs.files[name] = docFile{p.fset, f}
+	}
+	if id, ok := sel.X.(*ast.Ident); ok {
+		switch obj := p.info.Uses[id].(type) {
+		case *types.PkgName:
+			return packageMembers(obj.Imported(), docs), nil
+		case nil:
+			// a package not imported yet, such as "strings."
+			if path := stdPackage(id.Name); path != "" {
+				pkg, err := checker.importPackage(path, filepath.Dir(filename))
+				if err != nil {
+					return nil, err
+				}
+				return packageMembers(pkg, docs), nil
+			}
+			return nil, nil
+		}
+	}
+
+	tv, ok := p.info.Types[sel.X]
+	if !ok || tv.Type == nil {
+		return nil, nil
+	}
+	return typeMembers(tv.Type, p.pkg, tv.IsType(), docs), nil
+}
+
+// return exported members of the package
+func packageMembers(pkg *types.Package, docs *docFinder) []completionItem {
+	qualifier := func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Name()
+	}
+	var items []completionItem
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		items = append(items, objectItem(obj, qualifier, docs))
+	}
+	return items
+}
+
+// return fields and methods of the type accessible from pkg, the methods of
+// pointer receiver are included since variables are addressable.
+// If isType is true, such as "T.", only methods are returned, as method expressions.
+func typeMembers(T types.Type, pkg *types.Package, isType bool, docs *docFinder) []completionItem {
+	qualifier := types.RelativeTo(pkg)
+	accessible := func(obj types.Object) bool {
+		return obj.Exported() || obj.Pkg() == pkg
+	}
+
+	var items []completionItem
+	seen := make(map[string]bool)
+	if !isType {
+		// fields, including the promoted ones, the shallower wins
+		structs := []types.Type{T}
+		for depth := 0; len(structs) > 0 && depth < 8; depth++ {
+			var embedded []types.Type
+			for _, t := range structs {
+				if p, ok := t.Underlying().(*types.Pointer); ok {
+					t = p.Elem()
+				}
+				s, ok := t.Underlying().(*types.Struct)
+				if !ok {
+					continue
+				}
+				for i := 0; i < s.NumFields(); i++ {
+					f := s.Field(i)
+					if f.Embedded() {
+						embedded = append(embedded, f.Type())
+					}
+					if seen[f.Name()] || !accessible(f) {
+						continue
+					}
+					seen[f.Name()] = true
+					items = append(items, objectItem(f, qualifier, docs))
+				}
+			}
+			structs = embedded
+		}
+	}
+
+	mT := T
+	if _, ok := T.Underlying().(*types.Interface); !ok {
+		if _, ok := T.(*types.Pointer); !ok {
+			mT = types.NewPointer(T)
+		}
+	}
+	mset := types.NewMethodSet(mT)
+	for i := 0; i < mset.Len(); i++ {
+		m := mset.At(i).Obj()
+		if seen[m.Name()] || !accessible(m) {
+			continue
+		}
+		seen[m.Name()] = true
+		items = append(items, objectItem(m, qualifier, docs))
+	}
+	slices.SortStableFunc(items, func(a, b completionItem) int { return strings.Compare(a.label, b.label) })
+	return items
+}
+
+// return the completion item describing obj
+func objectItem(obj types.Object, qualifier types.Qualifier, docs *docFinder) completionItem {
+	item := completionItem{label: obj.Name(), doc: docs.find(obj)}
+	switch obj := obj.(type) {
+	case *types.Func:
+		sig := obj.Type().(*types.Signature)
+		item.kind = "func"
+		if sig.Recv() != nil {
+			item.kind = "method"
+		}
+		// drop the "func" prefix
+		item.detail = strings.TrimPrefix(types.TypeString(sig, qualifier), "func")
+	case *types.Var:
+		item.kind = "var"
+		if obj.IsField() {
+			item.kind = "field"
+		}
+		item.detail = types.TypeString(obj.Type(), qualifier)
+	case *types.Const:
+		item.kind = "const"
+		item.detail = types.TypeString(obj.Type(), qualifier)
+	case *types.TypeName:
+		item.kind = "type"
+		item.detail = types.TypeString(obj.Type().Underlying(), qualifier)
+		if len(item.detail) > 40 {
+			// such as long struct types
+			item.detail = strings.SplitN(item.detail, "{", 2)[0]
+		}
+	}
+	return item
+}
+
+// docFinder finds the doc comments of objects from their source files,
+// each file is parsed once.
+type docFinder struct {
+	fset  *token.FileSet // where the objects are positioned
+	files map[string]docFile
+}
+
+type docFile struct {
+	fset *token.FileSet
+	file *ast.File
+}
+
+// find returns the doc comment of the declaration of obj, or the
+// line comment if there is no doc comment, or empty if there is neither.
+func (d *docFinder) find(obj types.Object) string {
+	pos := d.fset.Position(obj.Pos())
+	if !pos.IsValid() {
+		return ""
+	}
+	f, ok := d.files[pos.Filename]
+	if !ok {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, pos.Filename, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if file == nil {
+			log.Print(err)
+		}
+		// remember the failure too
+		f = docFile{fset, file}
+		d.files[pos.Filename] = f
+	}
+	if f.file == nil {
+		return ""
+	}
+	tf := f.fset.File(f.file.Pos())
+	if pos.Offset > tf.Size() {
+		return ""
+	}
+	target := tf.Pos(pos.Offset)
+
+	var doc *ast.CommentGroup
+	var found bool
+	var stack []ast.Node
+	ast.Inspect(f.file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		if found || target < n.Pos() || n.End() <= target {
+			return false
+		}
+		if id, ok := n.(*ast.Ident); ok && id.Pos() == target {
+			found = true
+			doc = declDoc(stack)
+			return false
+		}
+		stack = append(stack, n)
+		return true
+	})
+	if doc == nil {
+		return ""
+	}
+	return strings.TrimSpace(doc.Text())
+}
+
+// declDoc returns the comment of the innermost declaration in the stack of nodes
+func declDoc(stack []ast.Node) *ast.CommentGroup {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch n := stack[i].(type) {
+		case *ast.FuncDecl:
+			return n.Doc
+		case *ast.Field:
+			if n.Doc != nil {
+				return n.Doc
+			}
+			return n.Comment
+		case *ast.TypeSpec, *ast.ValueSpec:
+			var doc, comment *ast.CommentGroup
+			if spec, ok := n.(*ast.TypeSpec); ok {
+				doc, comment = spec.Doc, spec.Comment
+			} else {
+				spec := n.(*ast.ValueSpec)
+				doc, comment = spec.Doc, spec.Comment
+			}
+			if doc != nil {
+				return doc
+			}
+			if comment != nil {
+				return comment
+			}
+			// the doc of a declaration with a single spec, such as "type T int"
+			if i > 0 {
+				if decl, ok := stack[i-1].(*ast.GenDecl); ok && len(decl.Specs) == 1 {
+					return decl.Doc
+				}
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// wrapText breaks the text into lines no longer than width,
+// paragraphs separated by blank lines are kept.
+func wrapText(text string, width int) []string {
+	if width <= 0 {
+		return nil
+	}
+	var lines []string
+	for i, para := range strings.Split(text, "\n\n") {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		var line []rune
+		for _, word := range strings.Fields(para) {
+			w := []rune(word)
+			if len(line) > 0 && len(line)+1+len(w) > width {
+				lines = append(lines, string(line))
+				line = nil
+			}
+			if len(line) > 0 {
+				line = append(line, ' ')
+			}
+			line = append(line, w...)
+			// break the word longer than a line
+			for len(line) > width {
+				lines = append(lines, string(line[:width]))
+				line = line[width:]
+			}
+		}
+		if len(line) > 0 {
+			lines = append(lines, string(line))
+		}
+	}
+	return lines
+}
+
+// stdIndex indexes the importable packages of the standard library by name,
+// walking GOROOT once, and their exported names when they are first needed.
+var stdIndex struct {
+	once    sync.Once
+	paths   map[string][]string // the shorter path first, such as "math/rand" before "crypto/rand"
+	mu      sync.Mutex
+	exports map[string]map[string]bool // keyed by path
+}
+
+// stdPackage returns the import path of the standard library package with
+// the name, such as "net/http" for "http", or empty if there is none.
+func stdPackage(name string) string {
+	stdIndex.once.Do(indexStd)
+	if paths := stdIndex.paths[name]; len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+// indexStd walks GOROOT for the importable packages of the standard library
+func indexStd() {
+	stdIndex.paths = make(map[string][]string)
+	stdIndex.exports = make(map[string]map[string]bool)
+	root := filepath.Join(build.Default.GOROOT, "src")
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		switch d.Name() {
+		case "cmd", "internal", "vendor", "testdata":
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		name := assumedName(rel)
+		if name == "" || unicode.IsDigit([]rune(name)[0]) {
+			return nil
+		}
+		stdIndex.paths[name] = append(stdIndex.paths[name], rel)
+		return nil
+	})
+	for _, paths := range stdIndex.paths {
+		slices.SortFunc(paths, func(a, b string) int {
+			return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+		})
+	}
+}
+
+// stdExports returns the exported names of the standard library package
+func stdExports(path string) map[string]bool {
+	stdIndex.mu.Lock()
+	defer stdIndex.mu.Unlock()
+	if exports, ok := stdIndex.exports[path]; ok {
+		return exports
+	}
+	exports := make(map[string]bool)
+	dir := filepath.Join(build.Default.GOROOT, "src", filepath.FromSlash(path))
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for name := range topLevelNames(f) {
+			if token.IsExported(name) {
+				exports[name] = true
+			}
+		}
+	}
+	stdIndex.exports[path] = exports
+	return exports
+}
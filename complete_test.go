@@ -0,0 +1,219 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestSelectorMembers(t *testing.T) {
+	src := `package p
+
+import "strings"
+
+type base struct{ ID int }
+
+func (b *base) Key() string { return "" }
+
+type T struct {
+	base
+	Name string // the name of T
+}
+
+// Len returns zero.
+func (t T) Len() int { return 0 }
+
+func f(t T) {
+	t._
+	strings.Rep
+	sort._
+}
+`
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "p.go")
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		row  int
+		dot  int
+		want []completionItem
+		// the prefix of doc comments, keyed by label
+		wantDoc map[string]string
+	}{
+		{
+			name: "fields and methods",
+			row:  17, dot: 2,
+			want: []completionItem{
+				{label: "ID", kind: "field", detail: "int"},
+				{label: "Key", kind: "method", detail: "() string"},
+				{label: "Len", kind: "method", detail: "() int"},
+				{label: "Name", kind: "field", detail: "string"},
+				{label: "base", kind: "field", detail: "base"},
+			},
+			wantDoc: map[string]string{"Len": "Len returns zero.", "Name": "the name of T"},
+		},
+		{
+			name: "imported package",
+			row:  18, dot: 8,
+			want:    []completionItem{{label: "Repeat", kind: "func", detail: "(s string, count int) string"}},
+			wantDoc: map[string]string{"Repeat": "Repeat returns a new string"},
+		},
+		{
+			name: "package not imported",
+			row:  19, dot: 5,
+			want:    []completionItem{{label: "Ints", kind: "func", detail: "(x []int)"}},
+			wantDoc: map[string]string{"Ints": "Ints sorts a slice of ints"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := selectorMembers(filename, []byte(src), tt.row, tt.dot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []completionItem
+			for _, item := range items {
+				for _, w := range tt.want {
+					if item.label != w.label {
+						continue
+					}
+					if prefix := tt.wantDoc[item.label]; !strings.HasPrefix(item.doc, prefix) {
+						t.Errorf("doc of %s = %q, want prefix %q", item.label, item.doc, prefix)
+					}
+					item.doc = ""
+					got = append(got, item)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	text := "Repeat returns a new string consisting of count copies.\n\nIt panics if count is negative."
+	want := []string{
+		"Repeat returns a new",
+		"string consisting of",
+		"count copies.",
+		"",
+		"It panics if count is",
+		"negative.",
+	}
+	if got := wrapText(text, 21); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrapText = %q, want %q", got, want)
+	}
+	if got, want := wrapText("abcdefgh", 3), []string{"abc", "def", "gh"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrapText of a long word = %q, want %q", got, want)
+	}
+}
+
+func TestMoveSuggestion(t *testing.T) {
+	e := &Editor{bx2: 80, by1: 1, by2: 20}
+	e.suggest = &suggestion{x: 0, y: 1}
+	for i := 0; i < 25; i++ {
+		e.suggest.options = append(e.suggest.options, completionItem{label: string(rune('a' + i))})
+	}
+
+	// page down stops at the end, keeping the selected option visible
+	e.moveSuggestion(maxVisibleOptions, false)
+	if e.suggest.i != 10 || e.suggest.top != 1 {
+		t.Errorf("after page down: i = %d, top = %d, want 10, 1", e.suggest.i, e.suggest.top)
+	}
+	e.moveSuggestion(100, false)
+	if e.suggest.i != 24 || e.suggest.top != 15 {
+		t.Errorf("after page down at the end: i = %d, top = %d, want 24, 15", e.suggest.i, e.suggest.top)
+	}
+	// arrows wrap around
+	e.moveSuggestion(1, true)
+	if e.suggest.i != 0 || e.suggest.top != 0 {
+		t.Errorf("after wrapping: i = %d, top = %d, want 0, 0", e.suggest.i, e.suggest.top)
+	}
+
+	// the option under the mouse
+	if i, ok := e.suggestionAt(1, 4); !ok || i != 2 {
+		t.Errorf("suggestionAt = %d, %v, want 2, true", i, ok)
+	}
+
+	// listed upward at the bottom
+	e.suggest.y = 20
+	if rows, up := e.suggestLayout(); rows != maxVisibleOptions || !up {
+		t.Errorf("suggestLayout = %d, %v, want %d, true", rows, up, maxVisibleOptions)
+	}
+}
+
+// runPosted runs the next function posted to the screen
+func runPosted(t *testing.T, screen tcell.Screen) {
+	t.Helper()
+	events := make(chan tcell.Event, 1)
+	go func() { events <- screen.PollEvent() }()
+	select {
+	case ev := <-events:
+		if ev, ok := ev.(*eventFunc); ok {
+			ev.f()
+			return
+		}
+		t.Fatalf("got event %T, want a posted function", ev)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no function posted")
+	}
+}
+
+func TestLoadMembersOutdated(t *testing.T) {
+	src := "package p\n\nfunc f(s struct{ Name string }) {\n\ts.\n}\n"
+	filename := filepath.Join(t.TempDir(), "p.go")
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	e := newEditor(screen, filename, BindStr("", nil))
+	e.SetPos(0, 0, 80, 24)
+	e.lang = languageByName("go")
+	e.buf = nil
+	for _, line := range strings.Split(src, "\n") {
+		e.buf = append(e.buf, []rune(line))
+	}
+	key := func(k tcell.Key) {
+		e.HandleEventKey(tcell.NewEventKey(k, 0, 0), screen)
+	}
+
+	tests := []struct {
+		name string
+		// before the members are loaded
+		do   func()
+		want bool
+	}{
+		{"loaded", func() {}, true},
+		{"cursor moved before the dot", func() { key(tcell.KeyLeft); key(tcell.KeyLeft) }, false},
+		{"dismissed", func() { key(tcell.KeyESC) }, false},
+		{"edited", func() { e.writeRune('N') }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e.buf[3] = []rune("\ts.")
+			e.cursor = pos{3, 3}
+			e.suggest, e.members = nil, nil
+			if !e.loadMembers("") {
+				t.Fatal("the cursor is not after a selector")
+			}
+			tt.do()
+			runPosted(t, screen)
+			if got := e.suggest != nil; got != tt.want {
+				t.Errorf("the members shown: %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
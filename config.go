@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// settings are the user's preferences in the config file
+type settings struct {
+	// format the buffers before saving, Go with gofmt style
+	// and the other languages by the formatters
+	FormatOnSave bool `json:"formatOnSave"`
+	// remove unused imports and add missing ones before saving
+	OrganizeImports bool `json:"organizeImports"`
+	// the external formatters keyed by language, such as "json" and "shell",
+	// they are run on save if formatOnSave is true.
+	Formatters map[string]formatter `json:"formatters"`
+	// the paths not listed in the goto bar or searched, in the syntax of .gitignore
+	Exclude []string `json:"exclude"`
+}
+
+// config is in use, the defaults are overridden by the config file
+var config = defaultConfig()
+
+func defaultConfig() settings {
+	// Go is formatted on save out of the box, the other languages
+	// once their formatters are configured
+	return settings{
+		FormatOnSave: true,
+		Exclude:      []string{"node_modules/"},
+	}
+}
+
+// configFile returns the path of the config file, such as ~/.config/jo/config.json
+func configFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "jo", "config.json")
+}
+
+// loadConfig reads the settings from the file, the missing ones are the defaults.
+// A missing file is not an error.
+func loadConfig(filename string) (settings, error) {
+	c := defaultConfig()
+	if filename == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return defaultConfig(), fmt.Errorf("%s: %w", filename, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// location is a position in a file
+type location struct {
+	filename string
+	cursor   pos
+}
+
+// navigation is the stack of locations jumped from, for going back and forward
+type navigation struct {
+	back    []location
+	forward []location
+}
+
+// the maximum number of locations to go back
+const maxNavigation = 100
+
+var errNoDefinition = errors.New("no definition found")
+
+// definition type-checks src as the content of the file, and returns
+// where the identifier at the row and column is declared. The declarations
+// in other packages are found in the module, GOROOT and the module cache.
+func definition(filename string, src []byte, row, col int) (location, error) {
+	p, err := checker.check(filename, map[string][]byte{filename: src})
+	if err != nil {
+		return location{}, err
+	}
+	id := identAt(p, filename, row, col)
+	if id == nil {
+		return location{}, errNoDefinition
+	}
+	obj := p.info.Uses[id]
+	if obj == nil {
+		obj = p.info.Defs[id]
+	}
+	if obj == nil {
+		return location{}, errNoDefinition
+	}
+	if obj.Parent() == types.Universe {
+		return builtinDefinition(obj.Name())
+	}
+	if !obj.Pos().IsValid() {
+		return location{}, errNoDefinition
+	}
+
+	name, row, col := p.position(obj.Pos())
+	if _, ok := p.src[name]; ok {
+		// the column is in runes already
+		return location{name, pos{row, col}}, nil
+	}
+	position := p.fset.Position(obj.Pos())
+	return fileLocation(position)
+}
+
+// builtinDefinition finds the declaration of the predeclared name,
+// such as "len" and "error", in the documentation of builtin package.
+func builtinDefinition(name string) (location, error) {
+	filename := filepath.Join(build.Default.GOROOT, "src", "builtin", "builtin.go")
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return location{}, err
+	}
+	var found token.Pos
+	ast.Inspect(f, func(n ast.Node) bool {
+		if found.IsValid() {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Name.Name == name {
+				found = n.Name.Pos()
+			}
+			return false
+		case *ast.TypeSpec:
+			if n.Name.Name == name {
+				found = n.Name.Pos()
+			}
+		case *ast.ValueSpec:
+			for _, id := range n.Names {
+				if id.Name == name {
+					found = id.Pos()
+				}
+			}
+		}
+		return true
+	})
+	if !found.IsValid() {
+		return location{}, errNoDefinition
+	}
+	return fileLocation(fset.Position(found))
+}
+
+// fileLocation converts the position in bytes to the location in runes
+func fileLocation(position token.Position) (location, error) {
+	f, err := os.Open(position.Filename)
+	if err != nil {
+		return location{}, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		if line == position.Line {
+			b := s.Bytes()
+			col := min(position.Column-1, len(b))
+			return location{position.Filename, pos{line - 1, utf8.RuneCount(b[:col])}}, nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return location{}, err
+	}
+	return location{position.Filename, pos{position.Line - 1, 0}}, nil
+}
+
+// GoToDefinition jumps to the declaration of the identifier under the cursor,
+// it is resolved in the background.
+func (g *EditorGroup) GoToDefinition() {
+	e := g.editor
+	if e.lang == nil || e.lang.name != "go" || e.filename == "" {
+		message.Set("go to definition: not a Go file")
+		return
+	}
+	filename, err := filepath.Abs(e.filename)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	src := e.bytes()
+	version, cursor := e.version, e.cursor
+	go func() {
+		loc, err := definition(filename, src, cursor.row, cursor.col)
+		post(g.screen, func() {
+			if err != nil {
+				message.Set("go to definition: " + err.Error())
+				return
+			}
+			// the cursor is gone
+			if g.editor != e || e.version != version || e.cursor != cursor {
+				return
+			}
+			g.jump(loc)
+		})
+	}()
+}
+
+// jump goes to the location, remembering the current one to go back
+func (g *EditorGroup) jump(loc location) {
+	g.nav.back = append(g.nav.back, g.location())
+	if len(g.nav.back) > maxNavigation {
+		g.nav.back = g.nav.back[1:]
+	}
+	g.nav.forward = nil
+	g.openAt(loc)
+}
+
+// GoBack returns to the location before the last jump
+func (g *EditorGroup) GoBack() {
+	if len(g.nav.back) == 0 {
+		return
+	}
+	loc := g.nav.back[len(g.nav.back)-1]
+	g.nav.back = g.nav.back[:len(g.nav.back)-1]
+	g.nav.forward = append(g.nav.forward, g.location())
+	g.openAt(loc)
+}
+
+// GoForward undoes GoBack
+func (g *EditorGroup) GoForward() {
+	if len(g.nav.forward) == 0 {
+		return
+	}
+	loc := g.nav.forward[len(g.nav.forward)-1]
+	g.nav.forward = g.nav.forward[:len(g.nav.forward)-1]
+	g.nav.back = append(g.nav.back, g.location())
+	g.openAt(loc)
+}
+
+// location returns the current location
+func (g *EditorGroup) location() location {
+	return location{g.editor.filename, g.editor.cursor}
+}
+
+// openAt opens the file and puts the cursor at the location, in the middle of the page
+func (g *EditorGroup) openAt(loc location) {
+	old := g.editor
+	g.Open(loc.filename)
+	if g.editor != old {
+		old.Blur()
+	}
+	e := g.editor
+	// lay out the editor before scrolling
+	g.Draw(g.screen)
+	row := max(0, min(loc.cursor.row, len(e.buf)-1))
+	col := max(0, min(loc.cursor.col, len(e.buf[row])))
+	e.cursor = pos{row, col}
+	e.top = max(1, row+1-e.PageSize()/2)
+	g.Draw(g.screen)
+	e.syncCursor()
+	x, y := g.Focus()
+	g.screen.ShowCursor(x, y)
+}
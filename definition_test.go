@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestDefinition(t *testing.T) {
+	src := `package p
+
+import "strings"
+
+func f() int {
+	s := strings.Repeat("é", n)
+	return len(s) + g()
+}
+`
+	other := `package p
+
+const n = 2
+
+func g() int { return 0 }
+`
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "p.go")
+	for name, content := range map[string]string{"p.go": src, "q.go": other} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		row, col   int
+		wantFile   string // suffix of the file name
+		wantCursor pos    // ignored for files outside the package
+	}{
+		{name: "local variable", row: 6, col: 12, wantFile: "p.go", wantCursor: pos{5, 1}},
+		{name: "other file", row: 5, col: 26, wantFile: "q.go", wantCursor: pos{2, 6}},
+		{name: "end of identifier", row: 6, col: 18, wantFile: "q.go", wantCursor: pos{4, 5}},
+		{name: "standard library", row: 5, col: 16, wantFile: filepath.Join("strings", "strings.go")},
+		{name: "builtin", row: 6, col: 9, wantFile: filepath.Join("builtin", "builtin.go")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := definition(filename, []byte(src), tt.row, tt.col)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(loc.filename, tt.wantFile) {
+				t.Errorf("file = %s, want %s", loc.filename, tt.wantFile)
+			}
+			if tt.wantCursor != (pos{}) && loc.cursor != tt.wantCursor {
+				t.Errorf("cursor = %v, want %v", loc.cursor, tt.wantCursor)
+			}
+		})
+	}
+
+	if _, err := definition(filename, []byte(src), 1, 0); err != errNoDefinition {
+		t.Errorf("definition of a blank line: %v, want %v", err, errNoDefinition)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, name := range []string{a, b} {
+		if err := os.WriteFile(name, []byte(strings.Repeat("line\n", 100)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := NewEditorGroup(screen, BindStr("", nil))
+	g.SetPos(0, 0, 80, 24)
+	g.Open(a)
+	g.editor.cursor = pos{3, 1}
+
+	g.jump(location{b, pos{50, 2}})
+	if got := g.location(); got.filename != b || got.cursor != (pos{50, 2}) {
+		t.Fatalf("after jump: %v", got)
+	}
+	if g.editor.top > 51 || g.editor.top+g.editor.PageSize() <= 51 {
+		t.Errorf("the target line is not visible, top = %d", g.editor.top)
+	}
+	g.GoBack()
+	if got := g.location(); got.filename != a || got.cursor != (pos{3, 1}) {
+		t.Errorf("after going back: %v", got)
+	}
+	g.GoForward()
+	if got := g.location(); got.filename != b || got.cursor != (pos{50, 2}) {
+		t.Errorf("after going forward: %v", got)
+	}
+	if g.titleBar.names[g.titleBar.i] != b {
+		t.Errorf("the title is %s, want %s", g.titleBar.names[g.titleBar.i], b)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// diagnostic is an error or warning of a file, from parsing and type checking
+type diagnostic struct {
+	row, col int // the column is in runes
+	msg      string
+	warning  bool // soft errors, such as unused variables and imports
+}
+
+func (d diagnostic) String() string {
+	if d.warning {
+		return "warning: " + d.msg
+	}
+	return "error: " + d.msg
+}
+
+// problems holds the diagnostics of the type-checked packages,
+// keyed by the directory of package and then the file name.
+// It is only accessed in the event loop.
+var problems = make(map[string]map[string][]diagnostic)
+
+// diagnosticsOf returns the diagnostics of every file in the package,
+// sorted by position, keyed by the absolute file name.
+func diagnosticsOf(p *goPackage) map[string][]diagnostic {
+	diags := make(map[string][]diagnostic)
+	for name := range p.src {
+		diags[name] = nil
+	}
+	for _, err := range p.errs {
+		src, ok := p.src[err.pos.Filename]
+		if !ok || err.pos.Line < 1 {
+			continue
+		}
+		line := rawLine(src, err.pos.Line-1)
+		col := utf8.RuneCountInString(line[:max(0, min(err.pos.Column-1, len(line)))])
+		d := diagnostic{row: err.pos.Line - 1, col: col, msg: err.msg, warning: err.soft}
+		if !slices.Contains(diags[err.pos.Filename], d) {
+			diags[err.pos.Filename] = append(diags[err.pos.Filename], d)
+		}
+	}
+	for _, list := range diags {
+		slices.SortStableFunc(list, func(a, b diagnostic) int {
+			return cmp.Or(cmp.Compare(a.row, b.row), cmp.Compare(a.col, b.col))
+		})
+	}
+	return diags
+}
+
+// setDiagnostics updates the problems of the package checked for the buffer
+func (e *Editor) setDiagnostics(filename string, diags map[string][]diagnostic) {
+	problems[filepath.Dir(filename)] = diags
+	e.diagnostics = diags[filename]
+	e.hovered = nil
+	if e.focused {
+		// the counts in the status bar
+		e.syncCursor()
+	}
+}
+
+// problemCounts returns the counts of errors and warnings for the status bar,
+// such as "2 errors, 1 warning", or "" if there are none.
+func problemCounts(diags []diagnostic) string {
+	var errs, warnings int
+	for _, d := range diags {
+		if d.warning {
+			warnings++
+		} else {
+			errs++
+		}
+	}
+	plural := func(n int, s string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, s)
+		}
+		return fmt.Sprintf("%d %ss", n, s)
+	}
+	switch {
+	case errs > 0 && warnings > 0:
+		return plural(errs, "error") + ", " + plural(warnings, "warning")
+	case errs > 0:
+		return plural(errs, "error")
+	case warnings > 0:
+		return plural(warnings, "warning")
+	}
+	return ""
+}
+
+// lineDiagnostic returns the most severe diagnostic of the row, or nil
+func (e *Editor) lineDiagnostic(row int) *diagnostic {
+	var found *diagnostic
+	for i, d := range e.diagnostics {
+		if d.row == row && (found == nil || found.warning && !d.warning) {
+			found = &e.diagnostics[i]
+		}
+	}
+	return found
+}
+
+// diagnosticStyle returns the color of the diagnostic
+func diagnosticStyle(d *diagnostic) tcell.Style {
+	color := theme.diagError
+	if d.warning {
+		color = theme.diagWarning
+	}
+	return tcell.StyleDefault.Background(tcell.ColorReset).Foreground(color)
+}
+
+// drawDiagnostic underlines the word at the diagnostic, and draws the message
+// after the end of the line if there is room.
+func (e *Editor) drawDiagnostic(screen tcell.Screen, line int) {
+	d := e.lineDiagnostic(line - 1)
+	if d == nil {
+		return
+	}
+	y := e.by1 + line - e.top
+	text := e.buf[line-1]
+	if d.col < len(text) {
+		end := d.col + 1
+		for end < len(text) && isWordRune(text[d.col]) && isWordRune(text[end]) {
+			end++
+		}
+		for j := d.col; j < end; j++ {
+			x := e.bx1 + padCol(text, j)
+			if x > e.bx2 {
+				break
+			}
+			c, _, style, _ := screen.GetContent(x, y)
+			screen.SetContent(x, y, c, nil, style.Underline(true))
+		}
+	}
+	style := diagnosticStyle(d)
+	x := e.bx1 + padCol(text, len(text)) + 2
+	for _, c := range d.msg {
+		if x > e.bx2 {
+			break
+		}
+		screen.SetContent(x, y, c, nil, style)
+		x++
+	}
+}
+
+// Hover shows the diagnostic of the line under the mouse in the status bar
+func (e *Editor) Hover(x, y int) {
+	row := e.top - 1 + y - e.by1
+	if y < e.by1 || y > e.by2 || row >= len(e.buf) {
+		return
+	}
+	d := e.lineDiagnostic(row)
+	if d == nil || d == e.hovered {
+		e.hovered = d
+		return
+	}
+	e.hovered = d
+	message.Set(d.String())
+}
+
+// nextDiagnostic returns the diagnostic n after the cursor, wrapping around,
+// n may be negative for the previous ones.
+func (e *Editor) nextDiagnostic(n int) (diagnostic, bool) {
+	if len(e.diagnostics) == 0 || n == 0 {
+		return diagnostic{}, false
+	}
+	// the index of the first diagnostic after the cursor
+	i, found := slices.BinarySearchFunc(e.diagnostics, e.cursor, func(d diagnostic, p pos) int {
+		return cmp.Or(cmp.Compare(d.row, p.row), cmp.Compare(d.col, p.col))
+	})
+	if n > 0 {
+		if found {
+			i++
+		}
+		i += n - 1
+	} else {
+		i += n
+	}
+	count := len(e.diagnostics)
+	return e.diagnostics[((i%count)+count)%count], true
+}
+
+// NextProblem moves the cursor to the diagnostic n after the cursor,
+// and shows its message.
+func (g *EditorGroup) NextProblem(n int) {
+	d, ok := g.editor.nextDiagnostic(n)
+	if !ok {
+		message.Set("no problems")
+		return
+	}
+	g.openAt(location{g.editor.filename, pos{d.row, d.col}})
+	message.Set(d.String())
+}
+
+// problemList returns the diagnostics of the packages containing the buffers,
+// and the counts of them.
+func problemList(buffers []*Editor) (refs []reference, counts string) {
+	dirs := make(map[string]bool)
+	for _, e := range buffers {
+		if e.filename == "" {
+			continue
+		}
+		if name, err := filepath.Abs(e.filename); err == nil {
+			dirs[filepath.Dir(name)] = true
+		}
+	}
+	var all []diagnostic
+	for dir := range dirs {
+		for name, diags := range problems[dir] {
+			for _, d := range diags {
+				refs = append(refs, reference{location: location{name, pos{d.row, d.col}}, text: d.String()})
+			}
+			all = append(all, diags...)
+		}
+	}
+	sortReferences(refs)
+	return refs, problemCounts(all)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiagnosticsOf(t *testing.T) {
+	src := `package p
+
+import "strings"
+
+func f() int {
+	var 名前, unused int
+	return 名前 + "x"
+}
+`
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "p.go")
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := new(goChecker).check(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := diagnosticsOf(p)[filename]
+	want := []diagnostic{
+		{row: 2, col: 7, msg: `"strings" imported and not used`, warning: true},
+		{row: 5, col: 9, msg: "declared and not used: unused", warning: true},
+		{row: 6, col: 8, msg: `invalid operation: 名前 + "x" (mismatched types int and untyped string)`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics = %#v, want %#v", got, want)
+	}
+	if got := problemCounts(got); got != "1 error, 2 warnings" {
+		t.Errorf("counts = %q", got)
+	}
+}
+
+func TestNextDiagnostic(t *testing.T) {
+	e := newTestEditor("a.go", "a", "b", "c", "d")
+	e.diagnostics = []diagnostic{{row: 1, col: 0}, {row: 3, col: 0}}
+	tests := []struct {
+		cursor pos
+		n      int
+		want   int // the row
+	}{
+		{cursor: pos{0, 0}, n: 1, want: 1},
+		{cursor: pos{1, 0}, n: 1, want: 3},
+		{cursor: pos{3, 0}, n: 1, want: 1},
+		{cursor: pos{2, 0}, n: -1, want: 1},
+		{cursor: pos{1, 0}, n: -1, want: 3},
+		{cursor: pos{0, 0}, n: -1, want: 3},
+	}
+	for _, tt := range tests {
+		e.cursor = tt.cursor
+		d, ok := e.nextDiagnostic(tt.n)
+		if !ok || d.row != tt.want {
+			t.Errorf("from %v by %d: row %d, want %d", tt.cursor, tt.n, d.row, tt.want)
+		}
+	}
+}
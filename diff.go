@@ -0,0 +1,121 @@
+package main
+
+import "slices"
+
+// hunk replaces the lines a[i1:i2] with b[j1:j2]
+type hunk struct {
+	i1, i2 int
+	j1, j2 int
+}
+
+// the most changed lines to diff, the more are replaced in one hunk,
+// since the memory grows with the square of them
+const maxDiffChanges = 1000
+
+// diffLines returns the hunks changing a into b, in order, with the fewest
+// changed lines by the Myers algorithm.
+func diffLines(a, b []string) []hunk {
+	// the common prefix and suffix are not changed
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	n, m := len(a), len(b)
+	total := n + m
+	if total == 0 {
+		return nil
+	}
+	// v[k+total] is the furthest x on diagonal k, trace[d] keeps v[-d..d] of step d
+	v := make([]int, 2*total+2)
+	var trace [][]int
+	var end int
+	for d := 0; d <= total; d++ {
+		if d > maxDiffChanges {
+			return []hunk{{prefix, prefix + n, prefix, prefix + m}}
+		}
+		found := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[k-1+total] < v[k+1+total] {
+				x = v[k+1+total]
+			} else {
+				x = v[k-1+total] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+total] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		trace = append(trace, slices.Clone(v[total-d:total+d+1]))
+		if found {
+			end = d
+			break
+		}
+	}
+
+	// walk back to collect the changed lines of each step
+	var deleted, inserted []int // the indexes in a and b, in reverse order
+	x, y := n, m
+	for d := end; d > 0; d-- {
+		// the furthest x on the diagonals of the previous step
+		prev := func(k int) int { return trace[d-1][k+d-1] }
+		k := x - y
+		var prevK int
+		if k == -d || k != d && prev(k-1) < prev(k+1) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+		if x == prevX {
+			y--
+			inserted = append(inserted, y)
+		} else {
+			x--
+			deleted = append(deleted, x)
+		}
+	}
+
+	// merge the changed lines into hunks
+	var hunks []hunk
+	i, j := 0, 0
+	di, ii := len(deleted)-1, len(inserted)-1
+	for di >= 0 || ii >= 0 {
+		// skip the equal lines
+		for (di < 0 || i < deleted[di]) && (ii < 0 || j < inserted[ii]) {
+			i++
+			j++
+		}
+		i1, j1 := i, j
+		for {
+			if di >= 0 && deleted[di] == i {
+				i++
+				di--
+			} else if ii >= 0 && inserted[ii] == j {
+				j++
+				ii--
+			} else {
+				break
+			}
+		}
+		hunks = append(hunks, hunk{i1 + prefix, i + prefix, j1 + prefix, j + prefix})
+	}
+	return hunks
+}
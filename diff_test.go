@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []hunk
+	}{
+		{a: "a b c", b: "a b c", want: nil},
+		{a: "a b c", b: "a x c", want: []hunk{{1, 2, 1, 2}}},
+		{a: "a b c", b: "x a b c y", want: []hunk{{0, 0, 0, 1}, {3, 3, 4, 5}}},
+		{a: "a b c d e", b: "a c e", want: []hunk{{1, 2, 1, 1}, {3, 4, 2, 2}}},
+		{a: "", b: "a b", want: []hunk{{0, 0, 0, 2}}},
+		{a: "a b c a b b a", b: "c b a b a c", want: nil},
+	}
+	for _, tt := range tests {
+		a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+		got := diffLines(a, b)
+		if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("diffLines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		// the hunks change a into b
+		out := slices.Clone(a)
+		for i := len(got) - 1; i >= 0; i-- {
+			h := got[i]
+			out = slices.Replace(out, h.i1, h.i2, b[h.j1:h.j2]...)
+		}
+		if !slices.Equal(out, b) {
+			t.Errorf("applying the hunks of %q to %q: got %q", tt.a, tt.b, out)
+		}
+	}
+}
+
+func TestDiffLinesLimit(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxDiffChanges; i++ {
+		a = append(a, fmt.Sprint("a", i))
+		b = append(b, fmt.Sprint("b", i))
+	}
+	a = append([]string{"same"}, append(a, "same")...)
+	b = append([]string{"same"}, append(b, "same")...)
+	// too many changes are replaced in one hunk, between the equal lines
+	want := []hunk{{1, maxDiffChanges + 1, 1, maxDiffChanges + 1}}
+	if got := diffLines(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffLines = %v, want %v", got, want)
+	}
+}
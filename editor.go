@@ -3,11 +3,11 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"go/token"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
@@ -23,6 +23,7 @@ type EditorGroup struct {
 	titleBar *titleBar
 	status   *bindStr
 	all      []*Editor
+	nav      navigation // locations to go back and forward
 }
 
 func NewEditorGroup(screen tcell.Screen, status *bindStr) *EditorGroup {
@@ -60,6 +61,10 @@ func (g *EditorGroup) ScrollDown(delta int) (ok bool) {
 	return g.editor.ScrollDown(delta)
 }
 
+func (g *EditorGroup) Hover(x, y int) {
+	g.editor.Hover(x, y)
+}
+
 func (g *EditorGroup) HandleEventKey(ev *tcell.EventKey, screen tcell.Screen) {
 	g.editor.HandleEventKey(ev, screen)
 }
@@ -85,13 +90,17 @@ func (g *EditorGroup) Draw(screen tcell.Screen) {
 }
 
 func (g *EditorGroup) Open(name string) {
-	if g.editor.filename == name {
+	if name != "" {
+		recentFiles.add(name)
+	}
+	if sameFile(g.editor.filename, name) {
 		return
 	}
 
 	for _, e := range g.all {
-		if e.filename == name {
+		if sameFile(e.filename, name) {
 			g.editor = e
+			g.titleBar.Add(e.filename)
 			return
 		}
 	}
@@ -103,6 +112,18 @@ func (g *EditorGroup) Open(name string) {
 	g.titleBar.Add(name)
 }
 
+// show shows the open buffer, without recording it as opened
+func (g *EditorGroup) show(e *Editor) {
+	if g.editor == e {
+		return
+	}
+	e.SetPos(g.editor.x, g.editor.y, g.editor.width, g.editor.height)
+	g.editor = e
+	if e.filename != "" {
+		g.titleBar.Add(e.filename)
+	}
+}
+
 func (g *EditorGroup) CloseOne() {
 	t := g.titleBar
 	if len(t.names) == 0 {
@@ -113,6 +134,7 @@ func (g *EditorGroup) CloseOne() {
 	t.Del()
 	if len(t.names) == 0 {
 		// reset
+		words.remove(g.editor)
 		g.editor = newEditor(g.screen, "", g.status)
 		g.all = nil
 		return
@@ -125,11 +147,70 @@ func (g *EditorGroup) CloseOne() {
 		}
 		if e.filename == oldname {
 			old = i
+			words.remove(e)
 		}
 	}
 	g.all = slices.Delete(g.all, old, old+1)
 }
 
+// closeFile closes the tab of the buffer, keeping the current one shown
+func (g *EditorGroup) closeFile(e *Editor) {
+	i := slices.Index(g.titleBar.names, e.filename)
+	if i < 0 || !slices.Contains(g.all, e) {
+		return
+	}
+	current := g.editor
+	g.titleBar.i = i
+	g.editor = e
+	g.CloseOne()
+	if current != e && slices.Contains(g.all, current) {
+		g.show(current)
+	}
+}
+
+// renameFile updates the buffers of the file, or of the files in the directory,
+// after it is renamed.
+func (g *EditorGroup) renameFile(old, new string) {
+	for _, e := range g.all {
+		if e.filename == "" {
+			continue
+		}
+		if !inPath(old, e.filename) {
+			continue
+		}
+		rel, _ := filepath.Rel(absName(old), absName(e.filename))
+		name := relativeName(absName(filepath.Join(new, rel)))
+		if i := slices.Index(g.titleBar.names, e.filename); i >= 0 {
+			g.titleBar.names[i] = name
+		}
+		lang := e.lang
+		e.filename = name
+		if l := detectLanguage(name, e.buf[0]); l != lang {
+			e.setLanguage(l)
+		}
+	}
+}
+
+// sameFile reports whether the names refer to the same file,
+// one of them may be relative.
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if a == "" || b == "" {
+		return false
+	}
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false
+	}
+	return absA == absB
+}
+
 type Editor struct {
 	BaseView
 	screen tcell.Screen
@@ -143,11 +224,31 @@ type Editor struct {
 	cursor   pos // write at buf[cursor.row][cursor.col]
 	dirty    bool
 	filename string
+	readOnly bool // the buffer can not be changed or saved
+
+	// language for highlighting, nil for plain text
+	lang *language
+	// lexer states at the beginning of lines, for highlighting
+	lexStates lineStates
+	edits     editedRows // the rows edited since the words are indexed
+	// identifiers classified by type checking, keyed by row
+	semantic map[int][]semToken
+	version  int         // incremented on every change, to discard outdated analysis
+	analysis *time.Timer // pending analysis
+
+	diagnostics []diagnostic // sorted by position
+	hovered     *diagnostic  // the diagnostic under the mouse
 
 	lineBar *lineBar
 	status  *bindStr
 
-	suggest *suggestion
+	suggest    *suggestion
+	members    *members    // the last completion of selector
+	loading    int         // incremented to drop the members loaded in the background
+	completion *time.Timer // pending completion triggered by typing
+
+	snippet   *snippetSession // the snippet being filled in
+	signature *signatureHelp  // the signature of the call around the cursor
 
 	find find
 
@@ -167,13 +268,28 @@ type Editor struct {
 
 type find struct {
 	key   string
+	opts  findOptions
+	re    *regexp.Regexp
 	line  int
-	match [][2]int
+	match []findMatch
 	index int // index of the matching result
 }
 
 func (e *Editor) Click(x, y int) {
 	e.BaseView.Click(x, y)
+	e.snippet = nil
+	if e.suggest != nil {
+		i, ok := e.suggestionAt(x, y)
+		if ok {
+			e.suggest.i = i
+			e.accecptSuggestion()
+			e.Draw(e.screen)
+			return
+		}
+		e.suggest = nil
+		e.members = nil
+		e.Draw(e.screen)
+	}
 	if y < e.by1 {
 		y = e.by1
 	}
@@ -254,8 +370,6 @@ func (e *Editor) Click(x, y int) {
 	e.drawLine(e.screen, e.cursor.row+1)
 }
 
-var tokenTree = new(node)
-
 func newEditor(screen tcell.Screen, filename string, status *bindStr) *Editor {
 	style := tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorReset)
 	e := &Editor{
@@ -265,6 +379,7 @@ func newEditor(screen tcell.Screen, filename string, status *bindStr) *Editor {
 		filename: filename,
 		lineBar:  new(lineBar),
 		status:   status,
+		readOnly: readOnly,
 	}
 
 	if filename == "" {
@@ -272,27 +387,36 @@ func newEditor(screen tcell.Screen, filename string, status *bindStr) *Editor {
 		return e
 	}
 
-	var a [][]byte
 	src, err := os.ReadFile(filename)
 	if err != nil {
 		log.Println(err)
 		e.buf = append(e.buf, []rune{})
+		e.lang = detectLanguage(filename, nil)
 		return e
 	}
-	a = bytes.Split(src, []byte{'\n'})
+	e.setText(src)
+	return e
+}
+
+// setText loads the buffer with src, detecting the language
+func (e *Editor) setText(src []byte) {
+	a := bytes.Split(src, []byte{'\n'})
 	e.buf = make([][]rune, len(a))
 	for i := range a {
 		e.buf[i] = []rune(string(a[i]))
 	}
 
 	if len(e.buf) > 0 {
-		buildTokenTree(tokenTree, e.buf)
+		e.lang = detectLanguage(e.filename, e.buf[0])
 	}
 	// file ends with a new line
 	if len(e.buf) == 0 || len(e.buf[len(e.buf)-1]) != 0 {
 		e.buf = append(e.buf, []rune{})
 	}
-	return e
+	e.lexStates = lineStates{}
+	e.edits = editedRows{}
+	words.index(e)
+	e.scheduleAnalysis()
 }
 
 // the number of lines visible in the editor view
@@ -348,6 +472,7 @@ func unpadCol(line []rune, padCol int) int {
 
 // draw a row of the buffer, parameter line is the line number starting from 1
 func (e *Editor) drawLine(screen tcell.Screen, line int) {
+	defer e.drawDiagnostic(screen, line)
 	text := e.buf[line-1]
 	for x := e.bx1; x <= e.bx2; x++ {
 		if x <= e.bx1+len(text)-1 {
@@ -361,18 +486,26 @@ func (e *Editor) drawLine(screen tcell.Screen, line int) {
 	}
 
 	var mi int
-	var matches [][2]int
+	var matches []findMatch
 	for _, m := range e.find.match {
-		if m[0] == line-1 {
+		if m.row == line-1 {
 			matches = append(matches, m)
 		}
 	}
 
-	var style = e.style
 	var i int
-	var tokenInfo []tokenInfo
-	if filepath.Ext(e.filename) == ".go" {
-		tokenInfo = parseToken(text)
+	var tokens []tokenInfo
+	if lex := e.lexer(); lex != nil {
+		tokens, _ = lex.Lex(text, e.lexStates.get(e.buf, line-1, lex))
+	}
+
+	// semantic tokens still matching the text after edits
+	var k int
+	var sems []semToken
+	for _, t := range e.semantic[line-1] {
+		if t.off+t.len <= len(text) && string(text[t.off:t.off+t.len]) == t.name {
+			sems = append(sems, t)
+		}
 	}
 
 	tabs := leadingTabs(text)
@@ -382,31 +515,35 @@ func (e *Editor) drawLine(screen tcell.Screen, line int) {
 		if e.bx1+padding+j > e.bx2 {
 			break
 		}
-		if len(tokenInfo) > 0 {
-			if j >= tokenInfo[i].off+tokenInfo[i].len && i < len(tokenInfo)-1 {
-				i++
-			}
-			style = tokenInfo[i].Style().Background(bg)
+		style := e.style
+		for i < len(tokens) && j >= tokens[i].off+tokens[i].len {
+			i++
+		}
+		if i < len(tokens) && j >= tokens[i].off {
+			style = tokens[i].Style().Background(bg)
+		}
+		for k < len(sems) && j >= sems[k].off+sems[k].len {
+			k++
+		}
+		if k < len(sems) && j >= sems[k].off {
+			style = sems[k].Style().Background(bg)
 		}
 
 		// highlight search results
-		if len(matches) > 0 && mi < len(matches) {
-			if matches[mi][1] <= j && j < matches[mi][1]+len(e.find.key) {
-				if matches[mi] == e.find.match[e.find.index] {
-					style = style.Background(tcell.ColorYellow)
-				} else {
-					style = style.Background(tcell.ColorLightGray)
-				}
-			} else if j >= matches[mi][1]+len(e.find.key) {
-				mi++
-				// restore
-				style = style.Background(bg)
+		for mi < len(matches) && j >= matches[mi].col+matches[mi].len {
+			mi++
+		}
+		if mi < len(matches) && j >= matches[mi].col {
+			if matches[mi] == e.find.match[e.find.index] {
+				style = style.Background(theme.matchCurrent)
+			} else {
+				style = style.Background(theme.match)
 			}
 		}
 
 		// highlight selection
 		if e.selection != nil && e.selection.start.row+1 == line && e.selection.start.col <= j && j <= e.selection.stop.col {
-			style = style.Background(tcell.ColorLightGray)
+			style = style.Background(theme.selection)
 		}
 
 		screen.SetContent(e.bx1+padding+j, e.by1+line-e.top, text[j], nil, style)
@@ -421,6 +558,36 @@ func (e *Editor) drawLine(screen tcell.Screen, line int) {
 	}
 }
 
+// return the lexer for highlighting the buffer, or nil for plain text
+func (e *Editor) lexer() Lexer {
+	if e.lang == nil {
+		return nil
+	}
+	return e.lang.lexer
+}
+
+// setLanguage overrides the detected language of the buffer,
+// nil means plain text.
+func (e *Editor) setLanguage(lang *language) {
+	e.lang = lang
+	e.lexStates = lineStates{}
+	// the words depend on the lexer
+	e.edits = editedRows{}
+	e.semantic = nil
+	e.diagnostics = nil
+	e.scheduleAnalysis()
+}
+
+// drawEdited draws the line under cursor after it is edited, or the whole
+// editor if the highlighting of the lines below changes, such as opening a block comment.
+func (e *Editor) drawEdited(screen tcell.Screen) {
+	if lex := e.lexer(); lex != nil && e.lexStates.changedBelow(e.buf, e.cursor.row, lex) {
+		e.Draw(screen)
+		return
+	}
+	e.drawLine(screen, e.cursor.row+1)
+}
+
 func (e *Editor) Draw(screen tcell.Screen) {
 	lineBarWidth := 2
 	for i := len(e.buf); i > 0; i = i / 10 {
@@ -444,6 +611,12 @@ func (e *Editor) Draw(screen tcell.Screen) {
 		bottom = len(e.buf)
 	}
 	e.lineBar.bottom = bottom
+	e.lineBar.marks = make(map[int]tcell.Style)
+	for _, d := range e.diagnostics {
+		if _, ok := e.lineBar.marks[d.row+1]; !ok || !d.warning {
+			e.lineBar.marks[d.row+1] = diagnosticStyle(&d)
+		}
+	}
 	e.lineBar.Draw(screen)
 
 	for y := e.by1; y <= e.by2; y++ {
@@ -458,12 +631,22 @@ func (e *Editor) Draw(screen tcell.Screen) {
 		}
 		e.drawLine(screen, e.top+i)
 	}
+	if e.signature != nil {
+		e.showSignature(screen)
+	}
+	if e.suggest != nil {
+		e.showSuggestion(screen)
+	}
 }
 
 // use buffer cursor to update screen cursor and status bar
 func (e *Editor) syncCursor() {
 	padCol := padCol(e.buf[e.cursor.row], e.cursor.col)
-	e.status.Set(fmt.Sprintf("line %d, column %d", e.cursor.row+1, padCol+1))
+	status := fmt.Sprintf("line %d, column %d", e.cursor.row+1, padCol+1)
+	if counts := problemCounts(e.diagnostics); counts != "" {
+		status += ", " + counts
+	}
+	e.status.Set(status)
 	e.cursorX = e.bx1 + padCol
 	e.cursorY = e.by1 + e.cursor.row + 1 - e.top
 }
@@ -576,13 +759,14 @@ func (e *Editor) writeString(s string) {
 // If redraw is true, caller should redraw editor,
 // otherwise render the current line.
 func (e *Editor) deleteLeft() (redraw bool) {
-	e.dirty = true
+	e.changed()
 	// cursor at the head of line, so concatenate previous line
 	if e.cursor.col == 0 {
 		if e.cursor.row == 0 {
 			return
 		}
 		prevLine := e.buf[e.cursor.row-1]
+		e.editing(e.cursor.row-1, 2, true)
 		e.buf[e.cursor.row-1] = append(prevLine, e.buf[e.cursor.row]...)
 		e.buf = append(e.buf[:e.cursor.row], e.buf[e.cursor.row+1:]...)
 		Move(e, pos{e.cursor.row - 1, len(prevLine)}).Do()
@@ -622,7 +806,8 @@ func (e *Editor) cursorEnter() {
 	// auto indent
 	text := append(indent, line[e.cursor.col:]...)
 
-	e.dirty = true
+	e.changed()
+	e.editing(e.cursor.row, 1, true)
 	e.buf[e.cursor.row] = line[:e.cursor.col]
 	e.buf = slices.Insert(e.buf, e.cursor.row+1, text)
 	Move(e, pos{e.cursor.row + 1, n}).Do()
@@ -631,51 +816,93 @@ func (e *Editor) cursorEnter() {
 // A newline is appended if the last character of buffer is not
 // already a newline
 func (e *Editor) WriteTo(w io.Writer) (int64, error) {
-	var b bytes.Buffer
-	for i := range e.buf {
-		b.WriteString(string(e.buf[i]))
-		if i != len(e.buf)-1 || len(e.buf[i]) != 0 {
-			b.WriteString("\n")
-		}
-	}
-	n, err := b.WriteTo(w)
+	n, err := w.Write(e.bytes())
 	if err != nil {
-		return n, err
+		return int64(n), err
 	}
 
 	e.dirty = false
-	buildTokenTree(tokenTree, e.buf)
-	return n, nil
+	if e.lang != nil && e.lang.name == "go" {
+		// packages importing this file are outdated
+		checker.reset()
+	}
+	return int64(n), nil
 }
 
-func (e *Editor) Find(s string) {
-	if len(s) == 0 {
+// save formats the buffer as configured, and writes it to its file after.
+// It is saved even if formatting fails, done is called in the event loop
+// with the error of writing, or the failure of formatting.
+func (e *Editor) save(done func(error)) {
+	organize := config.OrganizeImports && e.lang != nil && e.lang.name == "go"
+	format := config.FormatOnSave && canFormat(e.lang)
+	if !organize && !format {
+		done(e.writeFile())
 		return
 	}
-	e.find.key = s
+	e.formatInBackground(organize, format, func(err error) {
+		if werr := e.writeFile(); werr != nil {
+			done(werr)
+			return
+		}
+		if err != nil {
+			done(fmt.Errorf("format: %w", err))
+			return
+		}
+		done(nil)
+	})
+}
 
-	var match [][2]int
+// writeFile writes the buffer to its file
+func (e *Editor) writeFile() error {
+	f, err := os.Create(e.filename)
+	if err != nil {
+		return err
+	}
+	_, err = e.WriteTo(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// return content of the buffer.
+// A newline is appended if the last character of buffer is not
+// already a newline
+func (e *Editor) bytes() []byte {
+	var b bytes.Buffer
 	for i := range e.buf {
-		var index, start int
-		for {
-			index = strings.Index(string(e.buf[i][start:]), s)
-			if index < 0 {
-				break
-			}
-			match = append(match, [2]int{i, start + index})
-			start += index + len(s)
+		b.WriteString(string(e.buf[i]))
+		if i != len(e.buf)-1 || len(e.buf[i]) != 0 {
+			b.WriteString("\n")
 		}
 	}
-	e.find.match = match
+	return b.Bytes()
+}
+
+// Find searches the buffer for the pattern, and puts the cursor at the nearest match
+func (e *Editor) Find(s string, opts findOptions) error {
+	if len(s) == 0 {
+		return nil
+	}
+	re, err := opts.compile(s)
+	if err != nil {
+		e.find.match = nil
+		return err
+	}
+	e.find.key = s
+	e.find.opts = opts
+	e.find.re = re
+	e.find.match = e.findAll()
+	match := e.find.match
 	if len(match) == 0 {
-		return
+		return nil
 	}
 
 	// jump to the nearest match
 	var minGap = len(e.buf)
 	var near int
 	for i, m := range match {
-		gap := m[0] - e.find.line
+		gap := m.row - e.find.line
 		if gap < 0 {
 			gap = 0 - gap
 		}
@@ -691,15 +918,21 @@ func (e *Editor) Find(s string) {
 		}
 	}
 	e.find.index = near
+	e.showMatch()
+	return nil
+}
 
-	e.cursor.row = match[near][0]
-	// place the cursor at the end of the matching word for easy editing
-	e.cursor.col = match[near][1] + len(e.find.key)
+// showMatch scrolls to the current match
+func (e *Editor) showMatch() {
+	m := e.find.match[e.find.index]
+	e.cursor.row = m.row
 	if e.top > e.cursor.row+1 {
 		e.top = e.cursor.row + 1
 	} else if e.top+e.PageSize() < e.cursor.row+1 {
-		e.top = e.cursor.row - e.PageSize()/2
+		e.top = max(1, e.cursor.row-e.PageSize()/2)
 	}
+	// place the cursor at the end of the matching word for easy editing
+	e.cursor.col = m.col + m.len
 }
 
 func (e *Editor) FindNext() {
@@ -712,16 +945,7 @@ func (e *Editor) FindNext() {
 	} else {
 		e.find.index++
 	}
-
-	i, j := e.find.match[e.find.index][0], e.find.match[e.find.index][1]
-	e.cursor.row = i
-	if e.top > e.cursor.row+1 {
-		e.top = e.cursor.row + 1
-	} else if e.top+e.PageSize() < e.cursor.row+1 {
-		e.top = e.cursor.row - e.PageSize()/2
-	}
-	// place the cursor at the end of the matching word for easy editing
-	e.cursor.col = j + len(e.find.key)
+	e.showMatch()
 }
 
 func (e *Editor) FindPrev() {
@@ -734,16 +958,7 @@ func (e *Editor) FindPrev() {
 	} else {
 		e.find.index--
 	}
-
-	i, j := e.find.match[e.find.index][0], e.find.match[e.find.index][1]
-	e.cursor.row = i
-	if e.top > e.cursor.row+1 {
-		e.top = e.cursor.row + 1
-	} else if e.top+e.PageSize() < e.cursor.row+1 {
-		e.top = e.cursor.row - e.PageSize()/2
-	}
-	// place the cursor at the end of the matching word for easy editing
-	e.cursor.col = j + len(e.find.key)
+	e.showMatch()
 }
 
 func (e *Editor) HandleEventKey(ev *tcell.EventKey, screen tcell.Screen) {
@@ -752,8 +967,34 @@ func (e *Editor) HandleEventKey(ev *tcell.EventKey, screen tcell.Screen) {
 			screen.ShowCursor(e.cursorX, e.cursorY)
 		}
 	}()
+	if e.snippet != nil {
+		if e.snippetKey(ev) {
+			e.Draw(screen)
+			return
+		}
+		defer e.trackSnippet(ev.Key(), e.version, len(e.buf), len(e.buf[e.cursor.row]))
+	}
+	defer e.trackSignature(ev.Key(), ev.Rune())
+	if e.readOnly {
+		switch ev.Key() {
+		case tcell.KeyRune, tcell.KeyTab, tcell.KeyEnter, tcell.KeyBackspace, tcell.KeyBackspace2,
+			tcell.KeyCtrlU, tcell.KeyCtrlK, tcell.KeyCtrlZ, tcell.KeyCtrlR:
+			message.Set(errReadOnly.Error())
+			return
+		}
+	}
 	switch ev.Key() {
 	case tcell.KeyPgUp:
+		if e.suggest != nil {
+			rows, up := e.suggestLayout()
+			if up {
+				e.moveSuggestion(rows, false)
+			} else {
+				e.moveSuggestion(-rows, false)
+			}
+			e.Draw(screen)
+			return
+		}
 		if !e.ScrollUp(e.PageSize() - 1) {
 			return
 		}
@@ -764,6 +1005,16 @@ func (e *Editor) HandleEventKey(ev *tcell.EventKey, screen tcell.Screen) {
 		Move(e, pos{row, 0}).Do()
 		e.Draw(screen)
 	case tcell.KeyPgDn:
+		if e.suggest != nil {
+			rows, up := e.suggestLayout()
+			if up {
+				e.moveSuggestion(-rows, false)
+			} else {
+				e.moveSuggestion(rows, false)
+			}
+			e.Draw(screen)
+			return
+		}
 		if e.ScrollDown(e.PageSize() - 1) {
 			return
 		}
@@ -794,18 +1045,12 @@ func (e *Editor) HandleEventKey(ev *tcell.EventKey, screen tcell.Screen) {
 			return
 		}
 
-		if e.suggest.up {
-			e.suggest.i++
+		if _, up := e.suggestLayout(); up {
+			e.moveSuggestion(1, true)
 		} else {
-			e.suggest.i--
-		}
-
-		if e.suggest.i == -1 {
-			e.suggest.i = len(e.suggest.options) - 1
-		} else if e.suggest.i == len(e.suggest.options) {
-			e.suggest.i = 0
+			e.moveSuggestion(-1, true)
 		}
-		e.showSuggestion(screen)
+		e.Draw(screen)
 	case tcell.KeyDown:
 		if e.suggest == nil {
 			if e.moveDown() {
@@ -814,38 +1059,42 @@ func (e *Editor) HandleEventKey(ev *tcell.EventKey, screen tcell.Screen) {
 			return
 		}
 
-		if !e.suggest.up {
-			e.suggest.i++
+		if _, up := e.suggestLayout(); up {
+			e.moveSuggestion(-1, true)
 		} else {
-			e.suggest.i--
-		}
-		if e.suggest.i == -1 {
-			e.suggest.i = len(e.suggest.options) - 1
-		} else if e.suggest.i == len(e.suggest.options) {
-			e.suggest.i = 0
+			e.moveSuggestion(1, true)
 		}
-		e.showSuggestion(screen)
+		e.Draw(screen)
 	case tcell.KeyLeft:
 		e.moveLeft()
 	case tcell.KeyRight:
 		e.moveRight()
 	case tcell.KeyRune:
 		if e.selection != nil {
-			e.delete(e.selection.start, e.selection.stop)
+			// replace the selection as one undo step
+			start := e.selection.start
+			e.do(
+				Delete(e, start, e.selection.stop),
+				Move(e, start),
+				Insert(e, start, string(ev.Rune())),
+				Move(e, pos{start.row, start.col + 1}),
+			)
+			e.selection = nil
+		} else {
+			e.writeRune(ev.Rune())
 		}
-		e.writeRune(ev.Rune())
-		e.drawLine(screen, e.cursor.row+1)
+		e.drawEdited(screen)
 		if e.suggest != nil {
+			e.loadSuggestion()
 			e.Draw(screen) // clear previous suggestions
-			if e.loadSuggestion() {
-				e.showSuggestion(screen)
-			}
+			return
 		}
+		e.scheduleSuggestion(ev.Rune())
 	case tcell.KeyTab:
 		// insert '\t' at the head of line
 		if e.cursor.col == 0 || e.buf[e.cursor.row][e.cursor.col-1] == '\t' {
 			e.writeRune('\t')
-			e.drawLine(screen, e.cursor.row+1)
+			e.drawEdited(screen)
 			return
 		}
 
@@ -856,13 +1105,20 @@ func (e *Editor) HandleEventKey(ev *tcell.EventKey, screen tcell.Screen) {
 			return
 		}
 
+		// expand the snippet with the prefix before cursor
+		if s, ok := findSnippet(e.lang, string(wordBefore(e.buf[e.cursor.row], e.cursor.col))); ok {
+			e.expandSnippet(s)
+			e.Draw(screen)
+			return
+		}
+
 		// on first <tab>, show suggestions
 		if e.loadSuggestion() {
 			if len(e.suggest.options) == 1 {
 				e.accecptSuggestion()
-				e.drawLine(screen, e.cursor.row+1)
+				e.drawEdited(screen)
 			} else {
-				e.showSuggestion(screen)
+				e.Draw(screen)
 			}
 		}
 	case tcell.KeyEnter:
@@ -878,23 +1134,32 @@ func (e *Editor) HandleEventKey(ev *tcell.EventKey, screen tcell.Screen) {
 			e.Draw(screen)
 			return
 		}
-		e.drawLine(screen, e.cursor.row+1)
+		e.drawEdited(screen)
 
 		if e.suggest != nil {
+			e.loadSuggestion()
 			e.Draw(screen) // clear previous suggestions
-			if e.loadSuggestion() {
-				e.showSuggestion(screen)
-			}
 		}
 	case tcell.KeyCtrlU:
 		e.delete(pos{e.cursor.row, 0}, e.cursor)
-		e.drawLine(screen, e.cursor.row+1)
+		e.drawEdited(screen)
 	case tcell.KeyCtrlK:
 		e.delete(e.cursor, pos{e.cursor.row, len(e.buf[e.cursor.row])})
-		e.drawLine(screen, e.cursor.row+1)
+		e.drawEdited(screen)
 	case tcell.KeyESC:
+		if e.completion != nil {
+			e.completion.Stop()
+		}
+		// the members being loaded do not pop up after dismissed
+		e.loading++
 		if e.suggest != nil {
 			e.suggest = nil
+			e.members = nil
+			e.Draw(screen)
+			return
+		}
+		if e.signature != nil {
+			e.signature = nil
 			e.Draw(screen)
 			return
 		}
@@ -913,89 +1178,240 @@ func (e *Editor) HandleEventKey(ev *tcell.EventKey, screen tcell.Screen) {
 }
 
 type suggestion struct {
-	x, y    int
-	options []string
-	i       int
-	up      bool // layout direction
+	x, y    int // position of the word before cursor
+	options []completionItem
+	i       int // the selected option
+	top     int // the first visible option
+}
+
+// the maximum number of options visible in the popup
+const maxVisibleOptions = 10
+
+// the number of identifier characters typed before suggestions show up
+const completionTrigger = 2
+
+// how long to wait after typing before suggestions show up
+const completionDelay = 150 * time.Millisecond
+
+// scheduleSuggestion shows suggestions after a delay, if r is typed after
+// enough identifier characters, or r is '.'. A following keystroke postpones it.
+func (e *Editor) scheduleSuggestion(r rune) {
+	if e.completion != nil {
+		e.completion.Stop()
+	}
+	line := e.buf[e.cursor.row]
+	word := wordBefore(line, e.cursor.col)
+	// the members of a selector show up from the first character
+	afterDot := e.cursor.col > len(word) && line[e.cursor.col-len(word)-1] == '.'
+	if r != '.' && !afterDot && len(word) < completionTrigger {
+		return
+	}
+	version, cursor := e.version, e.cursor
+	e.completion = time.AfterFunc(completionDelay, func() {
+		post(e.screen, func() {
+			// outdated
+			if e.version != version || e.cursor != cursor || e.suggest != nil {
+				return
+			}
+			e.loadSuggestion()
+		})
+	})
 }
 
 func (e *Editor) loadSuggestion() bool {
-	prevWord := string(getToken(e.buf[e.cursor.row], e.cursor.col-1))
+	prevWord := string(wordBefore(e.buf[e.cursor.row], e.cursor.col))
+	// members of selector are loaded in the background
+	if e.loadMembers(prevWord) {
+		return e.suggest != nil
+	}
 	if len(prevWord) == 0 {
 		e.suggest = nil
 		return false
 	}
 
-	tokens := tokenTree.get(prevWord)
-	if len(tokens) == 0 {
+	// snippets go first
+	options := e.snippetItems(prevWord)
+	for _, word := range words.suggest(e, prevWord) {
+		options = append(options, completionItem{label: word})
+	}
+	if len(options) == 0 {
 		e.suggest = nil
 		return false
 	}
-
-	// are ten options enough for most cases ?
-	max := 10
-	if len(tokens) > max {
-		tokens = tokens[:max+1]
-	}
 	e.suggest = &suggestion{
-		x:       e.cursorX - len(prevWord),
+		x:       e.cursorX - len([]rune(prevWord)),
 		y:       e.cursorY,
-		options: tokens,
+		options: options,
 	}
 	return true
 }
 
+// suggestLayout returns the number of visible options, and whether they are
+// listed upward from the cursor, when there is no room below.
+func (e *Editor) suggestLayout() (rows int, up bool) {
+	rows = min(len(e.suggest.options), maxVisibleOptions)
+	below, above := e.by2-e.suggest.y, e.suggest.y-e.by1
+	switch {
+	case below >= rows:
+		return rows, false
+	case above >= rows:
+		return rows, true
+	case below >= above:
+		return below, false
+	default:
+		return above, true
+	}
+}
+
+// optionY returns the screen row of the visible option i
+func (e *Editor) optionY(i int) int {
+	if _, up := e.suggestLayout(); up {
+		return e.suggest.y - 1 - (i - e.suggest.top)
+	}
+	return e.suggest.y + 1 + (i - e.suggest.top)
+}
+
+// return the width of the popup
+func (e *Editor) optionWidth() int {
+	width := optionWidth
+	for _, option := range e.suggest.options {
+		width = max(width, len([]rune(option.String()))+1)
+	}
+	return min(width, e.bx2-e.suggest.x+1)
+}
+
+// moveSuggestion selects the option n after the current one, n may be negative.
+// It wraps around at both ends if wrap is true, or stops there otherwise.
+func (e *Editor) moveSuggestion(n int, wrap bool) {
+	s := e.suggest
+	i := s.i + n
+	if wrap {
+		i = (i%len(s.options) + len(s.options)) % len(s.options)
+	} else {
+		i = max(0, min(i, len(s.options)-1))
+	}
+	s.i = i
+	// keep the selected option visible
+	rows, _ := e.suggestLayout()
+	if i < s.top {
+		s.top = i
+	} else if i >= s.top+rows {
+		s.top = i - rows + 1
+	}
+}
+
+// suggestionAt returns the option at the screen position
+func (e *Editor) suggestionAt(x, y int) (int, bool) {
+	if x < e.suggest.x || x >= e.suggest.x+e.optionWidth() {
+		return 0, false
+	}
+	rows, _ := e.suggestLayout()
+	for i := e.suggest.top; i < e.suggest.top+rows && i < len(e.suggest.options); i++ {
+		if e.optionY(i) == y {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
 func (e *Editor) showSuggestion(screen tcell.Screen) {
 	if len(e.suggest.options) == 0 {
 		return
 	}
-	optionY := func(i int) int {
-		var yy int
-		if e.by2-e.suggest.y >= len(e.suggest.options) {
-			yy = e.suggest.y + 1 + i // list down
-		} else {
-			e.suggest.up = true
-			yy = e.suggest.y - 1 - i // list up
-		}
-		return yy
-	}
-	for i := range e.suggest.options {
-		style := tcell.StyleDefault.Background(tcell.ColorLightGray).Foreground(tcell.ColorBlack)
+	width := e.optionWidth()
+	rows, _ := e.suggestLayout()
+	for i := e.suggest.top; i < e.suggest.top+rows && i < len(e.suggest.options); i++ {
+		style := theme.bar
 		if i == e.suggest.i {
-			style = style.Background(tcell.ColorLightBlue)
-		}
-		oy := optionY(i)
-		for j, c := range e.suggest.options[i] {
-			screen.SetContent(e.suggest.x+j, oy, c, nil, style)
+			style = style.Background(theme.barSelected)
 		}
-		for padding := optionWidth - len(e.suggest.options[i]); padding > 0; padding-- {
-			screen.SetContent(e.suggest.x+optionWidth-padding, oy, ' ', nil, style)
+		drawPopupRow(screen, e.suggest.x, e.optionY(i), width, []rune(e.suggest.options[i].String()), style)
+	}
+	e.showDoc(screen, width)
+}
+
+// the maximum size of the documentation pane
+const (
+	docWidth = 60
+	docLines = 12
+)
+
+// showDoc draws the signature and doc comment of the selected option
+// beside the popup, on the right if there is room, otherwise on the left.
+func (e *Editor) showDoc(screen tcell.Screen, popupWidth int) {
+	item := e.suggest.options[e.suggest.i]
+	if item.signature() == "" && item.doc == "" {
+		return
+	}
+	const minWidth = 20
+	x := e.suggest.x + popupWidth
+	width := min(docWidth, e.bx2-x+1)
+	if width < minWidth {
+		width = min(docWidth, e.suggest.x-e.bx1)
+		x = e.suggest.x - width
+	}
+	if width < minWidth {
+		return
+	}
+
+	// one column of padding on both sides
+	lines := wrapText(item.signature(), width-2)
+	if item.doc != "" {
+		lines = append(lines, "")
+		lines = append(lines, wrapText(item.doc, width-2)...)
+	}
+	_, up := e.suggestLayout()
+	height := min(len(lines), docLines)
+	if up {
+		height = min(height, e.suggest.y-e.by1)
+	} else {
+		height = min(height, e.by2-e.suggest.y)
+	}
+	for i := 0; i < height; i++ {
+		y := e.suggest.y + 1 + i
+		if up {
+			y = e.suggest.y - height + i
 		}
+		drawPopupRow(screen, x, y, width, []rune(" "+lines[i]), theme.doc)
 	}
 }
 
+// accecptSuggestion replaces the word before cursor with the selected option
 func (e *Editor) accecptSuggestion() {
-	word := string(getToken(e.buf[e.cursor.row], e.cursor.col))
-	// TODO: this is a replacement, use e.do()
-	e.buf[e.cursor.row] = e.buf[e.cursor.row][:e.cursor.col-len(word)]
-	e.cursor.col = -len(word)
-	e.syncCursor()
-	e.writeString(e.suggest.options[e.suggest.i])
+	word := wordBefore(e.buf[e.cursor.row], e.cursor.col)
+	start := pos{e.cursor.row, e.cursor.col - len(word)}
+	item := e.suggest.options[e.suggest.i]
+	if s, ok := findSnippet(e.lang, item.label); ok && item.kind == "snippet" {
+		e.suggest = nil
+		e.members = nil
+		e.expandSnippet(s)
+		return
+	}
+	label := item.label
+	e.do(
+		Delete(e, start, e.cursor),
+		Insert(e, start, label),
+		Move(e, pos{start.row, start.col + len([]rune(label))}),
+	)
+	words.accept(label)
 	e.suggest = nil
+	e.members = nil
 }
 
+// ClearFind clears the matches, the search starts from the same line next time
 func (e *Editor) ClearFind() {
-	e.find = find{}
+	e.find = find{line: e.find.line}
 }
 
 type lineBar struct {
 	BaseView
 	top    int
 	bottom int
+	marks  map[int]tcell.Style // the markers of lines with diagnostics
 }
 
 func (b *lineBar) Draw(screen tcell.Screen) {
-	style := tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorGray)
+	style := tcell.StyleDefault.Background(tcell.ColorReset).Foreground(theme.lineNumber)
 	for i := 0; i < b.height; i++ {
 		for j := 0; j < b.width; j++ {
 			screen.SetContent(b.x+j, b.y+i, ' ', nil, style)
@@ -1012,33 +1428,44 @@ func (b *lineBar) Draw(screen tcell.Screen) {
 			// align right
 			screen.SetContent(b.x+b.width-1-(len(s)-j)-paddingRight, b.y+i-b.top, c, nil, style)
 		}
+		if mark, ok := b.marks[i]; ok {
+			screen.SetContent(b.x, b.y+i-b.top, '●', nil, mark)
+		}
 	}
 }
 
-func buildTokenTree(tree *node, buf [][]rune) {
-	if tree == nil || len(buf) == 0 {
-		return
-	}
-	for i := range buf {
-		infos := parseToken(buf[i])
-		for _, info := range infos {
-			t := string(buf[i][info.off : info.off+info.len])
-			if token.IsKeyword(t) || token.IsIdentifier(t) {
-				tree.set(t)
-			}
-		}
+// changed is called after the buffer changes
+// editing is called before n rows from the row are edited, lines reports
+// whether lines are added or removed, so that the lexer states and
+// the words of the rows are updated.
+func (e *Editor) editing(row, n int, lines bool) {
+	if lines {
+		e.lexStates.truncate(row)
+	} else {
+		e.lexStates.invalidate(row)
 	}
+	e.edits.add(e.buf, row, n)
+}
+
+func (e *Editor) changed() {
+	e.dirty = true
+	e.version++
+	e.scheduleAnalysis()
 }
 
 func (e *Editor) do(a ...Action) {
 	if len(a) == 0 {
 		return
 	}
+	if e.readOnly {
+		message.Set(errReadOnly.Error())
+		return
+	}
 	action := group(a)
 	action.Do()
 	e.history = append(e.history, action)
 	e.historyUndo = nil
-	e.dirty = true
+	e.changed()
 }
 
 func (e *Editor) undo() {
@@ -1049,7 +1476,7 @@ func (e *Editor) undo() {
 	act.Undo()
 	e.history = e.history[:len(e.history)-1]
 	e.historyUndo = append(e.historyUndo, act)
-	e.dirty = true
+	e.changed()
 }
 
 func (e *Editor) redo() {
@@ -1060,7 +1487,7 @@ func (e *Editor) redo() {
 	act.Do()
 	e.historyUndo = e.historyUndo[:len(e.historyUndo)-1]
 	e.history = append(e.history, act)
-	e.dirty = true
+	e.changed()
 }
 
 // Action represents a buffer change or cursor movement, or both.
@@ -1086,11 +1513,54 @@ func Insert(e *Editor, p pos, str string) insertion {
 }
 
 func (i insertion) Do() {
+	i.e.editing(i.pos.row, 1, false)
 	i.e.buf[i.pos.row] = slices.Insert(i.e.buf[i.pos.row], i.pos.col, []rune(i.str)...)
 }
 
 func (i insertion) Undo() {
-	i.e.buf[i.pos.row] = slices.Delete(i.e.buf[i.pos.row], i.pos.col, i.pos.col+len(i.str))
+	i.e.editing(i.pos.row, 1, false)
+	i.e.buf[i.pos.row] = slices.Delete(i.e.buf[i.pos.row], i.pos.col, i.pos.col+len([]rune(i.str)))
+}
+
+// insertion of text spanning lines
+type textInsertion struct {
+	e     *Editor
+	pos   pos
+	lines [][]rune
+}
+
+// InsertText inserts the text which may have newlines
+func InsertText(e *Editor, p pos, text string) Action {
+	if !strings.Contains(text, "\n") {
+		return Insert(e, p, text)
+	}
+	var lines [][]rune
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, []rune(line))
+	}
+	return textInsertion{e: e, pos: p, lines: lines}
+}
+
+func (t textInsertion) Do() {
+	line := t.e.buf[t.pos.row]
+	n := len(t.lines)
+	rows := make([][]rune, n)
+	rows[0] = append(slices.Clone(line[:t.pos.col]), t.lines[0]...)
+	for i := 1; i < n-1; i++ {
+		rows[i] = slices.Clone(t.lines[i])
+	}
+	rows[n-1] = append(slices.Clone(t.lines[n-1]), line[t.pos.col:]...)
+	t.e.editing(t.pos.row, 1, true)
+	t.e.buf = slices.Replace(t.e.buf, t.pos.row, t.pos.row+1, rows...)
+}
+
+func (t textInsertion) Undo() {
+	n := len(t.lines)
+	head := t.e.buf[t.pos.row][:t.pos.col]
+	tail := t.e.buf[t.pos.row+n-1][len(t.lines[n-1]):]
+	line := append(slices.Clone(head), tail...)
+	t.e.editing(t.pos.row, n, true)
+	t.e.buf = slices.Replace(t.e.buf, t.pos.row, t.pos.row+n, line)
 }
 
 type deletion struct {
@@ -1110,10 +1580,12 @@ func Delete(e *Editor, start, stop pos) deletion {
 }
 
 func (d deletion) Do() {
+	d.e.editing(d.start.row, 1, false)
 	d.e.buf[d.start.row] = slices.Delete(d.e.buf[d.start.row], d.start.col, d.stop.col)
 }
 
 func (d deletion) Undo() {
+	d.e.editing(d.start.row, 1, false)
 	d.e.buf[d.start.row] = slices.Insert(d.e.buf[d.start.row], d.start.col, []rune(d.str)...)
 }
 
@@ -1151,7 +1623,7 @@ func (g group) Do() {
 }
 
 func (g group) Undo() {
-	for _, act := range g {
-		act.Undo()
+	for i := len(g) - 1; i >= 0; i-- {
+		g[i].Undo()
 	}
 }
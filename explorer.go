@@ -0,0 +1,503 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// explorer is the tree of the project files in the sidebar, before the editor
+// groups. It hides .git and the ignored paths, as the goto bar does.
+// It is hidden when its width is 0.
+type explorer struct {
+	BaseView
+	root  *treeNode
+	rows  []*treeNode // the visible nodes in order
+	index int         // the selected row
+	top   int         // the first visible row
+	// open is called to open the file, in a new group if split is true
+	open func(path string, split bool)
+}
+
+// treeNode is a file or directory of the explorer
+type treeNode struct {
+	path     string // relative to the working directory
+	dir      bool
+	expanded bool
+	depth    int
+	parent   *treeNode
+	children []*treeNode  // loaded when expanded
+	rules    []ignoreRule // the rules of its entries, for a directory
+}
+
+// the width of the explorer, including the border
+const explorerWidth = 30
+
+func newExplorer(root string) *explorer {
+	x := &explorer{root: &treeNode{path: root, dir: true, depth: -1}}
+	x.fixedSize = true
+	return x
+}
+
+func (n *treeNode) name() string { return filepath.Base(n.path) }
+
+func (x *explorer) Visible() bool { return x.width > 0 }
+
+// show reloads the tree and widens the sidebar
+func (x *explorer) show() {
+	x.width = explorerWidth
+	x.refresh()
+}
+
+// hide collapses the sidebar
+func (x *explorer) hide() {
+	x.width = 0
+}
+
+// load reads the entries of the directory, keeping the expanded ones expanded
+func (x *explorer) load(n *treeNode) error {
+	entries, err := os.ReadDir(n.path)
+	if err != nil {
+		return err
+	}
+	base := excludeRules(x.root.path)
+	if n.parent != nil {
+		base = n.parent.rules
+	}
+	n.rules = dirRules(n.path, base)
+	old := make(map[string]*treeNode)
+	for _, c := range n.children {
+		old[c.path] = c
+	}
+	n.children = n.children[:0]
+	for _, entry := range entries {
+		path := filepath.Join(n.path, entry.Name())
+		dir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if info, err := os.Stat(path); err == nil {
+				dir = info.IsDir()
+			}
+		}
+		if entry.Name() == ".git" || ignored(n.rules, path, dir) {
+			continue
+		}
+		c, ok := old[path]
+		if !ok || c.dir != dir {
+			c = &treeNode{path: path, dir: dir, depth: n.depth + 1, parent: n}
+		}
+		n.children = append(n.children, c)
+	}
+	// the directories first
+	slices.SortFunc(n.children, func(a, b *treeNode) int {
+		if a.dir != b.dir {
+			if a.dir {
+				return -1
+			}
+			return 1
+		}
+		if c := cmp.Compare(strings.ToLower(a.name()), strings.ToLower(b.name())); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.name(), b.name())
+	})
+	return nil
+}
+
+// refresh reloads the expanded directories, keeping the selection
+func (x *explorer) refresh() {
+	var reload func(n *treeNode)
+	reload = func(n *treeNode) {
+		if err := x.load(n); err != nil {
+			n.expanded = false
+			n.children = nil
+			return
+		}
+		for _, c := range n.children {
+			if c.expanded {
+				reload(c)
+			}
+		}
+	}
+	x.root.expanded = true
+	reload(x.root)
+	x.flatten()
+}
+
+// flatten lists the visible nodes, keeping the selected path selected
+func (x *explorer) flatten() {
+	var selected string
+	if n := x.selected(); n != nil {
+		selected = n.path
+	}
+	x.rows = x.rows[:0]
+	var walk func(n *treeNode)
+	walk = func(n *treeNode) {
+		for _, c := range n.children {
+			x.rows = append(x.rows, c)
+			if c.dir && c.expanded {
+				walk(c)
+			}
+		}
+	}
+	walk(x.root)
+	x.index = max(0, min(x.index, len(x.rows)-1))
+	if i := slices.IndexFunc(x.rows, func(n *treeNode) bool { return n.path == selected }); i >= 0 {
+		x.index = i
+	}
+	x.scrollTo(x.index)
+}
+
+// selected returns the selected node, or nil if the tree is empty
+func (x *explorer) selected() *treeNode {
+	if x.index < len(x.rows) {
+		return x.rows[x.index]
+	}
+	return nil
+}
+
+// the number of visible rows, below the title and above the keymap
+func (x *explorer) visibleRows() int { return max(0, x.height-2) }
+
+// move selects the row n after the current one, n may be negative
+func (x *explorer) move(n int) {
+	if len(x.rows) == 0 {
+		return
+	}
+	x.index = max(0, min(x.index+n, len(x.rows)-1))
+	x.scrollTo(x.index)
+}
+
+// scrollTo makes the row visible
+func (x *explorer) scrollTo(i int) {
+	if i < x.top {
+		x.top = i
+	} else if rows := x.visibleRows(); rows > 0 && i >= x.top+rows {
+		x.top = i - rows + 1
+	}
+	x.top = max(0, min(x.top, len(x.rows)-x.visibleRows()))
+}
+
+// expand shows the entries of the directory
+func (x *explorer) expand(n *treeNode) {
+	if err := x.load(n); err != nil {
+		message.Set(err.Error())
+		return
+	}
+	n.expanded = true
+	x.flatten()
+}
+
+// collapse hides the entries of the directory
+func (x *explorer) collapse(n *treeNode) {
+	n.expanded = false
+	x.flatten()
+}
+
+// activate toggles the selected directory, or opens the selected file
+func (x *explorer) activate(split bool) {
+	n := x.selected()
+	switch {
+	case n == nil:
+	case !n.dir:
+		if x.open != nil {
+			x.open(n.path, split)
+		}
+	case n.expanded:
+		x.collapse(n)
+	default:
+		x.expand(n)
+	}
+}
+
+// left collapses the selected directory, or selects its parent
+func (x *explorer) left() {
+	n := x.selected()
+	if n == nil {
+		return
+	}
+	if n.dir && n.expanded {
+		x.collapse(n)
+		return
+	}
+	if i := slices.Index(x.rows, n.parent); i >= 0 {
+		x.index = i
+		x.scrollTo(i)
+	}
+}
+
+// reveal expands the parents of the file and selects it,
+// it reports whether the file is in the tree.
+func (x *explorer) reveal(filename string) bool {
+	if filename == "" {
+		return false
+	}
+	rel, err := filepath.Rel(absName(x.root.path), absName(filename))
+	if err != nil || !filepath.IsLocal(rel) {
+		return false
+	}
+	n := x.root
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i := range parts {
+		path := filepath.Join(x.root.path, filepath.Join(parts[:i+1]...))
+		if !n.expanded || n.children == nil {
+			if err := x.load(n); err != nil {
+				return false
+			}
+			n.expanded = true
+		}
+		j := slices.IndexFunc(n.children, func(c *treeNode) bool { return c.path == path })
+		if j < 0 {
+			x.flatten()
+			return false
+		}
+		n = n.children[j]
+	}
+	x.flatten()
+	x.index = slices.Index(x.rows, n)
+	x.scrollTo(x.index)
+	return true
+}
+
+func (x *explorer) Draw(screen tcell.Screen) {
+	if x.width == 0 {
+		return
+	}
+	// the border between the explorer and the editors
+	width := x.width - 1
+	style := tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorReset)
+	for y := x.y; y < x.y+x.height; y++ {
+		screen.SetContent(x.x+width, y, '│', nil, style.Foreground(theme.lineNumber))
+	}
+	title := []rune(" " + filepath.Base(absName(x.root.path)))
+	drawPopupRow(screen, x.x, x.y, width, title, theme.bar.Bold(true))
+
+	for i := 0; i < x.visibleRows(); i++ {
+		j := x.top + i
+		var text []rune
+		s := style
+		if j < len(x.rows) {
+			n := x.rows[j]
+			icon := "  "
+			if n.dir && n.expanded {
+				icon = "▾ "
+			} else if n.dir {
+				icon = "▸ "
+			}
+			text = []rune(strings.Repeat("  ", n.depth) + icon + n.name())
+			if len(text) > width {
+				text = append(text[:width-1], '…')
+			}
+			if j == x.index {
+				s = style.Background(theme.selection)
+			}
+		}
+		drawPopupRow(screen, x.x, x.y+1+i, width, text, s)
+	}
+	if x.height > 1 {
+		keymap := []rune(" n/N new r rename d delete c copy")
+		drawPopupRow(screen, x.x, x.y+x.height-1, width, keymap, theme.bar.Foreground(theme.barHint))
+	}
+	x.cursorX, x.cursorY = x.x, x.y+1+x.index-x.top
+	if x.Focused() {
+		screen.ShowCursor(x.cursorX, x.cursorY)
+	}
+}
+
+// Click selects the clicked row, toggling a directory or opening a file
+func (x *explorer) Click(x1, y int) {
+	i := x.top + y - x.y - 1
+	if y == x.y || y == x.y+x.height-1 || i >= len(x.rows) {
+		return
+	}
+	x.index = i
+	x.activate(false)
+}
+
+func (x *explorer) ScrollUp(delta int) bool {
+	if x.top == 0 {
+		return false
+	}
+	x.top = max(0, x.top-delta)
+	return true
+}
+
+func (x *explorer) ScrollDown(delta int) bool {
+	last := max(0, len(x.rows)-x.visibleRows())
+	if x.top >= last {
+		return false
+	}
+	x.top = min(last, x.top+delta)
+	return true
+}
+
+// targetDir returns the directory for a new entry, the selected one or the parent of the selected file
+func (x *explorer) targetDir() string {
+	n := x.selected()
+	if n == nil {
+		return x.root.path
+	}
+	if n.dir {
+		return n.path
+	}
+	return n.parent.path
+}
+
+// created shows the new path in the tree
+func (x *explorer) created(path string) {
+	x.refresh()
+	x.reveal(path)
+}
+
+// inPath reports whether the file is the path, or in the directory of the path
+func inPath(path, filename string) bool {
+	rel, err := filepath.Rel(absName(path), absName(filename))
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// createFile creates the empty file, and its missing parent directories.
+// It fails if the file exists.
+func createFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// createDir creates the directory, and its missing parents. It fails if the path exists.
+func createDir(path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+// renamePath moves the file or directory, it fails if the new path exists
+func renamePath(old, new string) error {
+	if _, err := os.Lstat(new); err == nil {
+		return fmt.Errorf("%s already exists", new)
+	}
+	if err := os.MkdirAll(filepath.Dir(new), 0755); err != nil {
+		return err
+	}
+	return os.Rename(old, new)
+}
+
+// checkName reports an error if the new name of a file is not a name in its directory,
+// such as "a/b" or "..", which would move the file elsewhere.
+func checkName(name string) error {
+	if name == "." || name == ".." || strings.ContainsAny(name, "/"+string(filepath.Separator)) {
+		return fmt.Errorf("%s is not a file name", name)
+	}
+	return nil
+}
+
+// copyName returns a name for the copy of the path not taken, such as "a copy.go"
+func copyName(path string) string {
+	dir, name := filepath.Split(path)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if ext == name {
+		// a dotfile such as .gitignore
+		stem, ext = name, ""
+	}
+	for i := 1; ; i++ {
+		suffix := " copy"
+		if i > 1 {
+			suffix = fmt.Sprintf(" copy %d", i)
+		}
+		p := filepath.Join(dir, stem+suffix+ext)
+		if _, err := os.Lstat(p); errors.Is(err, fs.ErrNotExist) {
+			return p
+		}
+	}
+}
+
+// duplicatePath copies the file or directory to the new path, it fails if the new path exists
+// or is inside the directory, which would be copied into itself.
+func duplicatePath(old, new string) error {
+	if _, err := os.Lstat(new); err == nil {
+		return fmt.Errorf("%s already exists", new)
+	}
+	if inPath(old, new) {
+		return fmt.Errorf("can not copy %s into itself", old)
+	}
+	return filepath.WalkDir(old, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(old, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(new, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// promptBar asks for a name, or a confirmation, for a file operation of the explorer
+type promptBar struct {
+	BaseView
+	label   string
+	input   []rune
+	confirm bool // answered with y or n, instead of the input
+	// done is called with the input on enter, or on y when confirming
+	done func(input string) error
+}
+
+func (b *promptBar) Draw(screen tcell.Screen) {
+	text := []rune(" " + b.label + " ")
+	if b.confirm {
+		text = append(text, []rune("(y/n) ")...)
+	}
+	text = append(text, b.input...)
+	drawPopupRow(screen, b.x, b.y, b.width, text, theme.prompt)
+	b.cursorX, b.cursorY = b.x+min(len(text), b.width-1), b.y
+	if b.Focused() {
+		screen.ShowCursor(b.cursorX, b.cursorY)
+	}
+}
+
+func (b *promptBar) FixedSize() bool { return true }
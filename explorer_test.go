@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// rowPaths returns the paths of the visible rows
+func rowPaths(x *explorer) []string {
+	var paths []string
+	for _, n := range x.rows {
+		paths = append(paths, n.path)
+	}
+	return paths
+}
+
+func TestExplorer(t *testing.T) {
+	writeModule(t, t.TempDir(), map[string]string{
+		".gitignore":    "ignored/\n",
+		".git/HEAD":     "",
+		"B.go":          "",
+		"a.go":          "",
+		"ignored/x.go":  "",
+		"sub/b.go":      "",
+		"sub/deep/c.go": "",
+	})
+	x := newExplorer(".")
+	x.SetPos(0, 0, explorerWidth, 20)
+	x.show()
+	if got, want := rowPaths(x), []string{"sub", ".gitignore", "a.go", "B.go"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("rows = %q, want %q", got, want)
+	}
+
+	x.activate(false)
+	if got, want := rowPaths(x), []string{"sub", "sub/deep", "sub/b.go", ".gitignore", "a.go", "B.go"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after expanding: rows = %q, want %q", got, want)
+	}
+	x.activate(false)
+	if len(x.rows) != 4 {
+		t.Fatalf("after collapsing: rows = %q", rowPaths(x))
+	}
+
+	if !x.reveal(filepath.Join("sub", "deep", "c.go")) {
+		t.Fatal("reveal sub/deep/c.go failed")
+	}
+	if n := x.selected(); n.path != "sub/deep/c.go" {
+		t.Fatalf("revealed %s", n.path)
+	}
+	x.left()
+	if n := x.selected(); n.path != "sub/deep" {
+		t.Errorf("left selects %s, want the parent", n.path)
+	}
+	if x.reveal(filepath.Join("ignored", "x.go")) {
+		t.Error("revealed an ignored file")
+	}
+
+	// the tree follows the changes on disk, keeping the expanded directories
+	if err := os.WriteFile(filepath.Join("sub", "new.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	x.refresh()
+	if got, want := rowPaths(x), []string{"sub", "sub/deep", "sub/deep/c.go", "sub/b.go", "sub/new.go", ".gitignore", "a.go", "B.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after refresh: rows = %q, want %q", got, want)
+	}
+}
+
+func TestFileOperations(t *testing.T) {
+	writeModule(t, t.TempDir(), map[string]string{
+		"a.go":     "package a\n",
+		"dir/b.go": "package b\n",
+	})
+	if err := createFile("a.go"); err == nil {
+		t.Error("createFile of an existing file is not an error")
+	}
+	if err := createFile(filepath.Join("new", "c.go")); err != nil {
+		t.Error(err)
+	}
+	if err := createDir("dir"); err == nil {
+		t.Error("createDir of an existing directory is not an error")
+	}
+	if err := renamePath("a.go", filepath.Join("dir", "b.go")); err == nil {
+		t.Error("renamePath over an existing file is not an error")
+	}
+
+	if err := duplicatePath("dir", filepath.Join("dir", "inner")); err == nil {
+		t.Error("duplicatePath into itself is not an error")
+	}
+	if _, err := os.Lstat(filepath.Join("dir", "inner")); err == nil {
+		t.Error("duplicatePath into itself created the copy")
+	}
+
+	for _, name := range []string{".", "..", "../a.go", filepath.Join("dir", "c.go")} {
+		if err := checkName(name); err == nil {
+			t.Errorf("checkName(%q) is not an error", name)
+		}
+	}
+	for _, name := range []string{"c.go", ".gitignore", "a..b"} {
+		if err := checkName(name); err != nil {
+			t.Errorf("checkName(%q) = %v", name, err)
+		}
+	}
+
+	if got := copyName("a.go"); got != "a copy.go" {
+		t.Errorf("copyName = %s, want a copy.go", got)
+	}
+	if err := duplicatePath("dir", copyName("dir")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join("dir copy", "b.go")); err != nil || string(b) != "package b\n" {
+		t.Errorf("the copy of dir/b.go: %q, %v", b, err)
+	}
+	if got := copyName("dir"); got != "dir copy 2" {
+		t.Errorf("copyName of a copied directory = %s, want dir copy 2", got)
+	}
+}
+
+func TestGroupRenameAndClose(t *testing.T) {
+	writeModule(t, t.TempDir(), map[string]string{
+		"a.txt":     "a\n",
+		"dir/b.txt": "b\n",
+	})
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	g := NewEditorGroup(screen, BindStr("", nil))
+	g.SetPos(0, 0, 80, 24)
+	g.Open("a.txt")
+	g.Open(filepath.Join("dir", "b.txt"))
+
+	g.renameFile("dir", "other")
+	b := g.editor
+	if want := filepath.Join("other", "b.txt"); b.filename != want || g.titleBar.names[1] != want {
+		t.Errorf("after renaming the directory: %s, tab %s, want %s", b.filename, g.titleBar.names[1], want)
+	}
+
+	g.closeFile(g.all[0])
+	if g.editor != b || len(g.all) != 1 || !reflect.DeepEqual(g.titleBar.names, []string{b.filename}) {
+		t.Errorf("after closing a.txt: showing %s, tabs %q", g.editor.filename, g.titleBar.names)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// how often the file index checks the directories for changes,
+// doubled up to maxIndexInterval while nothing changes
+const (
+	indexInterval    = 2 * time.Second
+	maxIndexInterval = 32 * time.Second
+)
+
+// fileIndex lists the files under the root in the background, skipping the
+// ignored ones. Creating, deleting or renaming a file changes the modification
+// time of its directory, so the index rescans the directories changed since
+// the last scan, instead of the whole tree.
+type fileIndex struct {
+	root string
+
+	// the scanned directories by path, only accessed by the scanning goroutine
+	dirs map[string]*indexDir
+	// the files found by the first scan since the last publish
+	found []string
+	// wakes the scanning goroutine to check for changes now
+	wake chan struct{}
+
+	mu    sync.Mutex
+	files []string // sorted, replaced as a whole on change
+	ready bool     // the first scan is finished
+}
+
+// indexDir is a scanned directory
+type indexDir struct {
+	mtime   time.Time
+	ignore  time.Time    // the modification time of its .gitignore
+	rules   []ignoreRule // the rules of its entries
+	files   []string     // the paths of its files
+	subdirs []string     // the paths of its directories not ignored
+}
+
+func newFileIndex(root string) *fileIndex {
+	return &fileIndex{root: root, dirs: make(map[string]*indexDir), wake: make(chan struct{}, 1)}
+}
+
+// check asks the index to check for changes now, rather than after the interval
+func (x *fileIndex) check() {
+	select {
+	case x.wake <- struct{}{}:
+	default:
+	}
+}
+
+// list returns the files found so far, and whether the first scan is finished.
+// The slice must not be modified.
+func (x *fileIndex) list() ([]string, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.files, x.ready
+}
+
+// run scans the tree, and then checks it for changes until ctx is done.
+// It calls changed after the list changes, from the scanning goroutine.
+func (x *fileIndex) run(ctx context.Context, changed func()) {
+	last := time.Now()
+	err := x.scan(ctx, x.root, excludeRules(x.root), func(path string) {
+		x.found = append(x.found, path)
+		// publish the partial list of a large tree
+		if time.Since(last) > 200*time.Millisecond {
+			last = time.Now()
+			x.merge(false)
+			changed()
+		}
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Print(err)
+		}
+		return
+	}
+	x.merge(true)
+	changed()
+
+	interval := indexInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-x.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+		}
+		if x.refresh(ctx) {
+			x.publish(true)
+			changed()
+			interval = indexInterval
+		} else {
+			interval = min(2*interval, maxIndexInterval)
+		}
+		timer.Reset(interval)
+	}
+}
+
+// scan walks the tree of the directory with the rules of its parents,
+// and calls found with every file.
+func (x *fileIndex) scan(ctx context.Context, root string, base []ignoreRule, found func(string)) error {
+	return walkTree(ctx, root, base, func(path string, rules []ignoreRule) {
+		d := &indexDir{rules: rules}
+		if info, err := os.Stat(path); err == nil {
+			d.mtime = info.ModTime()
+		}
+		if info, err := os.Stat(filepath.Join(path, ".gitignore")); err == nil {
+			d.ignore = info.ModTime()
+		}
+		x.dirs[path] = d
+		if parent, ok := x.dirs[filepath.Dir(path)]; ok && path != root {
+			parent.subdirs = append(parent.subdirs, path)
+		}
+	}, func(path string) error {
+		d := x.dirs[filepath.Dir(path)]
+		d.files = append(d.files, path)
+		if found != nil {
+			found(path)
+		}
+		return nil
+	})
+}
+
+// refresh rescans the changed directories, and reports whether any file is
+// created or deleted. A directory with a changed .gitignore is rescanned with
+// its subdirectories, otherwise only its entries.
+func (x *fileIndex) refresh(ctx context.Context) bool {
+	var changed bool
+	paths := make([]string, 0, len(x.dirs))
+	for path := range x.dirs {
+		paths = append(paths, path)
+	}
+	// the parents first
+	slices.Sort(paths)
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return changed
+		}
+		d, ok := x.dirs[path]
+		if !ok {
+			// removed with its parent
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			x.remove(path)
+			changed = true
+			continue
+		}
+		var ignore time.Time
+		if info, err := os.Stat(filepath.Join(path, ".gitignore")); err == nil {
+			ignore = info.ModTime()
+		}
+		if info.ModTime().Equal(d.mtime) && ignore.Equal(d.ignore) {
+			continue
+		}
+		changed = true
+		base := excludeRules(x.root)
+		if parent, ok := x.dirs[filepath.Dir(path)]; ok && path != x.root {
+			base = parent.rules
+		}
+		if !ignore.Equal(d.ignore) {
+			x.remove(path)
+			if err := x.scan(ctx, path, base, nil); err != nil {
+				return changed
+			}
+			if parent, ok := x.dirs[filepath.Dir(path)]; ok && path != x.root {
+				parent.subdirs = append(parent.subdirs, path)
+			}
+			continue
+		}
+		x.rescanEntries(ctx, path, d)
+	}
+	return changed
+}
+
+// rescanEntries updates the files of the directory, and scans the new subdirectories
+func (x *fileIndex) rescanEntries(ctx context.Context, path string, d *indexDir) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return
+	}
+	if info, err := os.Stat(path); err == nil {
+		d.mtime = info.ModTime()
+	}
+	d.files = d.files[:0]
+	var subdirs []string
+	for _, entry := range entries {
+		p := filepath.Join(path, entry.Name())
+		if entry.Name() == ".git" || ignored(d.rules, p, entry.IsDir()) {
+			continue
+		}
+		if entry.IsDir() {
+			subdirs = append(subdirs, p)
+			if _, ok := x.dirs[p]; !ok {
+				x.scan(ctx, p, d.rules, nil)
+			}
+		} else if entry.Type().IsRegular() {
+			d.files = append(d.files, p)
+		}
+	}
+	for _, sub := range d.subdirs {
+		if !slices.Contains(subdirs, sub) {
+			x.drop(sub)
+		}
+	}
+	d.subdirs = subdirs
+}
+
+// remove drops the directory and its subdirectories
+func (x *fileIndex) remove(path string) {
+	x.drop(path)
+	if parent, ok := x.dirs[filepath.Dir(path)]; ok && path != x.root {
+		parent.subdirs = slices.DeleteFunc(parent.subdirs, func(s string) bool { return s == path })
+	}
+}
+
+// drop drops the directory and its subdirectories, leaving its parent as is
+func (x *fileIndex) drop(path string) {
+	if d, ok := x.dirs[path]; ok {
+		for _, sub := range d.subdirs {
+			x.drop(sub)
+		}
+		delete(x.dirs, path)
+	}
+}
+
+// merge adds the files found since the last publish to the list,
+// without sorting the files published before again.
+func (x *fileIndex) merge(ready bool) {
+	slices.Sort(x.found)
+	// only written by the scanning goroutine, so it is read without the lock
+	old := x.files
+	files := make([]string, 0, len(old)+len(x.found))
+	i, j := 0, 0
+	for i < len(old) && j < len(x.found) {
+		if old[i] < x.found[j] {
+			files = append(files, old[i])
+			i++
+		} else {
+			files = append(files, x.found[j])
+			j++
+		}
+	}
+	files = append(files, old[i:]...)
+	files = append(files, x.found[j:]...)
+	x.found = x.found[:0]
+	x.mu.Lock()
+	x.files = files
+	x.ready = x.ready || ready
+	x.mu.Unlock()
+}
+
+// publish replaces the list with the files of the scanned directories,
+// after a refresh changes them.
+func (x *fileIndex) publish(ready bool) {
+	var files []string
+	for _, d := range x.dirs {
+		files = append(files, d.files...)
+	}
+	slices.Sort(files)
+	x.mu.Lock()
+	x.files = files
+	x.ready = x.ready || ready
+	x.mu.Unlock()
+}
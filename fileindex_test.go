@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFileIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{
+		".gitignore":              "*.log\n",
+		"a.go":                    "",
+		"a.log":                   "",
+		"sub/b.go":                "",
+		"sub/deep/c.go":           "",
+		"node_modules/x/index.js": "",
+		"sub/node_modules/y/y.js": "",
+	})
+	x := newFileIndex(".")
+	ctx := context.Background()
+	if err := x.scan(ctx, ".", excludeRules("."), nil); err != nil {
+		t.Fatal(err)
+	}
+	x.publish(true)
+	check := func(want ...string) {
+		t.Helper()
+		for i := range want {
+			want[i] = filepath.FromSlash(want[i])
+		}
+		if got, _ := x.list(); !reflect.DeepEqual(got, want) {
+			t.Errorf("files %q, want %q", got, want)
+		}
+	}
+	check(".gitignore", "a.go", "sub/b.go", "sub/deep/c.go")
+
+	// the modification time of a changed directory, later than the scan
+	later := time.Now().Add(time.Minute)
+	touch := func(paths ...string) {
+		for _, path := range paths {
+			later = later.Add(time.Second)
+			if err := os.Chtimes(path, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if x.refresh(ctx) {
+		t.Error("refresh reports a change without changes")
+	}
+
+	// create, rename and delete
+	os.WriteFile("d.go", nil, 0644)
+	os.Rename("sub/b.go", "sub/e.go")
+	os.MkdirAll("new/dir", 0755)
+	os.WriteFile("new/dir/f.go", nil, 0644)
+	os.RemoveAll("sub/deep")
+	touch(".", "sub")
+	if !x.refresh(ctx) {
+		t.Error("refresh reports no change")
+	}
+	x.publish(true)
+	check(".gitignore", "a.go", "d.go", "new/dir/f.go", "sub/e.go")
+
+	// a changed .gitignore
+	os.WriteFile("sub/.gitignore", []byte("e.go\n"), 0644)
+	touch("sub/.gitignore", "sub")
+	x.refresh(ctx)
+	x.publish(true)
+	check(".gitignore", "a.go", "d.go", "new/dir/f.go", "sub/.gitignore")
+}
+
+func TestFileIndexRun(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{".gitignore": "*.log\n", "x.log": ""}
+	var want []string
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("d%d/f%d.go", i%7, i)
+		files[name] = ""
+		want = append(want, filepath.FromSlash(name))
+	}
+	want = append(want, ".gitignore")
+	slices.Sort(want)
+	writeModule(t, dir, files)
+
+	// the files found in batches are merged in order
+	x := newFileIndex(".")
+	x.found = []string{"d", "b"}
+	x.merge(false)
+	x.found = append(x.found, "e", "a", "c")
+	x.merge(true)
+	if got, _ := x.list(); !reflect.DeepEqual(got, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("merged %q", got)
+	}
+
+	x = newFileIndex(".")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 100)
+	go x.run(ctx, func() { changed <- struct{}{} })
+	wait := func() []string {
+		t.Helper()
+		select {
+		case <-changed:
+		case <-time.After(indexInterval / 2):
+			t.Fatal("no change published")
+		}
+		files, ready := x.list()
+		if !ready {
+			t.Fatal("not ready after the first scan")
+		}
+		return files
+	}
+	if got := wait(); !reflect.DeepEqual(got, want) {
+		t.Errorf("files %q, want %q", got, want)
+	}
+
+	// checked right away rather than after the interval
+	os.WriteFile("new.go", nil, 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(".", later, later)
+	x.check()
+	if got := wait(); !slices.Contains(got, "new.go") {
+		t.Errorf("files %q, want new.go", got)
+	}
+}
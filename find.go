@@ -1,12 +1,345 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/gdamore/tcell/v2"
 )
 
+// findOptions are the toggles of the find bar
+type findOptions struct {
+	regex     bool // the pattern is a regular expression, the replacement may refer to groups by $1
+	matchCase bool
+	wholeWord bool    // the match is not a part of a longer identifier
+	scope     *region // search in the range only, such as the selection
+}
+
+// region is a range of the buffer from start to stop
+type region struct {
+	start, stop pos
+}
+
+func (p pos) before(q pos) bool {
+	return p.row < q.row || p.row == q.row && p.col < q.col
+}
+
+// compile returns the regular expression searching for the pattern
+func (o findOptions) compile(pattern string) (*regexp.Regexp, error) {
+	if !o.regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !o.matchCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// findMatch is a match in the buffer, the column and length are in runes
+type findMatch struct {
+	row, col, len int
+}
+
+// findAll returns the matches of the current search in the buffer.
+// A match does not span lines, and empty matches are skipped.
+func (e *Editor) findAll() []findMatch {
+	var matches []findMatch
+	r := e.find.opts.scope
+	for row, line := range e.buf {
+		for _, m := range matchLine(e.find.re, e.find.opts, row, string(line)) {
+			if r != nil && (pos{row, m.col}.before(r.start) || r.stop.before(pos{row, m.col + m.len})) {
+				continue
+			}
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// matchLine returns the non-empty matches in the line s of the row
+func matchLine(re *regexp.Regexp, opts findOptions, row int, s string) []findMatch {
+	var matches []findMatch
+	var col, off int // the rune column of the byte offset
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		col += utf8.RuneCountInString(s[off:loc[0]])
+		off = loc[0]
+		if opts.wholeWord && !isWholeWord(s, loc[0], loc[1]) {
+			continue
+		}
+		matches = append(matches, findMatch{row, col, utf8.RuneCountInString(s[loc[0]:loc[1]])})
+	}
+	return matches
+}
+
+// isWholeWord reports whether s[start:end] is not a part of a longer identifier
+func isWholeWord(s string, start, end int) bool {
+	first, _ := utf8.DecodeRuneInString(s[start:])
+	last, _ := utf8.DecodeLastRuneInString(s[:end])
+	if before, _ := utf8.DecodeLastRuneInString(s[:start]); start > 0 && isWordRune(before) && isWordRune(first) {
+		return false
+	}
+	after, _ := utf8.DecodeRuneInString(s[end:])
+	return end == len(s) || !isWordRune(after) || !isWordRune(last)
+}
+
+// expand returns the replacement of the match, the groups are expanded for regex
+func (e *Editor) expand(m findMatch, repl string) string {
+	return expandMatch(e.find.re, e.find.opts, string(e.buf[m.row]), m, repl)
+}
+
+// expandMatch returns the replacement of the match in the line,
+// the groups such as $1 are expanded for regex.
+func expandMatch(re *regexp.Regexp, opts findOptions, line string, m findMatch, repl string) string {
+	if !opts.regex {
+		return repl
+	}
+	start := len(string([]rune(line)[:m.col]))
+	for _, sub := range re.FindAllStringSubmatchIndex(line, -1) {
+		if sub[0] == start {
+			return string(re.ExpandString(nil, repl, line, sub))
+		}
+	}
+	return repl
+}
+
+// replaceMatch returns the actions replacing the match with text
+func (e *Editor) replaceMatch(m findMatch, text string) []Action {
+	start := pos{m.row, m.col}
+	return []Action{
+		Delete(e, start, pos{m.row, m.col + m.len}),
+		InsertText(e, start, text),
+	}
+}
+
+// ReplaceNext replaces the current match as one change, and goes to the next one
+func (e *Editor) ReplaceNext(repl string) {
+	if e.find.re == nil {
+		return
+	}
+	if e.readOnly {
+		message.Set(errReadOnly.Error())
+		return
+	}
+	// the buffer may be edited since the search
+	e.find.match = e.findAll()
+	if len(e.find.match) == 0 {
+		return
+	}
+	e.find.index = min(e.find.index, len(e.find.match)-1)
+	m := e.find.match[e.find.index]
+	text := e.expand(m, repl)
+	end := textEnd(pos{m.row, m.col}, text)
+	e.do(append(e.replaceMatch(m, text), Move(e, end))...)
+	if r := e.find.opts.scope; r != nil {
+		r.stop = shiftAfter(r.stop, m, end)
+	}
+
+	e.find.match = e.findAll()
+	if len(e.find.match) == 0 {
+		return
+	}
+	// the first match after the replacement, wrapping around
+	e.find.index = 0
+	for i, n := range e.find.match {
+		if n.row > end.row || n.row == end.row && n.col >= end.col {
+			e.find.index = i
+			break
+		}
+	}
+	e.showMatch()
+}
+
+// ReplaceAll replaces all the matches as one change, and returns the number of them
+func (e *Editor) ReplaceAll(repl string) int {
+	if e.find.re == nil {
+		return 0
+	}
+	if e.readOnly {
+		message.Set(errReadOnly.Error())
+		return 0
+	}
+	e.find.match = e.findAll()
+	n := len(e.find.match)
+	if n == 0 {
+		return 0
+	}
+	// from the bottom, so that the matches above are not moved
+	var actions []Action
+	for i := n - 1; i >= 0; i-- {
+		m := e.find.match[i]
+		text := e.expand(m, repl)
+		actions = append(actions, e.replaceMatch(m, text)...)
+		if r := e.find.opts.scope; r != nil {
+			r.stop = shiftAfter(r.stop, m, textEnd(pos{m.row, m.col}, text))
+		}
+	}
+	first := e.find.match[0]
+	e.do(append(actions, Move(e, pos{first.row, first.col}))...)
+	e.find.match = e.findAll()
+	e.find.index = 0
+	return n
+}
+
+// textEnd returns the position after the text inserted at p
+func textEnd(p pos, text string) pos {
+	for _, c := range text {
+		if c == '\n' {
+			p.row++
+			p.col = 0
+		} else {
+			p.col++
+		}
+	}
+	return p
+}
+
+// shiftAfter returns the position p after the match is replaced by the text ending at end
+func shiftAfter(p pos, m findMatch, end pos) pos {
+	matchEnd := pos{m.row, m.col + m.len}
+	if p.before(matchEnd) {
+		return p
+	}
+	if p.row == m.row {
+		return pos{end.row, end.col + p.col - matchEnd.col}
+	}
+	p.row += end.row - m.row
+	return p
+}
+
+// selectionRegion returns the range of the selection, or nil
+func (e *Editor) selectionRegion() *region {
+	if e.selection == nil {
+		return nil
+	}
+	stop := e.selection.stop
+	stop.col = min(stop.col, len(e.buf[stop.row]))
+	return &region{e.selection.start, stop}
+}
+
+// query returns the text to prefill the find bar,
+// the selection in a line or the word under the cursor.
+func (e *Editor) query() string {
+	if r := e.selectionRegion(); r != nil && r.start.row == r.stop.row {
+		return string(e.buf[r.start.row][r.start.col:r.stop.col])
+	}
+	line := e.buf[e.cursor.row]
+	start, end := e.cursor.col, e.cursor.col
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordRune(line[end]) {
+		end++
+	}
+	return string(line[start:end])
+}
+
+// the number of queries kept in the search history
+const maxSearchHistory = 100
+
+// searchHistory is the recent queries of the find bar, persisted in a file
+type searchHistory struct {
+	filename string
+	queries  []string // the latest last
+	index    int      // the browsed query, len(queries) if not browsing
+}
+
+// searchHistoryFile returns the path of the history, such as ~/.cache/jo/find-history
+func searchHistoryFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "jo", "find-history")
+}
+
+// loadSearchHistory reads the history from the file, one query per line.
+// A missing file is an empty history.
+func loadSearchHistory(filename string) *searchHistory {
+	h := &searchHistory{filename: filename}
+	if filename != "" {
+		if data, err := os.ReadFile(filename); err == nil {
+			for _, q := range strings.Split(string(data), "\n") {
+				if q != "" {
+					h.queries = append(h.queries, q)
+				}
+			}
+		}
+	}
+	h.index = len(h.queries)
+	return h
+}
+
+// add puts the query as the latest one, and saves the history
+func (h *searchHistory) add(q string) error {
+	defer h.reset()
+	if q == "" || len(h.queries) > 0 && h.queries[len(h.queries)-1] == q {
+		return nil
+	}
+	if i := slices.Index(h.queries, q); i >= 0 {
+		h.queries = slices.Delete(h.queries, i, i+1)
+	}
+	h.queries = append(h.queries, q)
+	if len(h.queries) > maxSearchHistory {
+		h.queries = h.queries[len(h.queries)-maxSearchHistory:]
+	}
+	if h.filename == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.filename), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(h.filename, []byte(strings.Join(h.queries, "\n")+"\n"), 0644)
+}
+
+// browsing reports whether a query in the history is shown
+func (h *searchHistory) browsing() bool { return h.index < len(h.queries) }
+
+// reset stops browsing
+func (h *searchHistory) reset() { h.index = len(h.queries) }
+
+// prev returns the older query, false at the oldest
+func (h *searchHistory) prev() (string, bool) {
+	if h.index == 0 {
+		return "", false
+	}
+	h.index--
+	return h.queries[h.index], true
+}
+
+// next returns the newer query, or empty after the latest one
+func (h *searchHistory) next() (string, bool) {
+	if !h.browsing() {
+		return "", false
+	}
+	h.index++
+	if !h.browsing() {
+		return "", true
+	}
+	return h.queries[h.index], true
+}
+
 type findBar struct {
 	BaseView
 	keyword []rune
+	replace []rune
+	opts    findOptions
+	err     error   // the invalid pattern
+	editor  *Editor // the editor searched
+
+	inSelection bool    // search in the scope
+	scope       *region // the selection when the find bar is opened
+	history     *searchHistory
+
+	showReplace bool // the replace field is shown under the find field
+	replacing   bool // the replace field is focused
 }
 
 func (f *findBar) SetPos(x, y, w, h int) {
@@ -15,40 +348,111 @@ func (f *findBar) SetPos(x, y, w, h int) {
 	f.cursorY = y
 }
 
+// the width of the find bar
+const findBarWidth = 60
+
+// input returns the focused field
+func (f *findBar) input() *[]rune {
+	if f.replacing {
+		return &f.replace
+	}
+	return &f.keyword
+}
+
+// rows returns the height of the find bar
+func (f *findBar) rows() int {
+	if f.showReplace {
+		return 2
+	}
+	return 1
+}
+
 func (f *findBar) Draw(screen tcell.Screen) {
-	style := tcell.StyleDefault.Background(tcell.ColorLightGray).Foreground(tcell.ColorBlack)
+	style := theme.bar
 	for y := f.y; y < f.y+f.height; y++ {
 		for x := f.x; x < f.x+f.width; x++ {
 			screen.SetContent(x, y, ' ', nil, style)
 		}
 	}
 
-	s := "find:" + string(f.keyword)
+	keywordStyle := style
+	if f.err != nil {
+		keywordStyle = style.Foreground(theme.diagError)
+	}
+	s := []rune("find: " + string(f.keyword))
 	for i, c := range s {
-		screen.SetContent(f.x+i, f.y, c, nil, style)
+		if i >= f.width {
+			break
+		}
+		screen.SetContent(f.x+i, f.y, c, nil, keywordStyle)
 	}
 	f.cursorX, f.cursorY = f.x+len(s), f.y
 
-	// if len(f.jo.editor.findMatch) > 0 {
-	// 	index := fmt.Sprintf("%d/%d", f.jo.editor.findIndex+1, len(f.jo.editor.findMatch))
-	// 	for i, c := range index {
-	// 		// align center
-	// 		x := (f.width-len(index))/2 + i
-	// 		if f.x+f.width <= x || x <= f.cursorX {
-	// 			break
-	// 		}
-	// 		screen.SetContent(x, f.y+f.height, c, nil, style)
-	// 	}
-	// }
-
-	keymap := "<down> next, <up> previous, <esc> cancel"
-	for i, c := range keymap {
-		// align right
-		x := f.x + f.width - 1 - len(keymap) + i
-		if f.x+f.width <= x || x <= f.cursorX {
-			break
+	// the toggles on the right, such as "[.*]"
+	toggles := []struct {
+		label string
+		on    bool
+	}{
+		{".*", f.opts.regex},
+		{"Aa", f.opts.matchCase},
+		{"ab", f.opts.wholeWord},
+		{"[]", f.inSelection},
+	}
+
+	// the match position and count, before the toggles
+	if f.editor != nil && len(f.keyword) > 0 && f.err == nil {
+		count := "no results"
+		if n := len(f.editor.find.match); n > 0 {
+			count = fmt.Sprintf("%d/%d", f.editor.find.index+1, n)
+		}
+		x := f.x + f.width - 2 - len(toggles)*3 - len(count)
+		if x > f.cursorX {
+			for i, c := range count {
+				screen.SetContent(x+i, f.y, c, nil, style.Foreground(theme.barHint))
+			}
+		}
+	}
+	x := f.x + f.width - 1 - len(toggles)*3
+	for _, t := range toggles {
+		s := style.Foreground(theme.barHint)
+		if t.on {
+			s = style.Background(theme.barSelected)
+		}
+		if x > f.cursorX {
+			screen.SetContent(x, f.y, ' ', nil, style)
+			screen.SetContent(x+1, f.y, rune(t.label[0]), nil, s)
+			screen.SetContent(x+2, f.y, rune(t.label[1]), nil, s)
+		}
+		x += 3
+	}
+
+	// the hint on the last row, after the input
+	keymap := "<tab> replace, alt+r/c/w/s "
+	start := f.x + f.width - 1 - len(toggles)*3 - len(keymap)
+	end := f.x + len(s)
+	if len(f.keyword) > 0 {
+		// the place of the count
+		end = start
+	}
+	if f.showReplace {
+		r := []rune("replace: " + string(f.replace))
+		for i, c := range r {
+			if i >= f.width {
+				break
+			}
+			screen.SetContent(f.x+i, f.y+1, c, nil, style)
+		}
+		if f.replacing {
+			f.cursorX, f.cursorY = f.x+len(r), f.y+1
+		}
+		keymap = "<enter> replace, <ctrl+a> all "
+		start = f.x + f.width - len(keymap)
+		end = f.x + len(r)
+	}
+	if start > end {
+		for i, c := range keymap {
+			screen.SetContent(start+i, f.y+f.height-1, c, nil, style.Foreground(theme.barHint))
 		}
-		screen.SetContent(x, f.y, c, nil, style)
 	}
 
 	if f.Focused() {
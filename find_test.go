@@ -0,0 +1,145 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindOptions(t *testing.T) {
+	tests := []struct {
+		pattern string
+		opts    findOptions
+		want    []findMatch
+	}{
+		{"foo", findOptions{matchCase: true}, []findMatch{{0, 4, 3}, {1, 0, 3}}},
+		{"foo", findOptions{}, []findMatch{{0, 4, 3}, {1, 0, 3}, {1, 8, 3}}},
+		{"foo", findOptions{wholeWord: true}, []findMatch{{0, 4, 3}, {1, 8, 3}}},
+		{`f\w+`, findOptions{regex: true, matchCase: true}, []findMatch{{0, 4, 3}, {1, 0, 6}}},
+		{"ö", findOptions{matchCase: true}, []findMatch{{0, 1, 1}, {0, 8, 1}}},
+		{"x*", findOptions{regex: true}, nil},
+	}
+	for _, tt := range tests {
+		e := newTestEditor("a.txt", "äöü foo öü", "foobar  FOO")
+		if err := e.Find(tt.pattern, tt.opts); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(e.find.match, tt.want) {
+			t.Errorf("find %q %+v: %v, want %v", tt.pattern, tt.opts, e.find.match, tt.want)
+		}
+	}
+
+	e := newTestEditor("a.txt", "foo")
+	if err := e.Find("(", findOptions{regex: true}); err == nil {
+		t.Error("want the error of invalid pattern")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	e := newTestEditor("a.txt", "ü := göö(ü)", "göö()", "")
+	e.status = new(bindStr)
+	if err := e.Find("göö", findOptions{matchCase: true}); err != nil {
+		t.Fatal(err)
+	}
+	e.ReplaceNext("g")
+	if got := string(e.bytes()); got != "ü := g(ü)\ngöö()\n" {
+		t.Errorf("replace next: %q", got)
+	}
+	if len(e.find.match) != 1 || e.cursor != (pos{1, 3}) {
+		t.Errorf("after replace next: matches %v, cursor %v", e.find.match, e.cursor)
+	}
+	e.undo()
+	if got := string(e.bytes()); got != "ü := göö(ü)\ngöö()\n" {
+		t.Errorf("undo replace next: %q", got)
+	}
+
+	// the groups in the replacement
+	if err := e.Find(`(\pL+)\((\pL*)\)`, findOptions{regex: true, matchCase: true}); err != nil {
+		t.Fatal(err)
+	}
+	if n := e.ReplaceAll("${2}.${1}()"); n != 2 {
+		t.Errorf("replaced %d, want 2", n)
+	}
+	if got := string(e.bytes()); got != "ü := ü.göö()\n.göö()\n" {
+		t.Errorf("replace all: %q", got)
+	}
+	// one undo step
+	e.undo()
+	if got := string(e.bytes()); got != "ü := göö(ü)\ngöö()\n" {
+		t.Errorf("undo replace all: %q", got)
+	}
+
+	e.Find("ü", findOptions{wholeWord: true})
+	e.ReplaceAll("x\ny")
+	if got := string(e.bytes()); !strings.HasPrefix(got, "x\ny := göö(x\ny)\n") {
+		t.Errorf("replace with lines: %q", got)
+	}
+}
+
+func TestFindInSelection(t *testing.T) {
+	e := newTestEditor("a.txt", "a a a a", "")
+	e.status = new(bindStr)
+	scope := &region{pos{0, 2}, pos{0, 5}}
+	if err := e.Find("a", findOptions{matchCase: true, scope: scope}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []findMatch{{0, 2, 1}, {0, 4, 1}}; !reflect.DeepEqual(e.find.match, want) {
+		t.Errorf("matches %v, want %v", e.find.match, want)
+	}
+	// the scope grows with the replacement
+	if n := e.ReplaceAll("bb"); n != 2 {
+		t.Errorf("replaced %d, want 2", n)
+	}
+	if got := string(e.buf[0]); got != "a bb bb a" {
+		t.Errorf("replace in selection: %q", got)
+	}
+	if want := (region{pos{0, 2}, pos{0, 7}}); *scope != want {
+		t.Errorf("scope %v, want %v", *scope, want)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	e := newTestEditor("a.go", "x := foo_bar(1)")
+	e.cursor = pos{0, 8}
+	if got := e.query(); got != "foo_bar" {
+		t.Errorf("word under cursor: %q", got)
+	}
+	e.selection = &struct{ start, stop pos }{pos{0, 5}, pos{0, 15}}
+	if got := e.query(); got != "foo_bar(1)" {
+		t.Errorf("selection: %q", got)
+	}
+}
+
+func TestSearchHistory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "jo", "find-history")
+	h := loadSearchHistory(filename)
+	for _, q := range []string{"a", "b", "a", "c", ""} {
+		if err := h.add(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h = loadSearchHistory(filename)
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(h.queries, want) {
+		t.Fatalf("history %v, want %v", h.queries, want)
+	}
+
+	var got []string
+	for {
+		q, ok := h.prev()
+		if !ok {
+			break
+		}
+		got = append(got, q)
+	}
+	if q, _ := h.next(); q != "a" {
+		t.Errorf("next = %q, want a", q)
+	}
+	h.next()
+	if q, ok := h.next(); !ok || q != "" || h.browsing() {
+		t.Errorf("next after the latest = %q, %v, want empty", q, ok)
+	}
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("browsed %v, want %v", got, want)
+	}
+}
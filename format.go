@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// formatBuffer organizes the imports of the Go buffer, and formats the buffer
+// by the formatter of its language in config, or go/format for Go.
+// It is one change, the cursor and the scroll position stay with the same code.
+func (e *Editor) formatBuffer(organize, format bool) error {
+	if e.lang == nil {
+		return errNoFormatter
+	}
+	src := e.bytes()
+	out, err := formatText(e.lang.name, e.filename, src, organize, format)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(out, src) {
+		e.replaceText(string(out))
+	}
+	return nil
+}
+
+// formatText organizes the imports of the Go source, and formats the source of the language
+func formatText(lang, filename string, src []byte, organize, format bool) ([]byte, error) {
+	out := src
+	var err error
+	if organize && lang == "go" {
+		if out, err = organizeImports(filename, out); err != nil {
+			return nil, err
+		}
+	}
+	if format {
+		if out, err = formatSource(lang, filename, out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+var errFormatOutdated = errors.New("the buffer has changed while formatting")
+
+// formatInBackground formats the buffer as formatBuffer, running the external
+// formatter in the background so that a slow one does not block the editor.
+// The result is applied in the event loop unless the buffer has changed since,
+// then done is called there with the error.
+func (e *Editor) formatInBackground(organize, format bool, done func(error)) {
+	if e.lang == nil || !format {
+		done(e.formatBuffer(organize, format))
+		return
+	}
+	if _, ok := externalFormatter(e.lang.name); !ok {
+		done(e.formatBuffer(organize, format))
+		return
+	}
+	lang, filename, src, version := e.lang.name, e.filename, e.bytes(), e.version
+	go func() {
+		out, err := formatText(lang, filename, src, organize, format)
+		post(e.screen, func() {
+			if err == nil && e.version != version {
+				err = errFormatOutdated
+			}
+			if err == nil && !bytes.Equal(out, src) {
+				e.replaceText(string(out))
+			}
+			done(err)
+		})
+	}()
+}
+
+// replaceText replaces the buffer with the text by the changed lines in one change.
+// The cursor stays in its line if the line is not changed, otherwise it is
+// anchored by the non-space runes before it in the line.
+func (e *Editor) replaceText(text string) {
+	var lines [][]rune
+	var a, b []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, []rune(line))
+		b = append(b, line)
+	}
+	for _, line := range e.buf {
+		a = append(a, string(line))
+	}
+	hunks := diffLines(a, b)
+	if len(hunks) == 0 {
+		return
+	}
+
+	offset := e.cursor.row + 1 - e.top
+	cursor := e.cursor
+	shift := 0 // the rows inserted above the cursor
+	for _, h := range hunks {
+		if h.i2 <= e.cursor.row {
+			shift += (h.j2 - h.j1) - (h.i2 - h.i1)
+			continue
+		}
+		if h.i1 <= e.cursor.row {
+			// the line of cursor is changed
+			row := min(h.j1+e.cursor.row-h.i1, max(h.j1, h.j2-1))
+			col := 0
+			if row < len(lines) {
+				col = locateCode(lines[row], codeBefore(e.buf[e.cursor.row], e.cursor.col))
+			}
+			cursor = pos{row, col}
+			shift = 0
+		}
+		break
+	}
+	cursor.row += shift
+	cursor.row = min(cursor.row, len(lines)-1)
+	cursor.col = min(cursor.col, len(lines[cursor.row]))
+
+	// from the bottom, so that the rows above are not moved
+	var actions []Action
+	for i := len(hunks) - 1; i >= 0; i-- {
+		h := hunks[i]
+		actions = append(actions, replacement{
+			e:     e,
+			start: h.i1,
+			old:   slices.Clone(e.buf[h.i1:h.i2]),
+			new:   lines[h.j1:h.j2],
+		})
+	}
+	e.do(append(actions, Move(e, cursor))...)
+	e.top = max(1, cursor.row+1-offset)
+}
+
+// codeBefore returns the number of non-space runes before the column of the line
+func codeBefore(line []rune, col int) int {
+	var n int
+	for _, c := range line[:min(col, len(line))] {
+		if !unicode.IsSpace(c) {
+			n++
+		}
+	}
+	return n
+}
+
+// locateCode returns the column after n non-space runes of the line,
+// or at the first non-space rune if n is 0.
+func locateCode(line []rune, n int) int {
+	if n == 0 {
+		for col, c := range line {
+			if !unicode.IsSpace(c) {
+				return col
+			}
+		}
+		return len(line)
+	}
+	for col, c := range line {
+		if unicode.IsSpace(c) {
+			continue
+		}
+		n--
+		if n == 0 {
+			return col + 1
+		}
+	}
+	return len(line)
+}
+
+// replacement replaces the rows from start with other rows
+type replacement struct {
+	e     *Editor
+	start int
+	old   [][]rune
+	new   [][]rune
+}
+
+func (r replacement) Do() {
+	r.e.editing(r.start, len(r.old), true)
+	r.e.buf = slices.Replace(r.e.buf, r.start, r.start+len(r.old), slices.Clone(r.new)...)
+}
+
+func (r replacement) Undo() {
+	r.e.editing(r.start, len(r.new), true)
+	r.e.buf = slices.Replace(r.e.buf, r.start, r.start+len(r.new), slices.Clone(r.old)...)
+}
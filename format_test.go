@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestOrganizeImports(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "remove unused and add missing",
+			src: `package p
+
+import (
+	"example.com/m/x"
+	"os"
+	_ "embed"
+)
+
+func f() { fmt.Println(strings.ToUpper(x.S)) }
+`,
+			want: `package p
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"example.com/m/x"
+)
+
+func f() { fmt.Println(strings.ToUpper(x.S)) }
+`,
+		},
+		{
+			name: "no imports",
+			src:  "package p // comment\n\nvar n = rand.Intn(3)\n",
+			want: "package p // comment\n\nimport \"math/rand\"\n\nvar n = rand.Intn(3)\n",
+		},
+		{
+			name: "all unused",
+			src:  "package p\n\nimport \"os\"\n\nvar n = 1\n",
+			want: "package p\n\nvar n = 1\n",
+		},
+		{
+			name: "declared in the package",
+			src:  "package p\n\nvar n = sort.By\n",
+			want: "package p\n\nvar n = sort.By\n",
+		},
+		{
+			name: "local variable",
+			src:  "package p\n\nfunc f(strings []string) int { return strings.Len }\n",
+			want: "package p\n\nfunc f(strings []string) int { return strings.Len }\n",
+		},
+		{
+			name: "floating comment",
+			src:  "package p\n\nimport (\n\t// io\n\n\t\"io\"\n)\n",
+			want: "package p\n\nimport (\n\t// io\n\n\t\"io\"\n)\n",
+		},
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sort.go"), []byte("package p\n\nvar sort struct{ By int }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "p.go")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := organizeImports(filename, []byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatGo(t *testing.T) {
+	src := "package p\n\nfunc  f( )  int {\nreturn   1+2\n}\n"
+	e := newTestEditor(filepath.Join(t.TempDir(), "p.go"), strings.Split(src, "\n")...)
+	e.lang = &language{name: "go"}
+	e.status = new(bindStr)
+	e.top = 1
+	// no screen for the analysis after changes
+	defer func() { e.analysis.Stop() }()
+	// after "+"
+	e.cursor = pos{3, 11}
+	if err := e.formatBuffer(true, true); err != nil {
+		t.Fatal(err)
+	}
+	want := "package p\n\nfunc f() int {\n\treturn 1 + 2\n}\n"
+	if got := string(e.bytes()); got != want {
+		t.Errorf("formatted:\n%s\nwant:\n%s", got, want)
+	}
+	if e.cursor != (pos{3, 11}) || e.buf[3][e.cursor.col-1] != '+' {
+		t.Errorf("cursor = %v, want {3 11}", e.cursor)
+	}
+
+	e.undo()
+	if got := string(e.bytes()); got != src {
+		t.Errorf("after undo:\n%s", got)
+	}
+	if e.cursor != (pos{3, 11}) {
+		t.Errorf("cursor after undo = %v, want {3 11}", e.cursor)
+	}
+}
+
+func TestSaveFormatted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "p.go")
+	e := newTestEditor(filename, "package p", "", "func  f( ) {}", "")
+	e.lang = &language{name: "go"}
+	e.status = new(bindStr)
+	e.top = 1
+	defer func() { e.analysis.Stop() }()
+	saved := false
+	e.save(func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved = true
+	})
+	if !saved {
+		t.Fatal("the Go buffer is not saved right away")
+	}
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package p\n\nfunc f() {}\n"; string(got) != want {
+		t.Errorf("saved:\n%s\nwant:\n%s", got, want)
+	}
+	if e.dirty {
+		t.Error("the buffer is dirty after saving")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	c, err := loadConfig(filename)
+	if err != nil || !reflect.DeepEqual(c, defaultConfig()) {
+		t.Errorf("missing file: %v, %v", c, err)
+	}
+	if !c.FormatOnSave || c.OrganizeImports {
+		t.Errorf("default config = %+v, want only formatOnSave on", c)
+	}
+	data := `{"formatOnSave": false, "formatters": {"json": {"command": ["jq", "."], "timeout": "1s"}}}`
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err = loadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.FormatOnSave || c.OrganizeImports {
+		t.Errorf("config = %+v, want formatOnSave off", c)
+	}
+	f := c.Formatters["json"]
+	if !reflect.DeepEqual(f.Command, []string{"jq", "."}) || time.Duration(f.Timeout) != time.Second {
+		t.Errorf("json formatter = %+v", f)
+	}
+}
+
+func TestExternalFormatter(t *testing.T) {
+	old := config
+	defer func() { config = old }()
+	config.Formatters = map[string]formatter{
+		"json":  {Command: []string{"sh", "-c", `sed 's/  */ /g'`}},
+		"yaml":  {Command: []string{"sh", "-c", "echo bad input >&2; exit 1"}},
+		"shell": {Command: []string{"sleep", "1"}, Timeout: duration(50 * time.Millisecond)},
+	}
+
+	e := newTestEditor("a.json", "{", "  \"a\":    1,", "  \"b\":    2", "}", "")
+	e.lang = &language{name: "json"}
+	e.status = new(bindStr)
+	// after "2"
+	e.cursor = pos{2, 11}
+	if err := e.formatBuffer(false, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(e.bytes()); got != "{\n \"a\": 1,\n \"b\": 2\n}\n" {
+		t.Errorf("formatted: %q", got)
+	}
+	if e.cursor != (pos{2, 7}) || e.buf[2][e.cursor.col-1] != '2' {
+		t.Errorf("cursor = %v, want {2 7}", e.cursor)
+	}
+	e.undo()
+	if got := string(e.buf[1]); got != "  \"a\":    1," {
+		t.Errorf("after undo: %q", got)
+	}
+
+	e.lang = &language{name: "yaml"}
+	if err := e.formatBuffer(false, true); err == nil || err.Error() != "sh: bad input" {
+		t.Errorf("error = %v, want the standard error", err)
+	}
+	e.lang = &language{name: "shell"}
+	if err := e.formatBuffer(false, true); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("error = %v, want timeout", err)
+	}
+	e.lang = &language{name: "sql"}
+	if canFormat(e.lang) {
+		t.Error("sql can be formatted without a formatter")
+	}
+}
+
+func TestFormatInBackground(t *testing.T) {
+	old := config
+	defer func() { config = old }()
+	config.Formatters = map[string]formatter{
+		"json": {Command: []string{"sh", "-c", `sed 's/  */ /g'`}},
+		"yaml": {Command: []string{"sh", "-c", "echo bad input >&2; echo at line 2 >&2; exit 1"}},
+	}
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	e := newTestEditor("a.json", "{", "  \"a\":    1", "}", "")
+	e.screen = screen
+	e.lang = &language{name: "json"}
+	e.status = new(bindStr)
+
+	tests := []struct {
+		name string
+		// while formatting
+		do   func()
+		want string
+		err  error
+	}{
+		{"applied", func() {}, " \"a\": 1", nil},
+		{"edited", func() { e.writeRune('x') }, "x  \"a\":    1", errFormatOutdated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e.buf[1] = []rune("  \"a\":    1")
+			e.cursor = pos{1, 0}
+			var got error
+			done := false
+			e.formatInBackground(false, true, func(err error) {
+				got, done = err, true
+			})
+			if done {
+				t.Fatal("formatted in the event loop")
+			}
+			tt.do()
+			runPosted(t, screen)
+			if !done || got != tt.err {
+				t.Errorf("done %v with %v, want %v", done, got, tt.err)
+			}
+			if line := string(e.buf[1]); line != tt.want {
+				t.Errorf("line = %q, want %q", line, tt.want)
+			}
+		})
+	}
+
+	e.lang = &language{name: "yaml"}
+	var got error
+	e.formatInBackground(false, true, func(err error) { got = err })
+	runPosted(t, screen)
+	var fe *formatError
+	if !errors.As(got, &fe) || fe.stderr != "bad input\nat line 2" || got.Error() != "sh: bad input" {
+		t.Errorf("error = %#v, want the whole standard error", got)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// formatter is an external command formatting the source from stdin to stdout,
+// such as {"command": ["jq", "."], "timeout": "2s"}. The argument "$FILE"
+// is replaced with the file name, for the formatters finding their config by it.
+type formatter struct {
+	Command []string `json:"command"`
+	Timeout duration `json:"timeout"`
+}
+
+// the default timeout of formatters
+const formatTimeout = 3 * time.Second
+
+var errNoFormatter = errors.New("no formatter for the language")
+
+// formatError is the failure of an external formatter with its standard error,
+// the first line of which is the message.
+type formatError struct {
+	command string
+	stderr  string
+}
+
+func (e *formatError) Error() string {
+	line, _, _ := strings.Cut(e.stderr, "\n")
+	return e.command + ": " + line
+}
+
+// duration is a time.Duration written as a string in JSON, such as "500ms"
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// formatSource formats the source of the language by the formatter in config,
+// or go/format for Go.
+func formatSource(lang, filename string, src []byte) ([]byte, error) {
+	if f, ok := externalFormatter(lang); ok {
+		return f.run(filename, src)
+	}
+	if lang == "go" {
+		return format.Source(src)
+	}
+	return nil, errNoFormatter
+}
+
+// externalFormatter returns the formatter of the language in config
+func externalFormatter(lang string) (formatter, bool) {
+	f, ok := config.Formatters[lang]
+	return f, ok && len(f.Command) > 0
+}
+
+// canFormat reports whether the buffer of the language can be formatted
+func canFormat(lang *language) bool {
+	if lang == nil {
+		return false
+	}
+	_, ok := config.Formatters[lang.name]
+	return ok || lang.name == "go"
+}
+
+// run runs the formatter in the directory of the file, the error is
+// a *formatError with the standard error of the command.
+func (f formatter) run(filename string, src []byte) ([]byte, error) {
+	timeout := time.Duration(f.Timeout)
+	if timeout <= 0 {
+		timeout = formatTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	args := make([]string, len(f.Command))
+	for i, arg := range f.Command {
+		args[i] = strings.ReplaceAll(arg, "$FILE", filename)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if filename != "" {
+		cmd.Dir = filepath.Dir(filename)
+	}
+	cmd.Stdin = bytes.NewReader(src)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %s", args[0], timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, &formatError{command: args[0], stderr: msg}
+		}
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+	if stdout.Len() == 0 && len(src) > 0 {
+		return nil, fmt.Errorf("%s: empty output", args[0])
+	}
+	return stdout.Bytes(), nil
+}
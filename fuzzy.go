@@ -0,0 +1,175 @@
+package main
+
+import (
+	"unicode"
+)
+
+// scores of fuzzy matching, similar to fzf
+const (
+	scoreMatch       = 16
+	scoreGapStart    = -3
+	scoreGapExtend   = -1
+	bonusBoundary    = 8 // after a separator, such as '/' and '_'
+	bonusCamel       = 7 // such as 'B' in "fooBar"
+	bonusConsecutive = 4
+	bonusFirstChar   = 2 // multiplier of the bonus of the first character
+	bonusCase        = 1 // the same case
+)
+
+// fuzzyMatch reports whether the runes of pattern appear in s in order,
+// case-insensitively. It returns the best score and the indices of matched runes in s,
+// the match at word boundaries and consecutive runes score higher.
+func fuzzyMatch(pattern, s string) (score int, matched []int, ok bool) {
+	return newFuzzyMatcher(pattern).match(s)
+}
+
+// fuzzyMatcher matches a pattern against many strings,
+// reusing the memory of scoring between them.
+type fuzzyMatcher struct {
+	pattern []rune
+	lower   []rune // the pattern in lower case
+	r       []rune
+	bonus   []int
+	// m[i*len(r)+j] is the best score with pattern[i] matched at r[j], and
+	// from[i*len(r)+j] is the index where pattern[i-1] is matched for it
+	m, from []int
+}
+
+func newFuzzyMatcher(pattern string) *fuzzyMatcher {
+	f := &fuzzyMatcher{pattern: []rune(pattern)}
+	for _, c := range f.pattern {
+		f.lower = append(f.lower, unicode.ToLower(c))
+	}
+	return f
+}
+
+// match is fuzzyMatch of the pattern against s
+func (f *fuzzyMatcher) match(s string) (score int, matched []int, ok bool) {
+	if len(f.pattern) == 0 {
+		return 0, nil, true
+	}
+	best, end, ok := f.score(s)
+	if !ok {
+		return 0, nil, false
+	}
+	n := len(f.r)
+	matched = make([]int, len(f.pattern))
+	for i, j := len(f.pattern)-1, end; i >= 0; i-- {
+		matched[i] = j
+		j = f.from[i*n+j]
+	}
+	return best, matched, true
+}
+
+// score returns the best score of matching s and where the last rune of
+// the pattern is matched, without the indices of the others.
+func (f *fuzzyMatcher) score(s string) (best, end int, ok bool) {
+	p := f.pattern
+	if len(p) == 0 {
+		return 0, -1, true
+	}
+	// a cheap check before scoring, without allocation
+	var i int
+	for _, c := range s {
+		if unicode.ToLower(c) == f.lower[i] {
+			if i++; i == len(p) {
+				break
+			}
+		}
+	}
+	if i < len(p) {
+		return 0, -1, false
+	}
+
+	f.r = f.r[:0]
+	for _, c := range s {
+		f.r = append(f.r, c)
+	}
+	r := f.r
+	n := len(r)
+	f.bonus = reuseInts(f.bonus, n)
+	bonus := f.bonus
+	for j := range r {
+		bonus[j] = boundaryBonus(r, j)
+	}
+
+	const none = -1 << 30
+	f.m = reuseInts(f.m, len(p)*n)
+	f.from = reuseInts(f.from, len(p)*n)
+	m, from := f.m, f.from
+	for i := range p {
+		row, prev := i*n, (i-1)*n
+		// the best score of p[i-1] matched at gapFrom before j-1, with gap penalty
+		gap, gapFrom := none, -1
+		for j := 0; j < n; j++ {
+			if i > 0 && j >= 2 {
+				if gap != none {
+					gap += scoreGapExtend
+				}
+				if k := j - 2; m[prev+k] != none && m[prev+k]+scoreGapStart > gap {
+					gap, gapFrom = m[prev+k]+scoreGapStart, k
+				}
+			}
+			m[row+j] = none
+			if unicode.ToLower(r[j]) != f.lower[i] {
+				continue
+			}
+			s := scoreMatch + bonus[j]
+			if r[j] == p[i] {
+				s += bonusCase
+			}
+			if i == 0 {
+				m[row+j] = s + bonus[j]*(bonusFirstChar-1)
+				continue
+			}
+			// consecutive
+			if j > 0 && m[prev+j-1] != none {
+				m[row+j] = m[prev+j-1] + s + bonusConsecutive
+				from[row+j] = j - 1
+			}
+			if gap != none && gap+s > m[row+j] {
+				m[row+j] = gap + s
+				from[row+j] = gapFrom
+			}
+		}
+	}
+
+	last := (len(p) - 1) * n
+	best, end = none, -1
+	for j := 0; j < n; j++ {
+		if m[last+j] > best {
+			best, end = m[last+j], j
+		}
+	}
+	if end < 0 {
+		return 0, -1, false
+	}
+	return best, end, true
+}
+
+// reuseInts returns a slice of n elements, reusing a if it is large enough
+func reuseInts(a []int, n int) []int {
+	if cap(a) < n {
+		return make([]int, n)
+	}
+	return a[:n]
+}
+
+// return the bonus for matching at r[j]
+func boundaryBonus(r []rune, j int) int {
+	if j == 0 {
+		return bonusBoundary
+	}
+	prev, c := r[j-1], r[j]
+	switch {
+	case !unicode.IsLetter(prev) && !unicode.IsDigit(prev):
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			return bonusBoundary
+		}
+	case unicode.IsLower(prev) && unicode.IsUpper(c):
+		return bonusCamel
+	case unicode.IsLetter(prev) && unicode.IsDigit(c):
+		return bonusCamel
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s  string
+		wantOK      bool
+		wantMatched []int
+	}{
+		{pattern: "", s: "foo", wantOK: true},
+		{pattern: "fm", s: "fmt", wantOK: true, wantMatched: []int{0, 1}},
+		{pattern: "gB", s: "getBuffer", wantOK: true, wantMatched: []int{0, 3}},
+		{pattern: "gb", s: "getBuffer", wantOK: true, wantMatched: []int{0, 3}},
+		{pattern: "nl", s: "new_line", wantOK: true, wantMatched: []int{0, 4}},
+		{pattern: "pri", s: "Println", wantOK: true, wantMatched: []int{0, 1, 2}},
+		{pattern: "xyz", s: "fmt", wantOK: false},
+		{pattern: "tf", s: "fmt", wantOK: false},
+		{pattern: "longer", s: "long", wantOK: false},
+	}
+	for _, tt := range tests {
+		_, matched, ok := fuzzyMatch(tt.pattern, tt.s)
+		if ok != tt.wantOK || !reflect.DeepEqual(matched, tt.wantMatched) {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, %v, want %v, %v", tt.pattern, tt.s, matched, ok, tt.wantMatched, tt.wantOK)
+		}
+	}
+}
+
+func TestFuzzyMatchRank(t *testing.T) {
+	// each pair is ranked higher first
+	tests := []struct {
+		pattern, better, worse string
+	}{
+		{"buf", "buffer", "bigUnusedFlag"},
+		{"gb", "getBuffer", "gobble"},
+		{"ed", "editor", "redo"},
+		{"str", "strings", "sometr"},
+	}
+	for _, tt := range tests {
+		a, _, ok1 := fuzzyMatch(tt.pattern, tt.better)
+		b, _, ok2 := fuzzyMatch(tt.pattern, tt.worse)
+		if !ok1 || !ok2 || a <= b {
+			t.Errorf("fuzzyMatch(%q): %q scores %d, %q scores %d", tt.pattern, tt.better, a, tt.worse, b)
+		}
+	}
+}
@@ -2,7 +2,10 @@ module github.com/chenen3/jo
 
 go 1.22.1
 
-require github.com/gdamore/tcell/v2 v2.7.4
+require (
+	github.com/gdamore/tcell/v2 v2.7.4
+	golang.org/x/term v0.17.0
+)
 
 require (
 	github.com/gdamore/encoding v1.0.0 // indirect
@@ -10,6 +13,5 @@ require (
 	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/rivo/uniseg v0.4.3 // indirect
 	golang.org/x/sys v0.17.0 // indirect
-	golang.org/x/term v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// goChecker parses and type-checks Go packages from source, without network.
+// The file set and the importer are shared between checks, so that
+// the imported packages are type-checked once, until reset.
+type goChecker struct {
+	mu       sync.Mutex // guards the fields, not the checks
+	importer *srcImporter
+	checks   int // since the file set is created
+}
+
+var checker = new(goChecker)
+
+// every check parses the files of the package into the file set again,
+// which is dropped after so many checks to bound its size
+const maxChecks = 100
+
+// reset drops the imported packages, since their source may have changed
+func (c *goChecker) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.importer = nil
+}
+
+// acquire returns the importer for a check, the checks running
+// keep the one they have acquired after it is dropped.
+func (c *goChecker) acquire() *srcImporter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.importer == nil || c.checks >= maxChecks {
+		c.importer = newSrcImporter(token.NewFileSet())
+		c.checks = 0
+	}
+	c.checks++
+	return c.importer
+}
+
+// noNetworkEnv keeps go list from downloading modules, or the toolchain
+// required by the module. The packages missing are not imported.
+var noNetworkEnv = []string{"GOPROXY=off", "GOTOOLCHAIN=local"}
+
+// srcImporter imports packages by type-checking their source,
+// with a build context of its own. It is safe for concurrent use,
+// a package imported by several checks at once is type-checked once.
+type srcImporter struct {
+	ctxt build.Context
+	fset *token.FileSet
+
+	// the packages under root are type-checked with overlay in place of
+	// the files on disk, the others are imported by base
+	root    string
+	overlay map[string][]byte
+	base    *srcImporter
+
+	mu       sync.Mutex
+	packages map[string]*imported    // keyed by directory
+	waiting  map[*importer]*imported // the package each check waits for
+}
+
+// imported is a package imported, or being imported until done is closed
+type imported struct {
+	done  chan struct{}
+	owner *importer // the check importing it, nil once done
+	pkg   *types.Package
+	err   error
+}
+
+// importer is the types.Importer of a check, the packages imported
+// by the check and by the packages it imports are owned by it.
+type importer struct {
+	s    *srcImporter
+	base *importer // of s.base
+}
+
+func newSrcImporter(fset *token.FileSet) *srcImporter {
+	ctxt := build.Default
+	// cgo needs a C toolchain for packages like net,
+	// the pure Go files are good enough.
+	ctxt.CgoEnabled = false
+	return &srcImporter{
+		ctxt:     ctxt,
+		fset:     fset,
+		packages: make(map[string]*imported),
+		waiting:  make(map[*importer]*imported),
+	}
+}
+
+// withOverlay returns an importer type-checking the packages under root
+// with overlay in place of the files on disk, the others are imported by s.
+func (s *srcImporter) withOverlay(root string, overlay map[string][]byte) *srcImporter {
+	o := newSrcImporter(s.fset)
+	o.ctxt = s.ctxt
+	o.root, o.overlay, o.base = root, overlay, s
+	return o
+}
+
+// importer returns the importer for a check
+func (s *srcImporter) importer() *importer {
+	imp := &importer{s: s}
+	if s.base != nil {
+		imp.base = s.base.importer()
+	}
+	return imp
+}
+
+func (imp *importer) Import(path string) (*types.Package, error) {
+	return imp.ImportFrom(path, ".", 0)
+}
+
+func (imp *importer) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	bp, err := imp.s.find(path, dir)
+	if err != nil {
+		return nil, err
+	}
+	if imp.base != nil && !inPath(imp.s.root, bp.Dir) {
+		return imp.base.importPackage(bp)
+	}
+	return imp.importPackage(bp)
+}
+
+// importPackage imports the package found, once for all the checks
+func (imp *importer) importPackage(bp *build.Package) (*types.Package, error) {
+	s := imp.s
+	s.mu.Lock()
+	if p, ok := s.packages[bp.Dir]; ok {
+		// the package is imported by another check, wait for it unless
+		// the check waits for this one, through an import cycle
+		for q := p; q.owner != nil; {
+			if q.owner == imp {
+				s.mu.Unlock()
+				return nil, fmt.Errorf("import cycle through package %q", bp.ImportPath)
+			}
+			next, ok := s.waiting[q.owner]
+			if !ok {
+				break
+			}
+			q = next
+		}
+		s.waiting[imp] = p
+		s.mu.Unlock()
+		<-p.done
+		s.mu.Lock()
+		delete(s.waiting, imp)
+		s.mu.Unlock()
+		return p.pkg, p.err
+	}
+	p := &imported{done: make(chan struct{}), owner: imp}
+	s.packages[bp.Dir] = p
+	s.mu.Unlock()
+
+	p.pkg, p.err = imp.load(bp)
+	s.mu.Lock()
+	p.owner = nil
+	if p.err != nil {
+		// tried again by the next check
+		delete(s.packages, bp.Dir)
+	}
+	s.mu.Unlock()
+	close(p.done)
+	return p.pkg, p.err
+}
+
+// load type-checks the package, without the function bodies
+func (imp *importer) load(bp *build.Package) (*types.Package, error) {
+	s := imp.s
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		filename := filepath.Join(bp.Dir, name)
+		var src any
+		if b, ok := s.overlay[filename]; ok {
+			src = b
+		}
+		f, err := parser.ParseFile(s.fset, filename, src, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	var hardErr error
+	conf := types.Config{
+		Importer:         imp,
+		FakeImportC:      true,
+		IgnoreFuncBodies: true,
+		Sizes:            types.SizesFor("gc", s.ctxt.GOARCH),
+		Error: func(err error) {
+			var e types.Error
+			if hardErr == nil && errors.As(err, &e) && !e.Soft {
+				hardErr = err
+			}
+		},
+	}
+	pkg, _ := conf.Check(bp.ImportPath, s.fset, files, nil)
+	if hardErr != nil {
+		return nil, fmt.Errorf("type-checking package %q: %v", bp.ImportPath, hardErr)
+	}
+	return pkg, nil
+}
+
+// find locates the package imported by a file in dir. The standard library
+// is found in GOROOT, the others by go list without network.
+func (s *srcImporter) find(path, dir string) (*build.Package, error) {
+	goroot := filepath.Join(s.ctxt.GOROOT, "src")
+	if build.IsLocalImport(path) || inPath(goroot, dir) || isDir(filepath.Join(goroot, path)) {
+		return s.ctxt.Import(path, dir, 0)
+	}
+	cmd := exec.Command(filepath.Join(s.ctxt.GOROOT, "bin", "go"), "list", "-e", "-f", "{{.Dir}}\n{{.ImportPath}}\n{{if .Error}}{{.Error}}{{end}}", "--", path)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), noNetworkEnv...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list %s: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	lines := strings.SplitN(string(out), "\n", 3)
+	if len(lines) < 3 {
+		return nil, fmt.Errorf("go list %s: unexpected output %q", path, out)
+	}
+	if msg := strings.TrimSpace(lines[2]); msg != "" {
+		return nil, errors.New(msg)
+	}
+	if lines[0] == "" {
+		return nil, fmt.Errorf("cannot find package %q", path)
+	}
+	bp, err := s.ctxt.ImportDir(lines[0], 0)
+	if err != nil {
+		return nil, err
+	}
+	bp.ImportPath = lines[1]
+	return bp, nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// a type-checked package
+type goPackage struct {
+	fset  *token.FileSet
+	pkg   *types.Package
+	info  *types.Info
+	files map[string]*ast.File // keyed by absolute file name
+	src   map[string][]byte
+	errs  []goError
+}
+
+// goError is a parse error or type error
+type goError struct {
+	pos  token.Position
+	msg  string
+	soft bool // the package is still well-typed, such as unused variables
+}
+
+// check parses and type-checks the package containing the file, using
+// overlay in place of the files on disk, such as unsaved buffers.
+// The keys of overlay are absolute file names.
+func (c *goChecker) check(filename string, overlay map[string][]byte) (*goPackage, error) {
+	return c.acquire().check(filename, overlay)
+}
+
+// check type-checks the package containing the file, with the packages
+// imported by s, see [goChecker.check].
+func (s *srcImporter) check(filename string, overlay map[string][]byte) (*goPackage, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{filepath.Base(filename)}
+	isTest := strings.HasSuffix(filename, "_test.go")
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || name == names[0] {
+			continue
+		}
+		if strings.HasSuffix(name, "_test.go") && !isTest {
+			continue
+		}
+		if ok, err := s.ctxt.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	p := &goPackage{
+		fset:  s.fset,
+		files: make(map[string]*ast.File),
+		src:   make(map[string][]byte),
+		info: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			Scopes:     make(map[ast.Node]*types.Scope),
+		},
+	}
+	var files []*ast.File
+	var pkgName string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		src, ok := overlay[path]
+		if !ok {
+			src, err = os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		f, err := parser.ParseFile(s.fset, path, src, parser.ParseComments|parser.AllErrors)
+		if f == nil {
+			return nil, err
+		}
+		// the package of the given file decides which files belong to it
+		if pkgName == "" {
+			pkgName = f.Name.Name
+		} else if f.Name.Name != pkgName {
+			continue
+		}
+		var list scanner.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				p.errs = append(p.errs, goError{pos: e.Pos, msg: e.Msg})
+			}
+		}
+		files = append(files, f)
+		p.files[path] = f
+		p.src[path] = src
+	}
+
+	conf := types.Config{
+		Importer:    s.importer(),
+		FakeImportC: true,
+		Error: func(err error) {
+			var e types.Error
+			if errors.As(err, &e) {
+				p.errs = append(p.errs, goError{pos: e.Fset.Position(e.Pos), msg: e.Msg, soft: e.Soft})
+			}
+		},
+	}
+	// errors are collected above, the result is useful regardless
+	p.pkg, _ = conf.Check(pkgName, s.fset, files, p.info)
+	return p, nil
+}
+
+// position returns the row and rune column of pos, starting from 0
+func (p *goPackage) position(pos token.Pos) (filename string, row, col int) {
+	file := p.fset.File(pos)
+	if file == nil {
+		return "", 0, 0
+	}
+	position := file.Position(pos)
+	src, ok := p.src[file.Name()]
+	if !ok {
+		return position.Filename, position.Line - 1, position.Column - 1
+	}
+	start := file.Offset(file.LineStart(position.Line))
+	return position.Filename, position.Line - 1, utf8.RuneCount(src[start:file.Offset(pos)])
+}
+
+// pos returns the position of the rune column in the row of the file,
+// or token.NoPos if it is out of the file.
+func (p *goPackage) pos(filename string, row, col int) token.Pos {
+	f, ok := p.files[filename]
+	if !ok {
+		return token.NoPos
+	}
+	file := p.fset.File(f.Pos())
+	if row < 0 || row >= file.LineCount() {
+		return token.NoPos
+	}
+	start := file.LineStart(row + 1)
+	line := p.src[filename][file.Offset(start):]
+	var off int
+	for i := 0; i < col && off < len(line) && line[off] != '\n'; i++ {
+		_, size := utf8.DecodeRune(line[off:])
+		off += size
+	}
+	return start + token.Pos(off)
+}
+
+// importPackage imports the package by path, as if it is imported by a file in dir
+func (c *goChecker) importPackage(path, dir string) (*types.Package, error) {
+	return c.acquire().importer().ImportFrom(path, dir, 0)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"go/token"
+	"go/types"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestImportOffline(t *testing.T) {
+	var requests atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer proxy.Close()
+	t.Setenv("GOPROXY", proxy.URL)
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOTOOLCHAIN", "auto")
+	t.Setenv("GOMODCACHE", t.TempDir())
+
+	sum := "example.org/missing v1.0.0 h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n" +
+		"example.org/missing v1.0.0/go.mod h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n"
+	tests := []struct {
+		name  string
+		gomod string
+	}{
+		{"missing module", "module example.com/m\n\ngo 1.22\n\nrequire example.org/missing v1.0.0\n"},
+		{"newer toolchain", "module example.com/m\n\ngo 1.99\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			dir := t.TempDir()
+			writeModule(t, dir, map[string]string{
+				"go.mod": tt.gomod,
+				"go.sum": sum,
+				"m.go":   "package m\n\nimport _ \"example.org/missing/x\"\n",
+			})
+			imp := newSrcImporter(token.NewFileSet()).importer()
+			if _, err := imp.ImportFrom("example.org/missing/x", dir, 0); err == nil {
+				t.Error("imported a package not downloaded")
+			}
+			if n := requests.Load(); n != 0 {
+				t.Errorf("%d requests to the module proxy", n)
+			}
+			if b, err := os.ReadFile(filepath.Join(dir, "go.mod")); err != nil || string(b) != tt.gomod {
+				t.Errorf("go.mod is changed to %q, %v", b, err)
+			}
+		})
+	}
+}
+
+func TestImportConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/a.go": "package a\n\nimport \"example.com/m/b\"\n\nvar A = b.B\n",
+		"b/b.go": "package b\n\nimport \"fmt\"\n\nvar B = fmt.Sprint(1)\n",
+	})
+	s := newSrcImporter(token.NewFileSet())
+	var wg sync.WaitGroup
+	packages := make([]*types.Package, 4)
+	for i := range packages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pkg, err := s.importer().ImportFrom("example.com/m/a", dir, 0)
+			if err != nil {
+				t.Error(err)
+			}
+			packages[i] = pkg
+		}()
+	}
+	wg.Wait()
+	for _, pkg := range packages[1:] {
+		if pkg != packages[0] {
+			t.Fatal("the package is type-checked more than once")
+		}
+	}
+}
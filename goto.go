@@ -1,38 +1,96 @@
 package main
 
 import (
-	"log"
-	"os"
-	"sync"
+	"cmp"
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 )
 
+// gotoBar goes to a file, or to the place after a prefix:
+//
+//	:line[:column]   in the current file
+//	file:line[:column]
+//	@symbol          in the current Go file
+//	#symbol          in the Go files of the project
+//	%buffer          open in any group
+//	>command
 type gotoBar struct {
 	BaseView
+	screen  tcell.Screen
+	groups  func() []*EditorGroup // the editor groups, for the buffers and the preview
 	keyword []rune
 	index   int
+	top     int // the first visible option
 	options []string
+	matched [][]int    // the indices of matched runes of the options, for highlighting
+	targets []location // the locations of the options, such as the symbols
+
+	saved []editorState // the editors before the preview, restored on cancel
+
+	// the workspace symbols, loaded when the '#' prefix is typed
+	symbols []symbol
+	loaded  bool
+	cancel  context.CancelFunc
 }
 
-func (g *gotoBar) Draw(screen tcell.Screen) {
-	once.Do(loadFileList)
-	g.height = 1
-	style := tcell.StyleDefault.Background(tcell.ColorLightGray).Foreground(tcell.ColorBlack)
-	for y := g.y; y < g.y+g.height; y++ {
-		for x := g.x; x < g.x+g.width; x++ {
-			screen.SetContent(x, y, ' ', nil, style)
-		}
+// editorState is the place of a buffer, and whether it is shown by its group
+type editorState struct {
+	group  *EditorGroup
+	editor *Editor
+	shown  bool
+	cursor pos
+	top    int
+}
+
+const (
+	optionWidth = 40
+	// the width of the goto bar, wider than the other bars for paths
+	gotoWidth = 60
+	// the options visible at most
+	maxGotoOptions = 12
+	// the score added to the files opened recently
+	bonusRecent = 3 * scoreMatch
+)
+
+func newGotoBar(screen tcell.Screen, groups func() []*EditorGroup) *gotoBar {
+	return &gotoBar{screen: screen, groups: groups}
+}
+
+// mode returns the prefix of the keyword, or 0 for the files
+func (g *gotoBar) mode() rune {
+	if len(g.keyword) > 0 && strings.ContainsRune(":@#%>", g.keyword[0]) {
+		return g.keyword[0]
 	}
+	return 0
+}
 
+func (g *gotoBar) Draw(screen tcell.Screen) {
+	_, ready := projectFiles.list()
+	style := theme.bar
+	drawPopupRow(screen, g.x, g.y, g.width, g.keyword, style)
+	status := ""
 	if len(g.keyword) == 0 {
-		hint := "search files by name"
-		for i, c := range hint {
-			screen.SetContent(g.x+i, g.y, c, nil, style.Foreground(tcell.ColorGray))
+		hint := "file[:line], :line, @symbol, #symbol, %buffer, >command"
+		if !ready {
+			hint = "(indexing...) " + hint
 		}
+		drawPopupRow(screen, g.x, g.y, g.width, []rune(hint), style.Foreground(theme.barHint))
+	} else if g.mode() == '#' && !g.loaded {
+		status = "loading... "
+	} else if len(g.options) > g.rows(screen) {
+		status = fmt.Sprintf("%d/%d ", g.index+1, len(g.options))
 	}
-	for i, c := range g.keyword {
-		screen.SetContent(g.x+i, g.y, c, nil, style)
+	if x := g.x + g.width - len(status); status != "" && x > g.x+len(g.keyword) {
+		for i, c := range status {
+			screen.SetContent(x+i, g.y, c, nil, style.Foreground(theme.barHint))
+		}
 	}
 	g.cursorX = g.x + len(g.keyword)
 	g.cursorY = g.y
@@ -41,47 +99,419 @@ func (g *gotoBar) Draw(screen tcell.Screen) {
 		screen.ShowCursor(g.cursorX, g.cursorY)
 	}
 
-	if len(g.keyword) > 0 && g.keyword[0] == ':' {
+	if g.mode() == ':' {
+		g.height = 1
 		return
 	}
 
-	if len(g.keyword) == 0 {
-		g.options = files
+	rows := g.rows(screen)
+	g.height = 1 + rows
+	// keep the selected option visible in a smaller screen
+	if g.index >= g.top+rows {
+		g.top = g.index - rows + 1
 	}
-	g.height += len(g.options)
-	for i, name := range g.options {
-		selectedStyle := style
-		if i == g.index {
-			selectedStyle = style.Background(tcell.ColorLightBlue)
+	g.top = max(0, min(g.top, len(g.options)-rows))
+	for i := 0; i < rows; i++ {
+		j := g.top + i
+		s := style
+		if j == g.index {
+			s = style.Background(theme.barSelected)
 		}
-		for j, c := range name {
-			screen.SetContent(g.x+j, g.y+1+i, c, nil, selectedStyle)
+		name := []rune(g.options[j])
+		// keep the tail of a long path, with the file name
+		cut := 0
+		if len(name) > g.width {
+			cut = len(name) - g.width + 1
+			name = append([]rune{'…'}, name[cut:]...)
+			cut--
 		}
-		// padding
-		for j := 0; j < optionWidth-len(name); j++ {
-			screen.SetContent(g.x+len(name)+j, g.y+1+i, ' ', nil, selectedStyle)
+		drawPopupRow(screen, g.x, g.y+1+i, g.width, name, s)
+		if j < len(g.matched) {
+			for _, k := range g.matched[j] {
+				// the runes under the ellipsis are not highlighted
+				if k -= cut; k >= 0 && (cut == 0 || k > 0) {
+					screen.SetContent(g.x+k, g.y+1+i, name[k], nil, s.Bold(true).Underline(true))
+				}
+			}
 		}
 	}
 }
 
-const optionWidth = 40
+// rows returns the number of visible options, fitting in the screen
+func (g *gotoBar) rows(screen tcell.Screen) int {
+	_, height := screen.Size()
+	return max(0, min(len(g.options), maxGotoOptions, height-g.y-2))
+}
 
-var files []string
-var once sync.Once
+// move selects the option n after the current one, wrapping around
+func (g *gotoBar) move(n int) {
+	if len(g.options) == 0 {
+		return
+	}
+	g.index = ((g.index+n)%len(g.options) + len(g.options)) % len(g.options)
+	if g.index < g.top {
+		g.top = g.index
+	} else if g.index >= g.top+maxGotoOptions {
+		g.top = g.index - maxGotoOptions + 1
+	}
+	g.preview()
+}
 
-func loadFileList() {
-	dirs, err := os.ReadDir(".")
-	if err != nil {
-		log.Print(err)
+// Click selects the clicked option, and calls the callback of OnClick
+func (g *gotoBar) Click(x, y int) {
+	i := g.top + y - g.y - 1
+	if y == g.y || i >= len(g.options) {
 		return
 	}
-	for _, d := range dirs {
-		if d.Name()[0] == '.' {
-			continue
+	g.index = i
+	g.BaseView.Click(x, y)
+}
+
+func (g *gotoBar) ScrollUp(delta int) bool {
+	if g.top == 0 {
+		return false
+	}
+	g.top = max(0, g.top-delta)
+	g.index = max(g.top, min(g.index, g.top+g.height-2))
+	return true
+}
+
+func (g *gotoBar) ScrollDown(delta int) bool {
+	last := max(0, len(g.options)-(g.height-1))
+	if g.top >= last {
+		return false
+	}
+	g.top = min(last, g.top+delta)
+	g.index = max(g.top, min(g.index, g.top+g.height-2))
+	return true
+}
+
+// open starts with the keyword, remembering the editors for the preview
+func (g *gotoBar) open(keyword string) {
+	if g.cancel != nil {
+		g.cancel()
+		g.cancel = nil
+	}
+	g.symbols = nil
+	g.loaded = false
+	g.saved = g.saved[:0]
+	for _, group := range g.groups() {
+		for _, e := range group.all {
+			g.saved = append(g.saved, editorState{group, e, e == group.editor, e.cursor, e.top})
 		}
-		if d.IsDir() {
+		if !slices.Contains(group.all, group.editor) {
+			// the blank editor
+			e := group.editor
+			g.saved = append(g.saved, editorState{group, e, true, e.cursor, e.top})
+		}
+	}
+	g.keyword = []rune(keyword)
+	g.filter()
+	// the files may be created since the last check
+	projectFiles.check()
+}
+
+// update options according to the keyword
+func (g *gotoBar) filter() {
+	g.index = 0
+	g.top = 0
+	g.matched = nil
+	g.targets = nil
+	// the places of the buffers before the preview
+	g.restore()
+	defer g.preview()
+	files, _ := projectFiles.list()
+	switch g.mode() {
+	case ':':
+		g.options = nil
+		return
+	case '>':
+		g.options = matchCommands(string(g.keyword[1:]))
+		return
+	case '@':
+		e := recentE.editor
+		if e.lang == nil || e.lang.name != "go" {
+			g.options = nil
+			return
+		}
+		g.matchSymbols(fileSymbols(e.filename, e.bytes()), false)
+		return
+	case '#':
+		g.loadSymbols()
+		g.matchSymbols(g.symbols, true)
+		return
+	case '%':
+		g.matchBuffers()
+		return
+	}
+	if len(g.keyword) == 0 {
+		// the recent files first
+		recent := recentFiles.list()
+		g.options = slices.Concat(recent, slices.DeleteFunc(slices.Clone(files), func(f string) bool {
+			return slices.Contains(recent, f)
+		}))
+		return
+	}
+	name, cursor, ok := splitFileLine(string(g.keyword))
+	if !ok {
+		g.options, g.matched = matchFiles(string(g.keyword), files)
+		return
+	}
+	g.options, g.matched = matchFiles(name, files)
+	for _, f := range g.options {
+		g.targets = append(g.targets, location{f, cursor})
+	}
+}
+
+// matchSymbols sets the options to the symbols matching the keyword,
+// followed by their kinds, or by their files if long is true.
+func (g *gotoBar) matchSymbols(symbols []symbol, long bool) {
+	names := make([]string, len(symbols))
+	for i, s := range symbols {
+		names[i] = s.name
+	}
+	order, matched := rank(string(g.keyword[1:]), names, nil)
+	g.options, g.matched, g.targets = nil, matched, nil
+	for _, i := range order {
+		s := symbols[i]
+		detail := s.kind
+		if long {
+			detail = fmt.Sprintf("%s:%d", relativeName(s.loc.filename), s.loc.cursor.row+1)
+		}
+		g.options = append(g.options, s.name+"  "+detail)
+		g.targets = append(g.targets, s.loc)
+	}
+}
+
+// matchBuffers sets the options to the open buffers matching the keyword
+func (g *gotoBar) matchBuffers() {
+	var names []string
+	var buffers []*Editor
+	for _, group := range g.groups() {
+		for _, e := range group.all {
+			if name := relativeName(absName(e.filename)); !slices.Contains(names, name) {
+				names = append(names, name)
+				buffers = append(buffers, e)
+			}
+		}
+	}
+	order, matched := rank(string(g.keyword[1:]), names, nil)
+	g.options, g.matched, g.targets = nil, matched, nil
+	for _, i := range order {
+		g.options = append(g.options, names[i])
+		g.targets = append(g.targets, location{buffers[i].filename, buffers[i].cursor})
+	}
+}
+
+// loadSymbols parses the Go files of the project for the workspace symbols in the background
+func (g *gotoBar) loadSymbols() {
+	if g.loaded || g.cancel != nil {
+		return
+	}
+	var buffers []*Editor
+	for _, group := range g.groups() {
+		buffers = append(buffers, group.all...)
+	}
+	overlay, _ := overlayOf(buffers)
+	files, _ := projectFiles.list()
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	go func() {
+		symbols := workspaceSymbols(ctx, files, overlay)
+		post(g.screen, func() {
+			if ctx.Err() != nil {
+				return
+			}
+			g.cancel = nil
+			g.symbols = symbols
+			g.loaded = true
+			if g.Focused() && g.mode() == '#' {
+				g.filter()
+			}
+		})
+	}()
+}
+
+// target returns the location to go to for the keyword and the selected option
+func (g *gotoBar) target() (location, bool) {
+	if g.mode() == ':' {
+		cursor, ok := parseLine(string(g.keyword[1:]))
+		e := recentE.editor
+		if !ok || cursor.row >= len(e.buf) {
+			return location{}, false
+		}
+		return location{e.filename, cursor}, true
+	}
+	if g.index < len(g.targets) {
+		return g.targets[g.index], true
+	}
+	return location{}, false
+}
+
+// buffer returns the open buffer of the file and its group,
+// preferring the current group, or nil if the file is not open.
+func (g *gotoBar) buffer(filename string) (*EditorGroup, *Editor) {
+	if filename == "" || sameFile(recentE.editor.filename, filename) {
+		return recentE, recentE.editor
+	}
+	groups := g.groups()
+	if i := slices.Index(groups, recentE); i > 0 {
+		groups = slices.Concat(groups[i:i+1], groups[:i], groups[i+1:])
+	}
+	for _, group := range groups {
+		if e := findBuffer(group.all, filename); e != nil {
+			return group, e
+		}
+	}
+	return nil, nil
+}
+
+// preview shows the target in its buffer if it is open, scrolling the editor
+func (g *gotoBar) preview() {
+	g.restore()
+	loc, ok := g.target()
+	if !ok {
+		return
+	}
+	group, e := g.buffer(loc.filename)
+	if e == nil {
+		return
+	}
+	group.show(e)
+	row := max(0, min(loc.cursor.row, len(e.buf)-1))
+	e.cursor = pos{row, max(0, min(loc.cursor.col, len(e.buf[row])))}
+	e.top = max(1, row+1-e.PageSize()/2)
+}
+
+// restore puts the editors back as they were before the preview
+func (g *gotoBar) restore() {
+	for _, s := range g.saved {
+		s.editor.cursor = s.cursor
+		s.editor.top = s.top
+		if s.shown {
+			s.group.show(s.editor)
+		}
+	}
+}
+
+var fileLineRe = regexp.MustCompile(`^(.+?):\d+(?::\d+)?$`)
+
+// splitFileLine splits "file:line[:column]" into the file and the cursor
+func splitFileLine(s string) (name string, cursor pos, ok bool) {
+	m := fileLineRe.FindStringSubmatch(s)
+	if m == nil {
+		return "", pos{}, false
+	}
+	cursor, ok = parseLine(s[len(m[1])+1:])
+	return m[1], cursor, ok
+}
+
+// parseLine converts "line[:column]" counted from 1 to the cursor
+func parseLine(s string) (pos, bool) {
+	line, column, found := strings.Cut(s, ":")
+	row, err := strconv.Atoi(line)
+	if err != nil || row < 1 {
+		return pos{}, false
+	}
+	col := 1
+	if found {
+		if col, err = strconv.Atoi(column); err != nil || col < 1 {
+			return pos{}, false
+		}
+	}
+	return pos{row - 1, col - 1}, true
+}
+
+// rank returns the indices of the names matching the pattern fuzzily, the better
+// ones first, and the indices of their matched runes. bonus adds to the score of
+// the name at the index, it may be nil. All the names match an empty pattern, in order.
+func rank(pattern string, names []string, bonus func(i int) int) (order []int, matched [][]int) {
+	type option struct {
+		index   int
+		score   int
+		matched []int
+	}
+	var options []option
+	f := newFuzzyMatcher(pattern)
+	for i, name := range names {
+		score, m, ok := f.match(name)
+		if !ok {
 			continue
 		}
-		files = append(files, d.Name())
+		if bonus != nil {
+			score += bonus(i)
+		}
+		options = append(options, option{i, score, m})
+	}
+	if pattern != "" {
+		slices.SortStableFunc(options, func(a, b option) int {
+			if c := cmp.Compare(b.score, a.score); c != 0 {
+				return c
+			}
+			// the shorter name, such as the file not in a subdirectory
+			if c := cmp.Compare(len(names[a.index]), len(names[b.index])); c != 0 {
+				return c
+			}
+			return cmp.Compare(names[a.index], names[b.index])
+		})
+	}
+	order = make([]int, len(options))
+	matched = make([][]int, len(options))
+	for i, o := range options {
+		order[i], matched[i] = o.index, o.matched
+	}
+	return order, matched
+}
+
+// matchFiles returns the files matching the pattern fuzzily, the better ones
+// and the recently opened ones first, with the indices of matched runes.
+func matchFiles(pattern string, files []string) ([]string, [][]int) {
+	order, matched := rank(pattern, files, func(i int) int {
+		if recentFiles.opened[files[i]] > 0 {
+			return bonusRecent
+		}
+		return 0
+	})
+	names := make([]string, len(order))
+	for i, j := range order {
+		names[i] = files[j]
+	}
+	return names, matched
+}
+
+// absName returns the absolute name of the file, or the name as is on error
+func absName(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filename
+}
+
+// projectFiles is the files of the working directory, for the goto bar
+var projectFiles = newFileIndex(".")
+
+// fileHistory records the files opened, for boosting them in the goto bar
+type fileHistory struct {
+	clock  int
+	opened map[string]int // by the path relative to the working directory, the larger the more recent
+}
+
+var recentFiles = &fileHistory{opened: make(map[string]int)}
+
+// add records the file is opened
+func (h *fileHistory) add(name string) {
+	h.clock++
+	h.opened[relativeName(absName(name))] = h.clock
+}
+
+// list returns the files opened, the most recent first
+func (h *fileHistory) list() []string {
+	names := make([]string, 0, len(h.opened))
+	for name := range h.opened {
+		names = append(names, name)
 	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Compare(h.opened[b], h.opened[a])
+	})
+	return names
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestMatchFiles(t *testing.T) {
+	defer func(h *fileHistory) { recentFiles = h }(recentFiles)
+	recentFiles = &fileHistory{opened: make(map[string]int)}
+
+	files := []string{"README.md", "cmd/editor/main.go", "editor.go", "editor_test.go", "main.go"}
+	got, matched := matchFiles("edgo", files)
+	want := []string{"editor.go", "editor_test.go", "cmd/editor/main.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("matchFiles = %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(matched[0], []int{0, 1, 7, 8}) {
+		t.Errorf("matched = %v, want [0 1 7 8]", matched[0])
+	}
+
+	// the recently opened file is boosted
+	recentFiles.add("cmd/editor/main.go")
+	got, _ = matchFiles("main", files)
+	if want := []string{"cmd/editor/main.go", "main.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("matchFiles with recent = %q, want %q", got, want)
+	}
+}
+
+func TestGotoBarMove(t *testing.T) {
+	g := &gotoBar{options: make([]string, 20)}
+	g.move(-1)
+	if g.index != 19 || g.top != 20-maxGotoOptions {
+		t.Errorf("move(-1) from the first: index %d top %d, want 19 %d", g.index, g.top, 20-maxGotoOptions)
+	}
+	g.move(1)
+	if g.index != 0 || g.top != 0 {
+		t.Errorf("move(1) from the last: index %d top %d, want 0 0", g.index, g.top)
+	}
+	g.move(maxGotoOptions)
+	if g.index != maxGotoOptions || g.top != 1 {
+		t.Errorf("move(%d): index %d top %d, want %d 1", maxGotoOptions, g.index, g.top, maxGotoOptions)
+	}
+}
+
+func TestSplitFileLine(t *testing.T) {
+	tests := []struct {
+		s      string
+		name   string
+		cursor pos
+		ok     bool
+	}{
+		{"main.go:12", "main.go", pos{11, 0}, true},
+		{"main.go:12:5", "main.go", pos{11, 4}, true},
+		{"a:b.go:3", "a:b.go", pos{2, 0}, true},
+		{"main.go", "", pos{}, false},
+		{"main.go:", "", pos{}, false},
+		{"main.go:0", "main.go", pos{}, false},
+		{":12", "", pos{}, false},
+	}
+	for _, tt := range tests {
+		name, cursor, ok := splitFileLine(tt.s)
+		if name != tt.name || cursor != tt.cursor || ok != tt.ok {
+			t.Errorf("splitFileLine(%q) = %q, %v, %v, want %q, %v, %v", tt.s, name, cursor, ok, tt.name, tt.cursor, tt.ok)
+		}
+	}
+}
+
+func TestGotoPreview(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, name := range []string{a, b} {
+		if err := os.WriteFile(name, []byte(strings.Repeat("line\n", 100)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := NewEditorGroup(screen, BindStr("", nil))
+	g.SetPos(0, 0, 80, 24)
+	g.Open(a)
+	g.Open(b)
+	g.editor.cursor = pos{3, 1}
+	defer func(e *EditorGroup) { recentE = e }(recentE)
+	recentE = g
+
+	gb := newGotoBar(screen, func() []*EditorGroup { return []*EditorGroup{g} })
+	gb.open(":50:3")
+	if g.editor.cursor != (pos{49, 2}) || g.editor.top > 50 {
+		t.Errorf("preview of the line: cursor %v top %d", g.editor.cursor, g.editor.top)
+	}
+	gb.restore()
+	if g.editor.cursor != (pos{3, 1}) || g.editor.top != 1 {
+		t.Errorf("after restore: cursor %v top %d, want {3 1} 1", g.editor.cursor, g.editor.top)
+	}
+
+	// the other buffer is shown while selected
+	gb.open("%a.txt")
+	if g.editor.filename != a {
+		t.Fatalf("preview of the buffer: %s, want %s", g.editor.filename, a)
+	}
+	gb.restore()
+	if g.editor.filename != b || g.titleBar.names[g.titleBar.i] != b {
+		t.Errorf("after restore: %s, want %s", g.editor.filename, b)
+	}
+}
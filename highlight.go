@@ -0,0 +1,130 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A Lexer parses a line of source starting in the given state,
+// and returns the tokens and the state at the end of line.
+// The state carries multi-line constructs such as block comments,
+// it is stateNone at the beginning of the buffer.
+type Lexer interface {
+	Lex(line []rune, state int) ([]tokenInfo, int)
+}
+
+// lexFunc adapts a function to the Lexer interface
+type lexFunc func(line []rune, state int) ([]tokenInfo, int)
+
+func (f lexFunc) Lex(line []rune, state int) ([]tokenInfo, int) { return f(line, state) }
+
+type language struct {
+	name       string
+	extensions []string // such as ".go"
+	filenames  []string // such as "Makefile"
+	shebangs   []string // interpreters such as "python3"
+	lexer      Lexer
+}
+
+// languages known to the editor, the first match wins
+var languages = []*language{
+	{name: "go", extensions: []string{".go"}, lexer: lexFunc(lexGo)},
+	{name: "markdown", extensions: []string{".md", ".markdown"}, lexer: lexFunc(lexMarkdown)},
+	{name: "yaml", extensions: []string{".yaml", ".yml"}, lexer: lexFunc(lexYAML)},
+	{name: "json", extensions: []string{".json"}, lexer: lexFunc(lexJSON)},
+	{
+		name:       "shell",
+		extensions: []string{".sh", ".bash", ".zsh"},
+		filenames:  []string{".bashrc", ".bash_profile", ".profile", ".zshrc"},
+		shebangs:   []string{"sh", "bash", "zsh", "ksh", "dash"},
+		lexer:      shellLexer,
+	},
+	{
+		name:       "dockerfile",
+		extensions: []string{".dockerfile"},
+		filenames:  []string{"Dockerfile", "Containerfile"},
+		lexer:      dockerfileLexer,
+	},
+	{name: "sql", extensions: []string{".sql"}, lexer: sqlLexer},
+	{
+		name:       "python",
+		extensions: []string{".py"},
+		shebangs:   []string{"python", "python3"},
+		lexer:      pythonLexer,
+	},
+	{
+		name:       "makefile",
+		extensions: []string{".mk"},
+		filenames:  []string{"Makefile", "makefile", "GNUmakefile"},
+		lexer:      lexFunc(lexMakefile),
+	},
+}
+
+func languageByName(name string) *language {
+	for _, l := range languages {
+		if l.name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+// detectLanguage detects language by the file name,
+// then by the shebang in the first line. It returns nil for plain text.
+func detectLanguage(filename string, firstLine []rune) *language {
+	base := filepath.Base(filename)
+	for _, l := range languages {
+		if slices.Contains(l.filenames, base) {
+			return l
+		}
+	}
+	// such as Dockerfile.dev
+	for _, l := range languages {
+		for _, name := range l.filenames {
+			if strings.HasPrefix(base, name+".") {
+				return l
+			}
+		}
+	}
+	ext := filepath.Ext(base)
+	for _, l := range languages {
+		if slices.Contains(l.extensions, ext) {
+			return l
+		}
+	}
+
+	interpreter := shebang(string(firstLine))
+	if interpreter == "" {
+		return nil
+	}
+	for _, l := range languages {
+		if slices.Contains(l.shebangs, interpreter) {
+			return l
+		}
+	}
+	return nil
+}
+
+// return the interpreter name of shebang line, such as
+// "#!/bin/bash" and "#!/usr/bin/env python3"
+func shebang(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+	name := filepath.Base(fields[0])
+	if name == "env" {
+		// skip options of env, such as "-S"
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				return f
+			}
+		}
+		return ""
+	}
+	return name
+}
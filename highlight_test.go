@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		filename  string
+		firstLine string
+		want      string
+	}{
+		{filename: "main.go", want: "go"},
+		{filename: "docs/README.md", want: "markdown"},
+		{filename: "ci.yml", want: "yaml"},
+		{filename: "package.json", want: "json"},
+		{filename: "build.sh", want: "shell"},
+		{filename: "Dockerfile", want: "dockerfile"},
+		{filename: "Dockerfile.dev", want: "dockerfile"},
+		{filename: "schema.sql", want: "sql"},
+		{filename: "Makefile", want: "makefile"},
+		{filename: "run", firstLine: "#!/usr/bin/env python3", want: "python"},
+		{filename: "deploy", firstLine: "#!/bin/bash -e", want: "shell"},
+		{filename: "notes.txt", want: ""},
+	}
+	for _, tt := range tests {
+		var got string
+		if lang := detectLanguage(tt.filename, []rune(tt.firstLine)); lang != nil {
+			got = lang.name
+		}
+		if got != tt.want {
+			t.Errorf("detectLanguage(%q, %q) = %q, want %q", tt.filename, tt.firstLine, got, tt.want)
+		}
+	}
+}
+
+// return tokens of the line as "text:class"
+func lexTokens(lex Lexer, line string, state int) ([]string, int) {
+	runes := []rune(line)
+	tokens, state := lex.Lex(runes, state)
+	var s []string
+	for _, t := range tokens {
+		s = append(s, fmt.Sprintf("%s:%s", string(runes[t.off:t.off+t.len]), t.class))
+	}
+	return s, state
+}
+
+func TestLexers(t *testing.T) {
+	tests := []struct {
+		lang      string
+		line      string
+		state     int
+		want      []string
+		wantState int
+	}{
+		{
+			lang: "shell",
+			line: `if [ "$1" = x ]; then echo ${HOME} # done`,
+			want: []string{"if:keyword", `"$1":str`, "=:operator", "x:", ";:operator", "then:keyword", "echo:funcbuiltin", "${HOME}:constant", "# done:comment"},
+		},
+		{
+			lang:      "python",
+			line:      `def f(x=None): return """doc`,
+			want:      []string{"def:keyword", "f:func", "x:", "=:operator", "None:constant", "return:keyword", `"""doc:str`},
+			wantState: stateLongString,
+		},
+		{
+			lang:  "python",
+			line:  `end""" + 'a'`,
+			state: stateLongString,
+			want:  []string{`end""":str`, "+:operator", "'a':str"},
+		},
+		{
+			lang: "sql",
+			line: `SELECT count(*) FROM t WHERE id = 1 -- one`,
+			want: []string{"SELECT:keyword", "count:funcbuiltin", "*:operator", "FROM:keyword", "t:", "WHERE:keyword", "id:", "=:operator", "1:int", "-- one:comment"},
+		},
+		{
+			lang:      "sql",
+			line:      `x /* multi`,
+			want:      []string{"x:", "/* multi:comment"},
+			wantState: stateBlockComment,
+		},
+		{
+			lang: "dockerfile",
+			line: `RUN go build -o /bin/app $DIR`,
+			want: []string{"RUN:keyword", "go:", "build:", "o:", "bin:", "app:", "$DIR:constant"},
+		},
+		{
+			lang: "makefile",
+			line: `build: $(SRC) # compile`,
+			want: []string{"build:func", "::operator", "$(SRC):constant", "# compile:comment"},
+		},
+		{
+			lang: "makefile",
+			line: `CC := gcc`,
+			want: []string{"CC:", ":=:operator", "gcc:"},
+		},
+		{
+			lang: "json",
+			line: `{"name": "jo", "n": 1.5, "ok": true}`,
+			want: []string{`"name":type`, `"jo":str`, `"n":type`, "1.5:float", `"ok":type`, "true:constant"},
+		},
+		{
+			lang: "yaml",
+			line: `  - name: "build" # step`,
+			want: []string{"-:operator", "name:type", `"build":str`, "# step:comment"},
+		},
+		{
+			lang: "yaml",
+			line: `enabled: yes`,
+			want: []string{"enabled:type", "yes:constant"},
+		},
+		{
+			lang: "markdown",
+			line: "## Title",
+			want: []string{"## Title:keyword"},
+		},
+		{
+			lang: "markdown",
+			line: "- see `code` and [link](http://x)",
+			want: []string{"-:operator", "`code`:str", "[link](http://x):func"},
+		},
+		{
+			lang:      "markdown",
+			line:      "```go",
+			want:      []string{"```go:str"},
+			wantState: stateRawString,
+		},
+		{
+			lang:      "markdown",
+			line:      "# not a heading",
+			state:     stateRawString,
+			want:      []string{"# not a heading:str"},
+			wantState: stateRawString,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+" "+tt.line, func(t *testing.T) {
+			got, state := lexTokens(languageByName(tt.lang).lexer, tt.line, tt.state)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if state != tt.wantState {
+				t.Errorf("state = %d, want %d", state, tt.wantState)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ignoreRule is a pattern of a .gitignore file
+type ignoreRule struct {
+	base    string // the directory of the .gitignore
+	re      *regexp.Regexp
+	negate  bool // re-include the matched path
+	dirOnly bool // the pattern ends with a slash
+}
+
+// parseIgnore returns the rules of the .gitignore in the directory base,
+// the invalid patterns are skipped.
+func parseIgnore(base string, data []byte) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		r := ignoreRule{base: base}
+		if line[0] == '!' {
+			r.negate = true
+			line = line[1:]
+		} else if line[0] == '\\' && len(line) > 1 && (line[1] == '#' || line[1] == '!') {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		re, err := compileIgnore(line)
+		if err != nil {
+			continue
+		}
+		r.re = re
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// compileIgnore converts the gitignore pattern to a regular expression matching
+// the slash separated path relative to the .gitignore. A pattern with a slash
+// is anchored to the directory, otherwise it matches a name at any depth.
+func compileIgnore(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**") && (i == 0 || pattern[i-1] == '/') {
+				// "**/" matches any directories, and the trailing "/**" everything inside
+				if i+2 == len(pattern) {
+					b.WriteString(".*")
+					i++
+					continue
+				}
+				if pattern[i+2] == '/' {
+					b.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(pattern[i+1:], ']')
+			if j < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// ignored reports whether the path is ignored by the rules, the later ones take precedence
+func ignored(rules []ignoreRule, path string, dir bool) bool {
+	ignore := false
+	for _, r := range rules {
+		if r.dirOnly && !dir {
+			continue
+		}
+		rel, err := filepath.Rel(r.base, path)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		if r.re.MatchString(filepath.ToSlash(rel)) {
+			ignore = !r.negate
+		}
+	}
+	return ignore
+}
+
+// excludeRules returns the rules of the exclude patterns in config,
+// they are in the syntax of .gitignore and apply to the whole project.
+func excludeRules(root string) []ignoreRule {
+	return parseIgnore(root, []byte(strings.Join(config.Exclude, "\n")))
+}
+
+// walkProject calls visit for the regular files under root in lexical order,
+// skipping .git, the excluded paths in config and the paths ignored by the
+// .gitignore files. It stops when ctx is done or visit returns an error.
+func walkProject(ctx context.Context, root string, visit func(path string) error) error {
+	return walkTree(ctx, root, excludeRules(root), nil, visit)
+}
+
+// walkTree is walkProject with the rules of the parent directories of root,
+// it calls dir for every directory walked, with the rules of its entries.
+func walkTree(ctx context.Context, root string, base []ignoreRule, dir func(path string, rules []ignoreRule), visit func(path string) error) error {
+	// the rules of every directory, including the ones of its parents
+	rules := make(map[string][]ignoreRule)
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			// such as permission denied, skip it
+			if d != nil && d.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		parent := base
+		if path != root {
+			parent = rules[filepath.Dir(path)]
+			if d.Name() == ".git" || ignored(parent, path, d.IsDir()) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+		}
+		if d.IsDir() {
+			r := dirRules(path, parent)
+			rules[path] = r
+			if dir != nil {
+				dir(path, r)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return visit(path)
+	})
+}
+
+// dirRules returns the rules of the entries in the directory,
+// the ones of its parents followed by its .gitignore.
+func dirRules(path string, parent []ignoreRule) []ignoreRule {
+	data, err := os.ReadFile(filepath.Join(path, ".gitignore"))
+	if err != nil {
+		return parent
+	}
+	return append(slices.Clip(parent), parseIgnore(path, data)...)
+}
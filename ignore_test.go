@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompileIgnore(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.log", "a.log", true},
+		{"*.log", "sub/a.log", true},
+		{"*.log", "a.logs", false},
+		{"/build", "build", true},
+		{"/build", "sub/build", false},
+		{"doc/*.md", "doc/a.md", true},
+		{"doc/*.md", "doc/sub/a.md", false},
+		{"**/testdata", "a/b/testdata", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**", "a/x/y", true},
+		{"file?.[ch]", "file1.c", true},
+		{"file?.[!ch]", "file1.c", false},
+	}
+	for _, tt := range tests {
+		re, err := compileIgnore(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("%q matches %q: %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWalkProject(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":       "*.log\n/out/\n# comment\nvendor\n",
+		"a.go":             "",
+		"a.log":            "",
+		"out/b.go":         "",
+		"sub/out/c.go":     "",
+		"sub/.gitignore":   "!keep.log\n",
+		"sub/keep.log":     "",
+		"sub/drop.log.txt": "",
+		"vendor/d.go":      "",
+		".git/config":      "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	err := walkProject(context.Background(), dir, func(path string) error {
+		rel, _ := filepath.Rel(dir, path)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".gitignore", "a.go", "sub/.gitignore", "sub/drop.log.txt", "sub/keep.log", "sub/out/c.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// organizeImports removes the unused imports of the Go source, adds the missing
+// ones from the standard library, and groups them with the standard library first.
+// The source is unchanged if it has cgo or comments among the imports not attached to them.
+func organizeImports(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, imp := range f.Imports {
+		if importPath(imp) == "C" {
+			return src, nil
+		}
+	}
+
+	// the names selected from the identifiers not declared in the file,
+	// such as "Println" of fmt.Println
+	selected := make(map[string]map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+			if selected[x.Name] == nil {
+				selected[x.Name] = make(map[string]bool)
+			}
+			selected[x.Name][sel.Sel.Name] = true
+		}
+		return true
+	})
+
+	dir := filepath.Dir(filename)
+	var specs []*ast.ImportSpec
+	imported := make(map[string]bool)
+	for _, imp := range f.Imports {
+		name := importName(imp, dir, selected)
+		if name == "_" || name == "." || selected[name] != nil {
+			specs = append(specs, imp)
+			imported[name] = true
+		}
+	}
+	declared := packageDecls(filename, f.Name.Name)
+	var names []string
+	for name := range selected {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if imported[name] || declared[name] {
+			continue
+		}
+		if path := findStdPackage(name, selected[name]); path != "" {
+			specs = append(specs, &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}})
+		}
+	}
+
+	// the imports are replaced as a whole
+	if len(f.Imports) == 0 && len(specs) == 0 {
+		return src, nil
+	}
+	var decls []*ast.GenDecl
+	for _, d := range f.Decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			decls = append(decls, d)
+		}
+	}
+	file := fset.File(f.Pos())
+	var start, end int
+	if len(decls) > 0 {
+		start = file.Offset(decls[0].Pos())
+		end = file.Offset(decls[len(decls)-1].End())
+		attached := make(map[*ast.CommentGroup]bool)
+		for _, imp := range f.Imports {
+			attached[imp.Doc] = true
+			attached[imp.Comment] = true
+		}
+		for _, c := range f.Comments {
+			if file.Offset(c.Pos()) >= start && file.Offset(c.End()) <= end && !attached[c] {
+				return src, nil
+			}
+		}
+	} else {
+		// after the package clause
+		start = file.Offset(f.Name.End())
+		if i := bytes.IndexByte(src[start:], '\n'); i >= 0 {
+			start += i
+		} else {
+			start = len(src)
+		}
+		end = start
+	}
+
+	var b bytes.Buffer
+	b.Write(bytes.TrimRight(src[:start], "\n"))
+	b.WriteString("\n\n")
+	if len(specs) > 0 {
+		b.WriteString(formatImports(specs))
+		b.WriteString("\n\n")
+	}
+	b.Write(bytes.TrimLeft(src[end:], "\n"))
+	return b.Bytes(), nil
+}
+
+// formatImports formats the import declaration, the standard library
+// is grouped before the others, each group is sorted by path.
+func formatImports(specs []*ast.ImportSpec) string {
+	var std, others []*ast.ImportSpec
+	for _, spec := range specs {
+		if isStdPath(importPath(spec)) {
+			std = append(std, spec)
+		} else {
+			others = append(others, spec)
+		}
+	}
+	line := func(spec *ast.ImportSpec) string {
+		var b strings.Builder
+		if spec.Doc != nil {
+			for _, c := range spec.Doc.List {
+				b.WriteString(c.Text + "\n")
+			}
+		}
+		if spec.Name != nil {
+			b.WriteString(spec.Name.Name + " ")
+		}
+		b.WriteString(spec.Path.Value)
+		if spec.Comment != nil {
+			for _, c := range spec.Comment.List {
+				b.WriteString(" " + c.Text)
+			}
+		}
+		return b.String()
+	}
+	if len(specs) == 1 && specs[0].Doc == nil {
+		return "import " + line(specs[0])
+	}
+
+	var groups []string
+	for _, group := range [][]*ast.ImportSpec{std, others} {
+		if len(group) == 0 {
+			continue
+		}
+		slices.SortStableFunc(group, func(a, b *ast.ImportSpec) int {
+			return strings.Compare(importPath(a), importPath(b))
+		})
+		var lines []string
+		for i, spec := range group {
+			// duplicates
+			if i > 0 && importPath(group[i-1]) == importPath(spec) && group[i-1].Name.String() == spec.Name.String() {
+				continue
+			}
+			lines = append(lines, "\t"+strings.ReplaceAll(line(spec), "\n", "\n\t"))
+		}
+		groups = append(groups, strings.Join(lines, "\n"))
+	}
+	return "import (\n" + strings.Join(groups, "\n\n") + "\n)"
+}
+
+func importPath(spec *ast.ImportSpec) string {
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// isStdPath reports whether the import path is of the standard library,
+// whose first element has no dot.
+func isStdPath(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// importName returns the name the import is referred by. The name of a module
+// package is assumed from the path, and looked up if it is not selected.
+func importName(spec *ast.ImportSpec, dir string, selected map[string]map[string]bool) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	path := importPath(spec)
+	name := assumedName(path)
+	if isStdPath(path) || selected[name] != nil {
+		return name
+	}
+	if p, err := build.Default.Import(path, dir, 0); err == nil && p.Name != "" {
+		return p.Name
+	}
+	return name
+}
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// assumedName returns the package name assumed from the import path, such as
+// "yaml" for "gopkg.in/yaml.v3", and "rand" for "math/rand/v2".
+func assumedName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if majorVersion.MatchString(name) && len(elems) > 1 {
+		name = elems[len(elems)-2]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	if i := strings.IndexFunc(name, func(r rune) bool {
+		return !isWordRune(r)
+	}); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// packageDecls returns the top-level names declared in the files of the package
+// in the directory of the file, other than the file itself.
+func packageDecls(filename, pkgName string) map[string]bool {
+	declared := make(map[string]bool)
+	dir := filepath.Dir(filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return declared
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || sameFile(path, filename) {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.SkipObjectResolution)
+		if err != nil || f.Name.Name != pkgName {
+			continue
+		}
+		for name := range topLevelNames(f) {
+			declared[name] = true
+		}
+	}
+	return declared
+}
+
+// topLevelNames returns the names of the package-level declarations of the file
+func topLevelNames(f *ast.File) map[string]bool {
+	names := make(map[string]bool)
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				names[d.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names[spec.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, id := range spec.Names {
+						names[id.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// findStdPackage returns the path of the standard library package with the name,
+// exporting all the selected names, or "" if there is none. The shorter path is
+// preferred, such as "math/rand" over "crypto/rand".
+func findStdPackage(name string, selected map[string]bool) string {
+	stdIndex.once.Do(indexStd)
+	for _, path := range stdIndex.paths[name] {
+		exports := stdExports(path)
+		ok := true
+		for s := range selected {
+			if !exports[s] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// simpleLexer highlights the languages made of words, literals, comments
+// and operators, the differences are described by its fields.
+type simpleLexer struct {
+	lineComments []string  // such as "#" and "--"
+	blockComment [2]string // start and end, such as "/*" and "*/"
+	longStrings  []string  // multi-line string delimiters, such as `"""`
+	quotes       string    // string delimiters in a line
+	operators    string
+	ignoreCase   bool // keywords are case-insensitive
+	variables    bool // $name, ${name} and $(name)
+	firstWord    bool // keywords are recognized only at the beginning of line
+
+	keywords  []string
+	types     []string
+	constants []string
+	builtins  []string // builtin functions
+}
+
+func (l *simpleLexer) Lex(line []rune, state int) ([]tokenInfo, int) {
+	var tokens []tokenInfo
+	add := func(class string, start, end int) {
+		tokens = append(tokens, tokenInfo{class: class, off: start, len: end - start})
+	}
+
+	var i int
+	// continue the multi-line construct
+	switch {
+	case state == stateBlockComment:
+		end := indexFrom(line, 0, l.blockComment[1])
+		if end < 0 {
+			add(tcComment, 0, len(line))
+			return tokens, state
+		}
+		i = end + len([]rune(l.blockComment[1]))
+		add(tcComment, 0, i)
+	case state >= stateLongString:
+		delim := l.longStrings[state-stateLongString]
+		end := indexFrom(line, 0, delim)
+		if end < 0 {
+			add(tcString, 0, len(line))
+			return tokens, state
+		}
+		i = end + len([]rune(delim))
+		add(tcString, 0, i)
+	}
+
+	firstWord := true
+	for i < len(line) {
+		c := line[i]
+		if unicode.IsSpace(c) {
+			i++
+			continue
+		}
+
+		if l.variables && c == '$' && i+1 < len(line) {
+			end := variableEnd(line, i)
+			add(tcConstant, i, end)
+			i = end
+			firstWord = false
+			continue
+		}
+
+		if slices.ContainsFunc(l.lineComments, func(s string) bool { return hasPrefixAt(line, i, s) }) {
+			add(tcComment, i, len(line))
+			return tokens, stateNone
+		}
+
+		if l.blockComment[0] != "" && hasPrefixAt(line, i, l.blockComment[0]) {
+			start := i
+			i += len([]rune(l.blockComment[0]))
+			end := indexFrom(line, i, l.blockComment[1])
+			if end < 0 {
+				add(tcComment, start, len(line))
+				return tokens, stateBlockComment
+			}
+			i = end + len([]rune(l.blockComment[1]))
+			add(tcComment, start, i)
+			continue
+		}
+
+		if k := slices.IndexFunc(l.longStrings, func(s string) bool { return hasPrefixAt(line, i, s) }); k >= 0 {
+			delim := l.longStrings[k]
+			start := i
+			i += len([]rune(delim))
+			end := indexFrom(line, i, delim)
+			if end < 0 {
+				add(tcString, start, len(line))
+				return tokens, stateLongString + k
+			}
+			i = end + len([]rune(delim))
+			add(tcString, start, i)
+			continue
+		}
+
+		if strings.ContainsRune(l.quotes, c) {
+			end := quoteEnd(line, i)
+			add(tcString, i, end)
+			i = end
+			firstWord = false
+			continue
+		}
+
+		if unicode.IsDigit(c) {
+			start := i
+			for i < len(line) && (isWordRune(line[i]) || line[i] == '.') {
+				i++
+			}
+			if slices.Contains(line[start:i], '.') {
+				add(tcFloat, start, i)
+			} else {
+				add(tcInt, start, i)
+			}
+			firstWord = false
+			continue
+		}
+
+		if isWordRune(c) {
+			start := i
+			for i < len(line) && isWordRune(line[i]) {
+				i++
+			}
+			add(l.classify(line, start, i, firstWord), start, i)
+			firstWord = false
+			continue
+		}
+
+		if strings.ContainsRune(l.operators, c) {
+			start := i
+			for i < len(line) && strings.ContainsRune(l.operators, line[i]) {
+				i++
+			}
+			add(tcOperator, start, i)
+			firstWord = false
+			continue
+		}
+
+		// punctuation
+		i++
+		firstWord = false
+	}
+	return tokens, stateNone
+}
+
+// classify the word line[start:end]
+func (l *simpleLexer) classify(line []rune, start, end int, firstWord bool) string {
+	word := string(line[start:end])
+	if l.ignoreCase {
+		word = strings.ToLower(word)
+	}
+	if !l.firstWord || firstWord {
+		if slices.Contains(l.keywords, word) {
+			return tcKeyword
+		}
+	}
+	switch {
+	case slices.Contains(l.types, word):
+		return tcType
+	case slices.Contains(l.constants, word):
+		return tcConstant
+	}
+	// followed by a parenthesis
+	next := end
+	for next < len(line) && line[next] == ' ' {
+		next++
+	}
+	if next < len(line) && line[next] == '(' {
+		if slices.Contains(l.builtins, word) {
+			return tcFuncBuiltin
+		}
+		return tcFunction
+	}
+	if slices.Contains(l.builtins, word) {
+		return tcFuncBuiltin
+	}
+	return ""
+}
+
+func isWordRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// reports whether line[i:] starts with s
+func hasPrefixAt(line []rune, i int, s string) bool {
+	for _, c := range s {
+		if i >= len(line) || line[i] != c {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// return the index of s in line[i:], relative to line, or -1
+func indexFrom(line []rune, i int, s string) int {
+	for ; i < len(line); i++ {
+		if hasPrefixAt(line, i, s) {
+			return i
+		}
+	}
+	return -1
+}
+
+// return the index after the closing quote of the string starting at i,
+// or the end of line if it is unterminated.
+func quoteEnd(line []rune, i int) int {
+	quote := line[i]
+	for j := i + 1; j < len(line); j++ {
+		if line[j] == '\\' {
+			j++
+			continue
+		}
+		if line[j] == quote {
+			return j + 1
+		}
+	}
+	return len(line)
+}
+
+// return the index after the variable starting with '$' at i
+func variableEnd(line []rune, i int) int {
+	j := i + 1
+	if line[j] == '{' || line[j] == '(' {
+		closing := '}'
+		if line[j] == '(' {
+			closing = ')'
+		}
+		for ; j < len(line); j++ {
+			if line[j] == closing {
+				return j + 1
+			}
+		}
+		return len(line)
+	}
+	if !isWordRune(line[j]) {
+		// special parameters, such as $@ and $?
+		return j + 1
+	}
+	for j < len(line) && isWordRune(line[j]) {
+		j++
+	}
+	return j
+}
+
+var shellLexer = &simpleLexer{
+	lineComments: []string{"#"},
+	quotes:       "\"'`",
+	operators:    "|&;<>=!",
+	variables:    true,
+	keywords: []string{
+		"if", "then", "else", "elif", "fi", "for", "while", "until", "do", "done",
+		"case", "esac", "in", "function", "select", "time", "return", "break",
+		"continue", "export", "local", "readonly", "declare", "unset", "shift",
+	},
+	constants: []string{"true", "false"},
+	builtins: []string{
+		"echo", "printf", "read", "cd", "pwd", "source", "test", "exit", "exec",
+		"eval", "set", "trap", "wait", "alias", "type", "command",
+	},
+}
+
+var dockerfileLexer = &simpleLexer{
+	lineComments: []string{"#"},
+	quotes:       "\"'",
+	operators:    "=&|\\",
+	variables:    true,
+	ignoreCase:   true,
+	firstWord:    true,
+	keywords: []string{
+		"from", "as", "run", "cmd", "label", "maintainer", "expose", "env", "add",
+		"copy", "entrypoint", "volume", "user", "workdir", "arg", "onbuild",
+		"stopsignal", "healthcheck", "shell",
+	},
+}
+
+var sqlLexer = &simpleLexer{
+	lineComments: []string{"--"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes:       "'\"",
+	operators:    "=<>!+-*/%|",
+	ignoreCase:   true,
+	keywords: []string{
+		"select", "from", "where", "insert", "into", "values", "update", "set",
+		"delete", "create", "table", "alter", "drop", "index", "view", "join",
+		"inner", "left", "right", "outer", "full", "cross", "on", "group", "by",
+		"order", "having", "limit", "offset", "as", "and", "or", "not", "in",
+		"is", "like", "between", "exists", "distinct", "union", "all", "case",
+		"when", "then", "else", "end", "primary", "key", "foreign", "references",
+		"default", "unique", "constraint", "begin", "commit", "rollback", "with",
+		"returning", "asc", "desc", "if", "database", "grant", "revoke",
+	},
+	types: []string{
+		"int", "integer", "smallint", "bigint", "serial", "bigserial", "decimal",
+		"numeric", "real", "float", "double", "char", "varchar", "text", "boolean",
+		"bool", "date", "time", "timestamp", "timestamptz", "interval", "blob",
+		"json", "jsonb", "uuid",
+	},
+	constants: []string{"null", "true", "false"},
+	builtins: []string{
+		"count", "sum", "avg", "min", "max", "coalesce", "nullif", "now",
+		"lower", "upper", "length", "substring", "trim", "cast", "round",
+	},
+}
+
+var pythonLexer = &simpleLexer{
+	lineComments: []string{"#"},
+	longStrings:  []string{`"""`, `'''`},
+	quotes:       "\"'",
+	operators:    "=+-*/%<>!&|^~@",
+	keywords: []string{
+		"and", "as", "assert", "async", "await", "break", "class", "continue",
+		"def", "del", "elif", "else", "except", "finally", "for", "from",
+		"global", "if", "import", "in", "is", "lambda", "nonlocal", "not", "or",
+		"pass", "raise", "return", "try", "while", "with", "yield", "match", "case",
+	},
+	types: []string{
+		"int", "float", "complex", "str", "bytes", "bool", "list", "tuple",
+		"dict", "set", "frozenset", "object", "type",
+	},
+	constants: []string{"None", "True", "False"},
+	builtins: []string{
+		"print", "len", "range", "enumerate", "zip", "map", "filter", "sorted",
+		"reversed", "open", "isinstance", "getattr", "setattr", "hasattr",
+		"super", "abs", "min", "max", "sum", "any", "all", "iter", "next", "repr",
+	},
+}
+
+var makefileLexer = &simpleLexer{
+	lineComments: []string{"#"},
+	quotes:       "\"'",
+	operators:    "=:?+!|",
+	variables:    true,
+	firstWord:    true,
+	keywords: []string{
+		"ifeq", "ifneq", "ifdef", "ifndef", "else", "endif", "include",
+		"-include", "sinclude", "define", "endef", "export", "unexport",
+		"override", "vpath",
+	},
+}
+
+// lexMakefile highlights the targets of rules in addition to makefileLexer
+func lexMakefile(line []rune, state int) ([]tokenInfo, int) {
+	tokens, state := makefileLexer.Lex(line, state)
+	if len(line) == 0 || line[0] == '\t' {
+		// recipe
+		return tokens, state
+	}
+	// a rule looks like "target: prerequisites", but not "var := value"
+	colon := slices.Index(line, ':')
+	if colon <= 0 || slices.Contains(line[:colon], '=') || slices.Contains(line[:colon], '#') ||
+		(colon+1 < len(line) && line[colon+1] == '=') {
+		return tokens, state
+	}
+	for i := range tokens {
+		if tokens[i].off < colon && tokens[i].class != tcConstant {
+			tokens[i].class = tcFunction
+		}
+	}
+	return tokens, state
+}
+
+// lexJSON highlights object keys differently from string values
+func lexJSON(line []rune, state int) ([]tokenInfo, int) {
+	var tokens []tokenInfo
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == '"':
+			end := quoteEnd(line, i)
+			class := tcString
+			next := end
+			for next < len(line) && unicode.IsSpace(line[next]) {
+				next++
+			}
+			if next < len(line) && line[next] == ':' {
+				class = tcType
+			}
+			tokens = append(tokens, tokenInfo{class: class, off: i, len: end - i})
+			i = end
+		case c == '-' || unicode.IsDigit(c):
+			start := i
+			i++
+			for i < len(line) && strings.ContainsRune("0123456789.eE+-", line[i]) {
+				i++
+			}
+			class := tcInt
+			if slices.ContainsFunc(line[start:i], func(r rune) bool { return r == '.' || r == 'e' || r == 'E' }) {
+				class = tcFloat
+			}
+			tokens = append(tokens, tokenInfo{class: class, off: start, len: i - start})
+		case unicode.IsLetter(c):
+			start := i
+			for i < len(line) && unicode.IsLetter(line[i]) {
+				i++
+			}
+			var class string
+			if slices.Contains([]string{"true", "false", "null"}, string(line[start:i])) {
+				class = tcConstant
+			}
+			tokens = append(tokens, tokenInfo{class: class, off: start, len: i - start})
+		default:
+			i++
+		}
+	}
+	return tokens, state
+}
+
+// lexYAML highlights keys, scalars and comments, line by line
+func lexYAML(line []rune, state int) ([]tokenInfo, int) {
+	var tokens []tokenInfo
+	add := func(class string, start, end int) {
+		tokens = append(tokens, tokenInfo{class: class, off: start, len: end - start})
+	}
+	s := string(line)
+	if s == "---" || s == "..." {
+		add(tcKeyword, 0, len(line))
+		return tokens, state
+	}
+
+	i := 0
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	// sequence entries
+	for i+1 < len(line) && line[i] == '-' && line[i+1] == ' ' {
+		add(tcOperator, i, i+1)
+		i += 2
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+	}
+	if i < len(line) && line[i] == '-' && i == len(line)-1 {
+		add(tcOperator, i, i+1)
+		return tokens, state
+	}
+
+	// mapping key
+	if k := yamlKeyEnd(line, i); k > i {
+		add(tcType, i, k)
+		i = k + 1
+	}
+
+	for i < len(line) {
+		c := line[i]
+		switch {
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			add(tcComment, i, len(line))
+			return tokens, state
+		case c == '"' || c == '\'':
+			end := quoteEnd(line, i)
+			add(tcString, i, end)
+			i = end
+		case c == '&' || c == '*' || c == '!':
+			// anchor, alias and tag
+			start := i
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			add(tcFunction, start, i)
+		case c == '|' || c == '>':
+			// block scalar
+			add(tcOperator, i, i+1)
+			i++
+		case c != ' ':
+			start := i
+			for i < len(line) && !(line[i] == ' ' && i+1 < len(line) && line[i+1] == '#') {
+				i++
+			}
+			value := strings.TrimSpace(string(line[start:i]))
+			switch {
+			case slices.Contains([]string{"true", "false", "yes", "no", "null", "~"}, strings.ToLower(value)):
+				add(tcConstant, start, start+len([]rune(value)))
+			case isNumber(value):
+				add(tcInt, start, start+len([]rune(value)))
+			}
+		default:
+			i++
+		}
+	}
+	return tokens, state
+}
+
+// return the index of colon after the key starting at i, or -1
+func yamlKeyEnd(line []rune, i int) int {
+	if i >= len(line) || line[i] == '#' || line[i] == '"' || line[i] == '\'' {
+		return -1
+	}
+	for j := i; j < len(line); j++ {
+		if line[j] == ':' && (j+1 == len(line) || line[j+1] == ' ') {
+			return j
+		}
+		if line[j] == ' ' && j+1 < len(line) && line[j+1] == '#' {
+			return -1
+		}
+	}
+	return -1
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !unicode.IsDigit(c) && c != '.' && !(i == 0 && (c == '-' || c == '+')) {
+			return false
+		}
+	}
+	return true
+}
+
+// lexMarkdown highlights headings, lists, quotes, code and links,
+// the state tracks fenced code blocks.
+func lexMarkdown(line []rune, state int) ([]tokenInfo, int) {
+	var tokens []tokenInfo
+	add := func(class string, start, end int) {
+		tokens = append(tokens, tokenInfo{class: class, off: start, len: end - start})
+	}
+	trimmed := strings.TrimLeft(string(line), " ")
+	indent := len(line) - len([]rune(trimmed))
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		add(tcString, 0, len(line))
+		if state == stateRawString {
+			return tokens, stateNone
+		}
+		return tokens, stateRawString
+	}
+	if state == stateRawString {
+		add(tcString, 0, len(line))
+		return tokens, state
+	}
+
+	switch {
+	case strings.HasPrefix(trimmed, "#"):
+		add(tcKeyword, 0, len(line))
+		return tokens, state
+	case strings.HasPrefix(trimmed, ">"):
+		add(tcComment, 0, len(line))
+		return tokens, state
+	}
+
+	i := indent
+	// list markers
+	if i+1 < len(line) && strings.ContainsRune("-*+", line[i]) && line[i+1] == ' ' {
+		add(tcOperator, i, i+1)
+		i += 2
+	} else {
+		j := i
+		for j < len(line) && unicode.IsDigit(line[j]) {
+			j++
+		}
+		if j > i && j+1 < len(line) && (line[j] == '.' || line[j] == ')') && line[j+1] == ' ' {
+			add(tcOperator, i, j+1)
+			i = j + 2
+		}
+	}
+
+	for i < len(line) {
+		c := line[i]
+		switch {
+		case c == '`':
+			end := indexFrom(line, i+1, "`")
+			if end < 0 {
+				i++
+				continue
+			}
+			add(tcString, i, end+1)
+			i = end + 1
+		case c == '*' || c == '_':
+			// emphasis, such as *a*, **a** and _a_
+			delim := string(c)
+			if i+1 < len(line) && line[i+1] == c {
+				delim += string(c)
+			}
+			end := indexFrom(line, i+len(delim), delim)
+			if end < 0 || end == i+len(delim) {
+				i += len(delim)
+				continue
+			}
+			add(tcConstant, i, end+len(delim))
+			i = end + len(delim)
+		case c == '[':
+			// link, such as [text](url)
+			closing := indexFrom(line, i+1, "](")
+			if closing < 0 {
+				i++
+				continue
+			}
+			end := indexFrom(line, closing+2, ")")
+			if end < 0 {
+				i++
+				continue
+			}
+			add(tcFunction, i, end+1)
+			i = end + 1
+		default:
+			i++
+		}
+	}
+	return tokens, state
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 )
@@ -17,6 +24,30 @@ var recentE *EditorGroup
 const scrollSensitivity = 0.125
 
 func main() {
+	cmd, err := parseArgs(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	// read stdin before the screen takes over the terminal
+	var stdin []byte
+	if cmd.stdin {
+		if stdin, err = io.ReadAll(os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	configPath := configFile()
+	if cmd.config != "" {
+		if _, err := os.Stat(cmd.config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		configPath = cmd.config
+	}
+
 	logFile, err := os.OpenFile("/tmp/jo.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		log.Fatal(err)
@@ -25,11 +56,29 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.SetOutput(logFile)
 
-	var filename string
-	if len(os.Args) > 1 {
-		filename = os.Args[1]
+	if c, err := loadConfig(configPath); err != nil {
+		log.Print(err)
+	} else {
+		config = c
+	}
+	readOnly = cmd.readOnly
+	if cmd.root != "" {
+		// the files are relative to the new working directory
+		for i, f := range cmd.files {
+			cmd.files[i].filename = absName(f.filename)
+		}
+		if err := os.Chdir(cmd.root); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for i, f := range cmd.files {
+			cmd.files[i].filename = relativeName(f.filename)
+		}
 	}
 
+	// must be done before the screen takes over the terminal
+	setTheme(detectBackground())
+
 	app, err := NewApp()
 	if err != nil {
 		log.Print(err)
@@ -48,68 +97,540 @@ func main() {
 		statusBar.Draw(app.Screen())
 	})
 
-	e := NewEditorGroup(app.Screen(), statusBar.Status)
-	if filename != "" {
-		e.Open(filename)
+	message.onChange = func() {
+		statusBar.msgTime = time.Now()
+		statusBar.Draw(app.Screen())
+	}
+	registerCommand("show theme", func() {
+		message.Set(fmt.Sprintf("%s palette, %s", theme.name, detected))
+	})
+	for _, lang := range languages {
+		registerCommand("set language: "+lang.name, func() {
+			recentE.editor.setLanguage(lang)
+			recentE.Draw(app.Screen())
+		})
+	}
+	registerCommand("set language: plain text", func() {
+		recentE.editor.setLanguage(nil)
+		recentE.Draw(app.Screen())
+	})
+
+	var groups []*EditorGroup
+	if cmd.stdin {
+		g := NewEditorGroup(app.Screen(), statusBar.Status)
+		g.editor.setText(stdin)
+		g.editor.dirty = true
+		groups = append(groups, g)
+	}
+	fileGroups := cmd.groups()
+	for range fileGroups {
+		groups = append(groups, NewEditorGroup(app.Screen(), statusBar.Status))
 	}
+	if len(groups) == 0 {
+		groups = append(groups, NewEditorGroup(app.Screen(), statusBar.Status))
+	}
+	e := groups[0]
 	recentE = e
-	editors := HStack(e)
-	app.SetBody(VStack(editors, statusBar))
+	// the editor groups, side by side, or stacked with -o
+	s := splitVertical
+	if cmd.split == splitHorizontal {
+		s = splitHorizontal
+	}
+	tree := newSplitTree(groups, s)
+	results := newResultsPanel()
+	project := newSearchPanel()
+	ex := newExplorer(".")
+	app.SetBody(VStack(HStack(ex, tree), results, project, statusBar))
+	// lay out the groups before moving the cursors
+	app.Redraw()
+	for i, files := range fileGroups {
+		g := groups[len(groups)-len(fileGroups)+i]
+		g.openFiles(files)
+		g.Blur()
+	}
+
+	results.open = func(loc location) {
+		recentE.jump(loc)
+	}
+	results.Handle(tcell.KeyUp, func(k *tcell.EventKey, screen tcell.Screen) {
+		results.move(-1)
+		results.Draw(screen)
+	})
+	results.Handle(tcell.KeyDown, func(k *tcell.EventKey, screen tcell.Screen) {
+		results.move(1)
+		results.Draw(screen)
+	})
+	results.Handle(tcell.KeyPgUp, func(k *tcell.EventKey, screen tcell.Screen) {
+		results.move(-results.rows())
+		results.Draw(screen)
+	})
+	results.Handle(tcell.KeyPgDn, func(k *tcell.EventKey, screen tcell.Screen) {
+		results.move(results.rows())
+		results.Draw(screen)
+	})
+	results.Handle(tcell.KeyEnter, func(k *tcell.EventKey, screen tcell.Screen) {
+		if apply := results.apply; apply != nil {
+			results.hide()
+			apply()
+			app.Redraw()
+			app.Focus(recentE)
+			return
+		}
+		results.openSelected()
+		app.Focus(recentE)
+	})
+	results.Handle(tcell.KeyESC, func(k *tcell.EventKey, screen tcell.Screen) {
+		results.hide()
+		app.Redraw()
+		app.Focus(recentE)
+	})
+	// the buffers open in all groups
+	buffers := func() []*Editor {
+		var all []*Editor
+		for _, g := range tree.groups() {
+			all = append(all, g.all...)
+		}
+		return all
+	}
+	findReferences := func() {
+		e := recentE.editor
+		if e.lang == nil || e.lang.name != "go" || e.filename == "" {
+			message.Set("find references: not a Go file")
+			return
+		}
+		filename, err := filepath.Abs(e.filename)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		overlay, _ := overlayOf(buffers())
+		overlay[filename] = e.bytes()
+		cursor := e.cursor
+		message.Set("finding references...")
+		go func() {
+			name, refs, err := references(filename, overlay, cursor.row, cursor.col)
+			post(app.Screen(), func() {
+				if err != nil {
+					message.Set("find references: " + err.Error())
+					return
+				}
+				message.Set("")
+				results.show(fmt.Sprintf("%d references to %s", len(refs), name), refs)
+				app.Redraw()
+				app.Focus(results)
+			})
+		}()
+	}
+	registerCommand("find references", findReferences)
+	showProblems := func() {
+		refs, counts := problemList(buffers())
+		if len(refs) == 0 {
+			message.Set("no problems")
+			return
+		}
+		results.show("problems: "+counts, refs)
+		app.Redraw()
+		app.Focus(results)
+	}
+	registerCommand("show problems", showProblems)
+	// formatFailed shows the error of formatting in the message area,
+	// and the whole output of the external formatter in the results panel
+	formatFailed := func(err error) {
+		message.Set(err.Error())
+		var fe *formatError
+		if !errors.As(err, &fe) || !strings.Contains(fe.stderr, "\n") {
+			return
+		}
+		var items []reference
+		for _, line := range strings.Split(fe.stderr, "\n") {
+			items = append(items, reference{text: line})
+		}
+		results.show(fe.command+" output", items)
+		app.Redraw()
+	}
+
+	project.open = func(filename string, hit findMatch) {
+		recentE.openHit(filename, hit, string(project.query), project.opts)
+	}
+	searchProject := func(screen tcell.Screen) {
+		contents, versions := bufferContents(buffers())
+		project.search(screen, contents, versions)
+		project.Draw(screen)
+	}
+	project.Handle(tcell.KeyRune, func(k *tcell.EventKey, screen tcell.Screen) {
+		if k.Modifiers()&tcell.ModAlt != 0 {
+			switch k.Rune() {
+			case 'r':
+				project.opts.regex = !project.opts.regex
+			case 'c':
+				project.opts.matchCase = !project.opts.matchCase
+			case 'w':
+				project.opts.wholeWord = !project.opts.wholeWord
+			default:
+				return
+			}
+		} else if project.replacing {
+			project.replace = append(project.replace, k.Rune())
+			project.Draw(screen)
+			return
+		} else {
+			project.query = append(project.query, k.Rune())
+		}
+		searchProject(screen)
+	})
+	projectBackspace := func(k *tcell.EventKey, screen tcell.Screen) {
+		if project.replacing {
+			if len(project.replace) > 0 {
+				project.replace = project.replace[:len(project.replace)-1]
+				project.Draw(screen)
+			}
+			return
+		}
+		if len(project.query) > 0 {
+			project.query = project.query[:len(project.query)-1]
+			searchProject(screen)
+		}
+	}
+	project.Handle(tcell.KeyBackspace, projectBackspace)
+	project.Handle(tcell.KeyBackspace2, projectBackspace)
+	project.Handle(tcell.KeyTab, func(k *tcell.EventKey, screen tcell.Screen) {
+		if !project.showReplace {
+			project.showReplace = true
+			project.replacing = true
+		} else {
+			project.replacing = !project.replacing
+		}
+		project.move(0)
+		project.Draw(screen)
+	})
+	project.Handle(tcell.KeyDelete, func(k *tcell.EventKey, screen tcell.Screen) {
+		project.exclude(false)
+		project.Draw(screen)
+	})
+	project.Handle(tcell.KeyCtrlD, func(k *tcell.EventKey, screen tcell.Screen) {
+		project.exclude(true)
+		project.Draw(screen)
+	})
+	project.Handle(tcell.KeyCtrlA, func(k *tcell.EventKey, screen tcell.Screen) {
+		if !project.showReplace {
+			return
+		}
+		files, hits, err := project.replaceAll(buffers())
+		summary := fmt.Sprintf("replaced %d occurrences in %d files", hits, files)
+		if err != nil {
+			// one line for each file
+			summary += ": " + strings.ReplaceAll(err.Error(), "\n", "; ")
+		}
+		message.Set(summary)
+		app.Redraw()
+		if files > 0 {
+			searchProject(screen)
+		}
+	})
+	project.Handle(tcell.KeyUp, func(k *tcell.EventKey, screen tcell.Screen) {
+		project.move(-1)
+		project.Draw(screen)
+	})
+	project.Handle(tcell.KeyDown, func(k *tcell.EventKey, screen tcell.Screen) {
+		project.move(1)
+		project.Draw(screen)
+	})
+	project.Handle(tcell.KeyPgUp, func(k *tcell.EventKey, screen tcell.Screen) {
+		project.move(-project.visibleRows())
+		project.Draw(screen)
+	})
+	project.Handle(tcell.KeyPgDn, func(k *tcell.EventKey, screen tcell.Screen) {
+		project.move(project.visibleRows())
+		project.Draw(screen)
+	})
+	project.Handle(tcell.KeyEnter, func(k *tcell.EventKey, screen tcell.Screen) {
+		project.openSelected()
+		app.Focus(recentE)
+	})
+	project.Handle(tcell.KeyESC, func(k *tcell.EventKey, screen tcell.Screen) {
+		project.hide()
+		project.showReplace = false
+		project.replacing = false
+		app.Redraw()
+		app.Focus(recentE)
+	})
+	findInFiles := func() {
+		// prefill with the selection or the word under the cursor
+		if q := recentE.editor.query(); q != "" {
+			if project.opts.regex {
+				q = regexp.QuoteMeta(q)
+			}
+			project.query = []rune(q)
+		}
+		results.hide()
+		project.show()
+		app.Redraw()
+		app.Focus(project)
+		searchProject(app.Screen())
+	}
+	registerCommand("find in files", findInFiles)
+	registerCommand("replace in files", func() {
+		project.showReplace = true
+		project.replacing = false
+		findInFiles()
+	})
+	app.Handle(tcell.KeyCtrlT, func(*tcell.EventKey) {
+		findInFiles()
+	})
+	registerCommand("format document", func() {
+		if !canFormat(recentE.editor.lang) {
+			message.Set("format document: " + errNoFormatter.Error())
+			return
+		}
+		recentE.editor.formatInBackground(false, true, func(err error) {
+			if err != nil {
+				formatFailed(fmt.Errorf("format document: %w", err))
+			}
+			recentE.Draw(app.Screen())
+		})
+	})
+	registerCommand("organize imports", func() {
+		e := recentE.editor
+		if e.lang == nil || e.lang.name != "go" {
+			message.Set("organize imports: not a Go file")
+			return
+		}
+		if err := e.formatBuffer(true, false); err != nil {
+			message.Set("organize imports: " + err.Error())
+		}
+		recentE.Draw(app.Screen())
+	})
+	registerCommand("next problem", func() { recentE.NextProblem(1) })
+	registerCommand("previous problem", func() { recentE.NextProblem(-1) })
+	app.Handle(tcell.KeyF8, func(*tcell.EventKey) {
+		recentE.NextProblem(1)
+	})
+	// shift+F8
+	app.Handle(tcell.KeyF20, func(*tcell.EventKey) {
+		recentE.NextProblem(-1)
+	})
+	// shift+F12
+	app.Handle(tcell.KeyF24, func(*tcell.EventKey) {
+		findReferences()
+	})
 
 	width, height := app.Screen().Size()
-	fb := new(findBar)
-	fb.SetPos(width-40, 1, 40, 1)
-	fb.Handle(tcell.KeyRune, func(k *tcell.EventKey, screen tcell.Screen) {
-		fb.keyword = append(fb.keyword, k.Rune())
-		recentE.editor.Find(string(fb.keyword))
-		recentE.Draw(screen)
-		fb.Draw(screen)
+	rb := new(renameBar)
+	rb.Handle(tcell.KeyRune, func(k *tcell.EventKey, screen tcell.Screen) {
+		rb.name = append(rb.name, k.Rune())
+		rb.Draw(screen)
 	})
-	fb.Handle(tcell.KeyBackspace, func(k *tcell.EventKey, screen tcell.Screen) {
-		if len(fb.keyword) == 0 {
+	rbBackspace := func(k *tcell.EventKey, screen tcell.Screen) {
+		if len(rb.name) > 0 {
+			rb.name = rb.name[:len(rb.name)-1]
+			rb.Draw(screen)
+		}
+	}
+	rb.Handle(tcell.KeyBackspace, rbBackspace)
+	rb.Handle(tcell.KeyBackspace2, rbBackspace)
+	rb.Handle(tcell.KeyESC, func(k *tcell.EventKey, screen tcell.Screen) {
+		app.Redraw() // cover the rename bar
+		app.Focus(recentE)
+	})
+	rb.Handle(tcell.KeyEnter, func(k *tcell.EventKey, screen tcell.Screen) {
+		app.Redraw()
+		app.Focus(recentE)
+		e := recentE.editor
+		filename, err := filepath.Abs(e.filename)
+		if err != nil {
+			log.Print(err)
 			return
 		}
-		fb.keyword = fb.keyword[:len(fb.keyword)-1]
+		overlay, versions := overlayOf(buffers())
+		cursor, newName := e.cursor, string(rb.name)
+		message.Set("renaming...")
+		go func() {
+			r, err := rename(filename, overlay, cursor.row, cursor.col, newName)
+			post(app.Screen(), func() {
+				if err != nil {
+					message.Set("rename: " + err.Error())
+					return
+				}
+				message.Set("")
+				r.versions = versions
+				src := func(name string) []byte {
+					if b, ok := overlay[name]; ok {
+						return b
+					}
+					b, _ := os.ReadFile(name)
+					return b
+				}
+				results.show(fmt.Sprintf("rename %s to %s: %d sites in %d files", r.old, r.new, len(r.sites), len(r.files())), r.preview(src))
+				results.apply = func() {
+					if err := r.apply(buffers()); err != nil {
+						message.Set("rename: " + err.Error())
+						return
+					}
+					message.Set(fmt.Sprintf("renamed %s to %s in %d files", r.old, r.new, len(r.files())))
+				}
+				app.Redraw()
+				app.Focus(results)
+			})
+		}()
+	})
+	renameSymbol := func() {
+		e := recentE.editor
+		if e.lang == nil || e.lang.name != "go" || e.filename == "" {
+			message.Set("rename: not a Go file")
+			return
+		}
+		line := e.buf[e.cursor.row]
+		end := e.cursor.col
+		for end < len(line) && isWordRune(line[end]) {
+			end++
+		}
+		rb.old = string(wordBefore(line, end))
+		if rb.old == "" {
+			message.Set("rename: no identifier under the cursor")
+			return
+		}
+		rb.name = []rune(rb.old)
+		width, _ := app.Screen().Size()
+		rb.SetPos((width-optionWidth)/2, 3, optionWidth, 1)
+		rb.Draw(app.Screen())
+		app.Focus(rb)
+	}
+	registerCommand("rename symbol", renameSymbol)
+	app.Handle(tcell.KeyF2, func(*tcell.EventKey) {
+		renameSymbol()
+	})
+
+	fb := new(findBar)
+	fb.opts.matchCase = true
+	fb.history = loadSearchHistory(searchHistoryFile())
+	fb.SetPos(width-findBarWidth, 1, findBarWidth, 1)
+	// search runs the search of the find bar in the recent editor
+	search := func(screen tcell.Screen) {
+		fb.err = nil
+		opts := fb.opts
+		if fb.inSelection {
+			opts.scope = fb.scope
+		}
 		if len(fb.keyword) == 0 {
 			recentE.editor.ClearFind()
-			recentE.Draw(screen)
-		} else {
-			recentE.editor.Find(string(fb.keyword))
-			recentE.Draw(screen)
+		} else if err := recentE.editor.Find(string(fb.keyword), opts); err != nil {
+			fb.err = err
+			message.Set("find: " + err.Error())
 		}
+		recentE.Draw(screen)
 		fb.Draw(screen)
+	}
+	// remember adds the query to the search history
+	remember := func() {
+		if err := fb.history.add(string(fb.keyword)); err != nil {
+			message.Set("search history: " + err.Error())
+		}
+	}
+	fb.Handle(tcell.KeyRune, func(k *tcell.EventKey, screen tcell.Screen) {
+		if k.Modifiers()&tcell.ModAlt != 0 {
+			switch k.Rune() {
+			case 'r':
+				fb.opts.regex = !fb.opts.regex
+			case 'c':
+				fb.opts.matchCase = !fb.opts.matchCase
+			case 'w':
+				fb.opts.wholeWord = !fb.opts.wholeWord
+			case 's':
+				if fb.scope == nil {
+					message.Set("search in selection: no selection")
+					return
+				}
+				fb.inSelection = !fb.inSelection
+			default:
+				return
+			}
+			search(screen)
+			return
+		}
+		if fb.replacing {
+			fb.replace = append(fb.replace, k.Rune())
+			fb.Draw(screen)
+			return
+		}
+		fb.keyword = append(fb.keyword, k.Rune())
+		fb.history.reset()
+		search(screen)
 	})
-	fb.Handle(tcell.KeyBackspace2, func(k *tcell.EventKey, screen tcell.Screen) {
-		if len(fb.keyword) == 0 {
+	backspace := func(k *tcell.EventKey, screen tcell.Screen) {
+		input := fb.input()
+		if len(*input) == 0 {
 			return
 		}
-		fb.keyword = fb.keyword[:len(fb.keyword)-1]
-		if len(fb.keyword) == 0 {
-			recentE.editor.ClearFind()
-			recentE.Draw(screen)
+		*input = (*input)[:len(*input)-1]
+		if fb.replacing {
+			fb.Draw(screen)
+			return
+		}
+		fb.history.reset()
+		search(screen)
+	}
+	fb.Handle(tcell.KeyBackspace, backspace)
+	fb.Handle(tcell.KeyBackspace2, backspace)
+	fb.Handle(tcell.KeyTab, func(k *tcell.EventKey, screen tcell.Screen) {
+		if !fb.showReplace {
+			fb.showReplace = true
+			fb.replacing = true
 		} else {
-			recentE.editor.Find(string(fb.keyword))
-			recentE.Draw(screen)
+			fb.replacing = !fb.replacing
 		}
+		fb.SetPos(fb.x, fb.y, fb.width, fb.rows())
 		fb.Draw(screen)
 	})
 	fb.Handle(tcell.KeyEnter, func(k *tcell.EventKey, screen tcell.Screen) {
-		recentE.editor.FindNext()
+		remember()
+		if fb.replacing {
+			recentE.editor.ReplaceNext(string(fb.replace))
+		} else {
+			recentE.editor.FindNext()
+		}
+		recentE.Draw(screen)
+		fb.Draw(screen)
+	})
+	fb.Handle(tcell.KeyCtrlA, func(k *tcell.EventKey, screen tcell.Screen) {
+		if !fb.showReplace {
+			return
+		}
+		n := recentE.editor.ReplaceAll(string(fb.replace))
+		message.Set(fmt.Sprintf("replaced %d occurrences", n))
 		recentE.Draw(screen)
 		fb.Draw(screen)
 	})
 	fb.Handle(tcell.KeyDown, func(k *tcell.EventKey, screen tcell.Screen) {
+		if !fb.replacing && fb.history.browsing() {
+			if q, ok := fb.history.next(); ok {
+				fb.keyword = []rune(q)
+				search(screen)
+			}
+			return
+		}
 		recentE.editor.FindNext()
 		recentE.Draw(screen)
 		fb.Draw(screen)
 	})
 	fb.Handle(tcell.KeyUp, func(k *tcell.EventKey, screen tcell.Screen) {
+		// browse the history with an empty query
+		if !fb.replacing && (len(fb.keyword) == 0 || fb.history.browsing()) {
+			if q, ok := fb.history.prev(); ok {
+				fb.keyword = []rune(q)
+				search(screen)
+			}
+			return
+		}
 		recentE.editor.FindPrev()
 		recentE.Draw(screen)
 		fb.Draw(screen)
 	})
 	fb.Handle(tcell.KeyESC, func(k *tcell.EventKey, screen tcell.Screen) {
+		remember()
 		fb.keyword = nil
+		fb.err = nil
+		fb.showReplace = false
+		fb.replacing = false
 		app.Focus(recentE)
 		recentE.editor.ClearFind()
 		recentE.Draw(screen) // cover the findbar
@@ -146,6 +667,13 @@ func main() {
 		}
 
 		recentE.Open(string(sb.name))
+		// formatted by the language of the name, as saving it again
+		recentE.editor.save(func(err error) {
+			if err != nil {
+				formatFailed(err)
+			}
+			recentE.Draw(app.Screen())
+		})
 		app.Focus(recentE)
 		recentE.Draw(screen)
 		sb.name = nil
@@ -158,149 +686,525 @@ func main() {
 		app.Redraw() // cover the savebar
 	})
 
-	gb := new(gotoBar)
-	gb.SetPos((width-optionWidth)/2, 3, optionWidth, 1)
+	gb := newGotoBar(app.Screen(), tree.groups)
+	gb.SetPos((width-gotoWidth)/2, 3, gotoWidth, 1)
+	go projectFiles.run(context.Background(), func() {
+		post(app.Screen(), func() {
+			// the options of the file search are out of date
+			if gb.Focused() && gb.mode() == 0 {
+				gb.filter()
+			}
+		})
+	})
 	gb.Handle(tcell.KeyEsc, func(k *tcell.EventKey, screen tcell.Screen) {
+		gb.restore()
 		app.Redraw()
 		app.Focus(recentE)
 	})
 	gb.Handle(tcell.KeyRune, func(k *tcell.EventKey, screen tcell.Screen) {
-		defer gb.Draw(screen)
-		app.Redraw() // clear previous options
 		gb.keyword = append(gb.keyword, k.Rune())
-		if gb.keyword[0] == ':' {
-			return
-		}
-		options := make([]string, 0, len(files))
-		for _, f := range files {
-			if strings.Contains(strings.ToLower(f), string(gb.keyword)) {
-				options = append(options, f)
-			}
-		}
-		gb.options = options
+		gb.filter()
+		app.Redraw() // clear previous options
+		gb.Draw(screen)
 	})
 	gb.Handle(tcell.KeyBackspace2, func(k *tcell.EventKey, screen tcell.Screen) {
 		if len(gb.keyword) == 0 {
 			return
 		}
-		defer gb.Draw(screen)
-		recentE.Draw(screen) // clear previous options
 		gb.keyword = gb.keyword[:len(gb.keyword)-1]
-		if len(gb.keyword) == 0 {
-			return
-		}
-		if gb.keyword[0] == ':' {
-			return
-		}
-		options := make([]string, 0, len(files))
-		for _, f := range files {
-			if strings.Contains(strings.ToLower(f), string(gb.keyword)) {
-				options = append(options, f)
-			}
-		}
-		gb.options = options
+		gb.filter()
+		app.Redraw() // clear previous options
+		gb.Draw(screen)
 	})
-	gb.Handle(tcell.KeyEnter, func(k *tcell.EventKey, screen tcell.Screen) {
-		// go to line
-		if len(gb.keyword) > 0 && gb.keyword[0] == ':' {
-			line, err := strconv.Atoi(string(gb.keyword[1:]))
-			if err != nil {
-				log.Printf("goto: invalid line number: %s", err)
-				return
+	gotoSelected := func() {
+		switch gb.mode() {
+		case '>':
+			if len(gb.options) > 0 {
+				gb.restore()
+				app.Redraw()
+				app.Focus(recentE)
+				runCommand(gb.options[gb.index])
 			}
-			if line < 1 || line > len(recentE.editor.buf)+1 {
-				log.Printf("goto: line number out of range")
+			return
+		case '%':
+			// the buffer is shown in its group
+			loc, ok := gb.target()
+			if !ok {
 				return
 			}
-			recentE.editor.cursor.row = line - 1
-			recentE.editor.cursor.col = 0
-			if line <= recentE.editor.PageSize()/2 {
-				recentE.editor.top = 1
-			} else {
-				recentE.editor.top = line - recentE.editor.PageSize()/2
+			gb.restore()
+			if g, _ := gb.buffer(loc.filename); g != nil {
+				g.Open(loc.filename)
+				app.Redraw()
+				app.Focus(g)
 			}
+			return
+		}
+		if loc, ok := gb.target(); ok {
+			gb.restore()
+			recentE.jump(loc)
 			app.Redraw()
 			app.Focus(recentE)
 			return
 		}
+		if gb.mode() != 0 {
+			return
+		}
 		// go to file
 		if len(gb.options) > 0 {
 			recentE.Open(gb.options[gb.index])
 			app.Redraw()
 			app.Focus(recentE)
 		}
+	}
+	gb.Handle(tcell.KeyEnter, func(k *tcell.EventKey, screen tcell.Screen) {
+		gotoSelected()
 	})
+	gb.OnClick(gotoSelected)
 	gb.Handle(tcell.KeyUp, func(k *tcell.EventKey, screen tcell.Screen) {
-		gb.index--
-		if gb.index < 0 {
-			gb.index = len(files) - 1
-		}
+		gb.move(-1)
+		app.Redraw()
 		gb.Draw(screen)
 	})
 	gb.Handle(tcell.KeyDown, func(k *tcell.EventKey, screen tcell.Screen) {
-		gb.index++
-		if gb.index > len(files)-1 {
-			gb.index = 0
-		}
+		gb.move(1)
+		app.Redraw()
+		gb.Draw(screen)
+	})
+	gb.Handle(tcell.KeyPgUp, func(k *tcell.EventKey, screen tcell.Screen) {
+		gb.move(-min(gb.index, maxGotoOptions))
+		app.Redraw()
 		gb.Draw(screen)
 	})
+	gb.Handle(tcell.KeyPgDn, func(k *tcell.EventKey, screen tcell.Screen) {
+		gb.move(min(len(gb.options)-1-gb.index, maxGotoOptions))
+		app.Redraw()
+		gb.Draw(screen)
+	})
+	// openInNewGroup opens the file in a new split on the right of the current group
+	openInNewGroup := func(name string) {
+		g := NewEditorGroup(app.Screen(), statusBar.Status)
+		g.Open(name)
+		tree.splitGroup(recentE, g, splitVertical)
+		app.Focus(g)
+		app.Redraw()
+	}
 	gb.Handle(tcell.KeyCtrlBackslash, func(k *tcell.EventKey, screen tcell.Screen) {
+		if len(gb.options) == 0 || gb.mode() != 0 {
+			return
+		}
+		gb.restore()
+		openInNewGroup(gb.options[gb.index])
+	})
+
+	ex.open = func(path string, split bool) {
+		if split {
+			openInNewGroup(path)
+			return
+		}
+		recentE.Open(path)
+		app.Redraw()
+		app.Focus(recentE)
+	}
+	ex.Handle(tcell.KeyUp, func(k *tcell.EventKey, screen tcell.Screen) {
+		ex.move(-1)
+		ex.Draw(screen)
+	})
+	ex.Handle(tcell.KeyDown, func(k *tcell.EventKey, screen tcell.Screen) {
+		ex.move(1)
+		ex.Draw(screen)
+	})
+	ex.Handle(tcell.KeyPgUp, func(k *tcell.EventKey, screen tcell.Screen) {
+		ex.move(-ex.visibleRows())
+		ex.Draw(screen)
+	})
+	ex.Handle(tcell.KeyPgDn, func(k *tcell.EventKey, screen tcell.Screen) {
+		ex.move(ex.visibleRows())
+		ex.Draw(screen)
+	})
+	ex.Handle(tcell.KeyLeft, func(k *tcell.EventKey, screen tcell.Screen) {
+		ex.left()
+		ex.Draw(screen)
+	})
+	ex.Handle(tcell.KeyRight, func(k *tcell.EventKey, screen tcell.Screen) {
+		if n := ex.selected(); n != nil && n.dir && !n.expanded {
+			ex.expand(n)
+		} else if n != nil && n.dir {
+			ex.move(1)
+		}
+		ex.Draw(screen)
+	})
+	ex.Handle(tcell.KeyEnter, func(k *tcell.EventKey, screen tcell.Screen) {
+		ex.activate(false)
+		ex.Draw(screen)
+	})
+	ex.Handle(tcell.KeyCtrlBackslash, func(k *tcell.EventKey, screen tcell.Screen) {
+		if n := ex.selected(); n != nil && !n.dir {
+			ex.activate(true)
+		}
+	})
+	ex.Handle(tcell.KeyESC, func(k *tcell.EventKey, screen tcell.Screen) {
+		app.Focus(recentE)
+	})
+
+	// the prompt of the file operations in the explorer
+	pb := new(promptBar)
+	ask := func(label, input string, confirm bool, done func(string) error) {
+		pb.label, pb.input, pb.confirm, pb.done = label, []rune(input), confirm, done
+		width, _ := app.Screen().Size()
+		pb.SetPos((width-optionWidth)/2, 3, optionWidth, 1)
+		pb.Draw(app.Screen())
+		app.Focus(pb)
+	}
+	pbDone := func() {
+		app.Redraw() // cover the prompt bar
+		app.Focus(ex)
+		if err := pb.done(string(pb.input)); err != nil {
+			message.Set(err.Error())
+		}
+		app.Redraw()
+	}
+	pbCancel := func() {
+		app.Redraw()
+		app.Focus(ex)
+	}
+	pb.Handle(tcell.KeyRune, func(k *tcell.EventKey, screen tcell.Screen) {
+		if pb.confirm {
+			if k.Rune() == 'y' || k.Rune() == 'Y' {
+				pbDone()
+			} else {
+				pbCancel()
+			}
+			return
+		}
+		pb.input = append(pb.input, k.Rune())
+		pb.Draw(screen)
+	})
+	pbBackspace := func(k *tcell.EventKey, screen tcell.Screen) {
+		if len(pb.input) > 0 {
+			pb.input = pb.input[:len(pb.input)-1]
+			pb.Draw(screen)
+		}
+	}
+	pb.Handle(tcell.KeyBackspace, pbBackspace)
+	pb.Handle(tcell.KeyBackspace2, pbBackspace)
+	pb.Handle(tcell.KeyEnter, func(k *tcell.EventKey, screen tcell.Screen) {
+		if !pb.confirm {
+			pbDone()
+		}
+	})
+	pb.Handle(tcell.KeyESC, func(k *tcell.EventKey, screen tcell.Screen) {
+		pbCancel()
+	})
+
+	ex.Handle(tcell.KeyRune, func(k *tcell.EventKey, screen tcell.Screen) {
+		n := ex.selected()
+		if readOnly && strings.ContainsRune("nNrdc", k.Rune()) {
+			message.Set(errReadOnly.Error())
+			return
+		}
+		switch k.Rune() {
+		case 'n', 'N':
+			dir := ex.targetDir()
+			label := "new file in " + dir + ":"
+			create := createFile
+			if k.Rune() == 'N' {
+				label = "new folder in " + dir + ":"
+				create = createDir
+			}
+			ask(label, "", false, func(name string) error {
+				if name == "" {
+					return nil
+				}
+				path := filepath.Join(dir, name)
+				if err := create(path); err != nil {
+					return err
+				}
+				ex.created(path)
+				if k.Rune() == 'n' {
+					ex.open(path, false)
+				}
+				return nil
+			})
+		case 'r':
+			if n == nil {
+				return
+			}
+			ask("rename "+n.name()+" to:", n.name(), false, func(name string) error {
+				if name == "" || name == n.name() {
+					return nil
+				}
+				if err := checkName(name); err != nil {
+					return err
+				}
+				path := filepath.Join(filepath.Dir(n.path), name)
+				if err := renamePath(n.path, path); err != nil {
+					return err
+				}
+				for _, g := range tree.groups() {
+					g.renameFile(n.path, path)
+				}
+				ex.created(path)
+				return nil
+			})
+		case 'd':
+			if n == nil {
+				return
+			}
+			ask("delete "+n.name()+"?", "", true, func(string) error {
+				if err := os.RemoveAll(n.path); err != nil {
+					return err
+				}
+				// the modified buffers are kept, to be saved again
+				var kept []string
+				for _, g := range tree.groups() {
+					for _, e := range slices.Clone(g.all) {
+						if !inPath(n.path, e.filename) {
+							continue
+						}
+						if e.dirty {
+							kept = append(kept, filepath.Base(e.filename))
+							continue
+						}
+						g.closeFile(e)
+					}
+				}
+				if len(kept) > 0 {
+					message.Set("deleted " + n.name() + ", the modified buffers are kept: " + strings.Join(kept, ", "))
+				}
+				ex.refresh()
+				return nil
+			})
+		case 'c':
+			if n == nil {
+				return
+			}
+			ask("copy "+n.name()+" to:", filepath.Base(copyName(n.path)), false, func(name string) error {
+				if name == "" {
+					return nil
+				}
+				if err := checkName(name); err != nil {
+					return err
+				}
+				path := filepath.Join(filepath.Dir(n.path), name)
+				if err := duplicatePath(n.path, path); err != nil {
+					return err
+				}
+				ex.created(path)
+				return nil
+			})
+		}
+	})
+	toggleExplorer := func() {
+		switch {
+		case !ex.Visible():
+			ex.show()
+			ex.reveal(recentE.editor.filename)
+			app.Redraw()
+			app.Focus(ex)
+		case ex.Focused():
+			ex.hide()
+			app.Redraw()
+			app.Focus(recentE)
+		default:
+			ex.Draw(app.Screen())
+			app.Focus(ex)
+		}
+	}
+	app.Handle(tcell.KeyCtrlB, func(*tcell.EventKey) { toggleExplorer() })
+	registerCommand("toggle explorer", toggleExplorer)
+	registerCommand("reveal in explorer", func() {
+		if !ex.Visible() {
+			ex.show()
+		}
+		if !ex.reveal(recentE.editor.filename) {
+			message.Set("reveal in explorer: not in the project")
+		}
+		app.Redraw()
+		app.Focus(ex)
+	})
+
+	// splitGroup splits the current group, opening the file at the cursor in the new one.
+	// A modified buffer is not, for the new one would be read from the disk.
+	splitGroup := func(s split) {
 		g := NewEditorGroup(app.Screen(), statusBar.Status)
-		g.Open(gb.options[gb.index])
-		editors.Views = append(editors.Views, g)
+		tree.splitGroup(recentE, g, s)
+		if e := recentE.editor; e.filename != "" {
+			if e.dirty {
+				message.Set("split: " + filepath.Base(e.filename) + " is modified, not opened in the new split")
+			} else {
+				g.openAt(location{e.filename, e.cursor})
+			}
+		}
+		app.Redraw()
 		app.Focus(g)
+	}
+	focusSplit := func(d direction) {
+		tree.unzoom()
+		if g := tree.neighbour(recentE, d); g != nil {
+			app.Redraw()
+			app.Focus(g)
+		}
+	}
+	swapSplit := func(d direction) {
+		tree.unzoom()
+		if tree.swap(recentE, d) {
+			app.Redraw()
+			app.Focus(recentE)
+		}
+	}
+	toggleZoom := func() {
+		tree.toggleZoom(recentE)
 		app.Redraw()
+		app.Focus(recentE)
+	}
+	registerCommand("split right", func() { splitGroup(splitVertical) })
+	registerCommand("split down", func() { splitGroup(splitHorizontal) })
+	for _, d := range []struct {
+		name string
+		dir  direction
+	}{
+		{"left split", dirLeft},
+		{"right split", dirRight},
+		{"split above", dirUp},
+		{"split below", dirDown},
+	} {
+		registerCommand("focus "+d.name, func() { focusSplit(d.dir) })
+		registerCommand("swap with "+d.name, func() { swapSplit(d.dir) })
+	}
+	registerCommand("toggle zoom split", toggleZoom)
+	registerCommand("equalize splits", func() {
+		tree.equalize()
+		app.Redraw()
+		app.Focus(recentE)
 	})
 
+	// arranging the splits by keyboard, until esc or enter
+	arrangeSplits := func() {
+		tree.unzoom()
+		app.Focus(tree)
+		app.Redraw()
+		message.Set("arrows focus, shift swap, ctrl resize, v/s split, z zoom, = equal, esc done")
+	}
+	app.Handle(tcell.KeyCtrlE, func(*tcell.EventKey) { arrangeSplits() })
+	registerCommand("arrange splits", arrangeSplits)
+	for key, d := range map[tcell.Key]direction{
+		tcell.KeyLeft:  dirLeft,
+		tcell.KeyRight: dirRight,
+		tcell.KeyUp:    dirUp,
+		tcell.KeyDown:  dirDown,
+	} {
+		tree.Handle(key, func(k *tcell.EventKey, screen tcell.Screen) {
+			switch {
+			case k.Modifiers()&tcell.ModShift != 0:
+				tree.swap(recentE, d)
+			case k.Modifiers()&tcell.ModCtrl != 0:
+				// right and down grow the split, left and up shrink it
+				s, delta := splitVertical, 1
+				if d == dirUp || d == dirDown {
+					s = splitHorizontal
+				}
+				if d == dirLeft || d == dirUp {
+					delta = -1
+				}
+				tree.resize(recentE, s, delta)
+			default:
+				if g := tree.neighbour(recentE, d); g != nil {
+					recentE = g
+				}
+			}
+			app.Redraw()
+		})
+	}
+	tree.Handle(tcell.KeyRune, func(k *tcell.EventKey, screen tcell.Screen) {
+		switch k.Rune() {
+		case 'v':
+			splitGroup(splitVertical)
+		case 's':
+			splitGroup(splitHorizontal)
+		case 'z':
+			toggleZoom()
+		case '=':
+			tree.equalize()
+			app.Redraw()
+		}
+	})
+	doneArranging := func(k *tcell.EventKey, screen tcell.Screen) {
+		app.Focus(recentE)
+		app.Redraw()
+	}
+	tree.Handle(tcell.KeyEnter, doneArranging)
+	tree.Handle(tcell.KeyESC, doneArranging)
+
 	app.Handle(tcell.KeyCtrlQ, func(*tcell.EventKey) {
 		// force quit
 		app.Close()
 	})
 	app.Handle(tcell.KeyCtrlF, func(*tcell.EventKey) {
-		recentE.editor.find.line = recentE.editor.cursor.row
+		e := recentE.editor
+		e.find.line = e.cursor.row
+		fb.editor = e
+		fb.scope = e.selectionRegion()
+		fb.inSelection = false
+		// prefill with the selection or the word under the cursor
+		if q := e.query(); q != "" {
+			if fb.opts.regex {
+				q = regexp.QuoteMeta(q)
+			}
+			fb.keyword = []rune(q)
+		}
+		fb.history.reset()
 		width, _ := app.Screen().Size()
-		fb.SetPos(width-40, 1, 40, 1)
+		fb.SetPos(width-findBarWidth, 1, findBarWidth, fb.rows())
 		app.Focus(fb)
-		fb.Draw(app.Screen())
+		search(app.Screen())
 	})
 	app.Handle(tcell.KeyCtrlS, func(*tcell.EventKey) {
 		if !recentE.editor.dirty {
 			return
 		}
+		if recentE.editor.readOnly {
+			message.Set(errReadOnly.Error())
+			return
+		}
 		if recentE.editor.filename == "" {
 			app.Focus(sb)
 			sb.Draw(app.Screen())
 		} else {
-			f, err := os.Create(recentE.editor.filename)
-			if err != nil {
-				log.Print(err)
-				return
-			}
-			_, err = recentE.editor.WriteTo(f)
-			f.Close()
-			if err != nil {
-				log.Print(err)
-				return
-			}
+			recentE.editor.save(func(err error) {
+				if err != nil {
+					formatFailed(err)
+				}
+				recentE.Draw(app.Screen())
+			})
 		}
 	})
-	app.Handle(tcell.KeyCtrlP, func(*tcell.EventKey) {
-		gb.keyword = nil
-		gb.index = 0
+	// showGoto opens the goto bar with the prefix
+	showGoto := func(prefix string) {
 		width, _ := app.Screen().Size()
-		gb.SetPos((width-optionWidth)/2, 3, optionWidth, 1)
+		gb.SetPos((width-gotoWidth)/2, 3, gotoWidth, 1)
+		gb.open(prefix)
+		app.Redraw()
 		gb.Draw(app.Screen())
 		app.Focus(gb)
+	}
+	app.Handle(tcell.KeyCtrlP, func(*tcell.EventKey) { showGoto("") })
+	app.Handle(tcell.KeyCtrlG, func(*tcell.EventKey) { showGoto(":") })
+	registerCommand("go to symbol in file", func() { showGoto("@") })
+	registerCommand("go to symbol in workspace", func() { showGoto("#") })
+	registerCommand("show open buffers", func() { showGoto("%") })
+	app.Handle(tcell.KeyF12, func(*tcell.EventKey) {
+		recentE.GoToDefinition()
 	})
-	app.Handle(tcell.KeyCtrlG, func(*tcell.EventKey) {
-		gb.keyword = nil
-		gb.index = 0
-		width, _ := app.Screen().Size()
-		gb.SetPos((width-optionWidth)/2, 3, optionWidth, 1)
-		gb.keyword = []rune{':'}
-		gb.Draw(app.Screen())
-		app.Focus(gb)
+	app.Handle(tcell.KeyCtrlO, func(*tcell.EventKey) {
+		recentE.GoBack()
 	})
+	app.Handle(tcell.KeyCtrlY, func(*tcell.EventKey) {
+		recentE.GoForward()
+	})
+	registerCommand("go to definition", func() { recentE.GoToDefinition() })
+	registerCommand("go back", func() { recentE.GoBack() })
+	registerCommand("go forward", func() { recentE.GoForward() })
 	app.Handle(tcell.KeyCtrlW, func(*tcell.EventKey) {
 		if recentE.editor.dirty && !sb.prompt {
 			app.Focus(sb)
@@ -316,25 +1220,13 @@ func main() {
 			return
 		}
 
-		if len(editors.Views) == 1 {
+		// the previous group is focused, or the next one of the first
+		i := slices.Index(tree.groups(), recentE)
+		if !tree.remove(recentE) {
 			app.Close()
 			return
 		}
-
-		// delete editor
-		var i int
-		for i = range editors.Views {
-			if editors.Views[i] == recentE {
-				break
-			}
-		}
-		editors.Views = slices.Delete(editors.Views, i, i+1)
-		j := i - 1
-		if j < 0 {
-			j = 0
-		}
-		prevE := editors.Views[j].(*EditorGroup)
-		app.Focus(prevE)
+		app.Focus(tree.groups()[max(0, i-1)])
 		app.Redraw()
 	})
 	app.Focus(e)
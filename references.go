@@ -0,0 +1,259 @@
+package main
+
+import (
+	"cmp"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// reference is a site referring to an object
+type reference struct {
+	location
+	text string // the line of the reference
+}
+
+// references type-checks the packages of the module containing the file,
+// with overlay in place of the files on disk, and returns every site referring
+// to the object declared or used at the row and column of the file,
+// including the declaration, sorted by location.
+func references(filename string, overlay map[string][]byte, row, col int) (name string, refs []reference, err error) {
+	obj, err := eachReference(filename, overlay, row, col, func(p *goPackage, id *ast.Ident) {
+		name, row, col := p.position(id.Pos())
+		refs = append(refs, reference{location: location{name, pos{row, col}}, text: lineOf(p.src[name], row)})
+	}, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	sortReferences(refs)
+	return obj.Name(), refs, nil
+}
+
+// eachReference calls visit for every identifier in the module referring to the
+// object at the row and column of the file, once for each site, and returns the object.
+// The fields embedding a type are referred to by the type, such as x.T of struct{ T }.
+// If checked is not nil, it is called with the object for every package after its sites.
+func eachReference(filename string, overlay map[string][]byte, row, col int, visit func(*goPackage, *ast.Ident), checked func(*goPackage, types.Object)) (types.Object, error) {
+	// the packages of the module are imported with the overlay too,
+	// so that the objects are declared at the same place in every check
+	s := checker.acquire().withOverlay(moduleRoot(filename), overlay)
+	p, err := s.check(filename, overlay)
+	if err != nil {
+		return nil, err
+	}
+	id := identAt(p, filename, row, col)
+	if id == nil {
+		return nil, errNoDefinition
+	}
+	obj := p.info.Uses[id]
+	if obj == nil {
+		obj = p.info.Defs[id]
+	}
+	if v, ok := obj.(*types.Var); ok && v.Embedded() {
+		if t := embeddedType(v); t != nil {
+			obj = t
+		}
+	}
+	if obj == nil || !obj.Pos().IsValid() {
+		return nil, errNoDefinition
+	}
+	decl := p.fset.Position(obj.Pos())
+	_, isType := obj.(*types.TypeName)
+	same := func(p *goPackage, obj types.Object) bool {
+		if v, ok := obj.(*types.Var); ok && v.Embedded() && isType {
+			if t := embeddedType(v); t != nil {
+				obj = t
+			}
+		}
+		return declaredAt(p, obj, decl)
+	}
+
+	seen := make(map[token.Position]bool)
+	for _, file := range packageFiles(moduleRoot(filename)) {
+		p, err := s.check(file, overlay)
+		if err != nil {
+			continue
+		}
+		for _, uses := range []map[*ast.Ident]types.Object{p.info.Defs, p.info.Uses} {
+			for id, obj := range uses {
+				if !same(p, obj) {
+					continue
+				}
+				position := p.fset.Position(id.Pos())
+				if seen[position] {
+					continue
+				}
+				seen[position] = true
+				visit(p, id)
+			}
+		}
+		if checked != nil {
+			checked(p, obj)
+		}
+	}
+	return obj, nil
+}
+
+// declaredAt reports whether obj is declared at the position, objects
+// from different checks are the same if declared at the same place.
+func declaredAt(p *goPackage, obj types.Object, decl token.Position) bool {
+	if obj == nil || !obj.Pos().IsValid() {
+		return false
+	}
+	position := p.fset.Position(obj.Pos())
+	return position.Filename == decl.Filename && position.Offset == decl.Offset
+}
+
+// embeddedType returns the type name the embedded field is named after, or nil
+func embeddedType(v *types.Var) *types.TypeName {
+	t := v.Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := t.(*types.Named); ok && named.Obj().Name() == v.Name() {
+		return named.Obj()
+	}
+	return nil
+}
+
+func sortReferences(refs []reference) {
+	slices.SortFunc(refs, func(a, b reference) int {
+		return cmp.Or(
+			strings.Compare(a.filename, b.filename),
+			cmp.Compare(a.cursor.row, b.cursor.row),
+			cmp.Compare(a.cursor.col, b.cursor.col),
+		)
+	})
+}
+
+// identAt returns the identifier at the row and column of the file, or nil
+func identAt(p *goPackage, filename string, row, col int) *ast.Ident {
+	target := p.pos(filename, row, col)
+	var id *ast.Ident
+	ast.Inspect(p.files[filename], func(n ast.Node) bool {
+		if id != nil || n == nil || target < n.Pos() || n.End() < target {
+			return false
+		}
+		if i, ok := n.(*ast.Ident); ok {
+			id = i
+		}
+		return true
+	})
+	return id
+}
+
+// lineOf returns the line at row of src, without leading spaces
+func lineOf(src []byte, row int) string {
+	return strings.TrimSpace(rawLine(src, row))
+}
+
+// rawLine returns the line at row of src
+func rawLine(src []byte, row int) string {
+	for i := 0; i < row; i++ {
+		j := slices.Index(src, '\n')
+		if j < 0 {
+			return ""
+		}
+		src = src[j+1:]
+	}
+	if j := slices.Index(src, '\n'); j >= 0 {
+		src = src[:j]
+	}
+	return string(src)
+}
+
+// moduleRoot returns the directory containing go.mod for the file,
+// or the directory of the file if it is not in a module.
+func moduleRoot(filename string) string {
+	dir := filepath.Dir(filename)
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// packageFiles returns a file of every package under root, to be type-checked.
+// The test packages are included, nested modules are not.
+func packageFiles(root string) []string {
+	var files []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if path != root {
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil
+		}
+		// a file of the package, then a test file for each package clause
+		// of the tests, since the internal tests are checked with the package
+		packages := make(map[string]bool)
+		var tests []string
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			if ok, err := build.Default.MatchFile(path, name); err != nil || !ok {
+				continue
+			}
+			if strings.HasSuffix(name, "_test.go") {
+				tests = append(tests, name)
+				continue
+			}
+			if len(packages) == 0 {
+				packages[""] = true
+				files = append(files, filepath.Join(path, name))
+			}
+		}
+		for _, name := range tests {
+			file := filepath.Join(path, name)
+			f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+			if err != nil || packages[f.Name.Name] {
+				continue
+			}
+			packages[f.Name.Name] = true
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files
+}
+
+// overlayOf returns the content of the open Go buffers by absolute file name,
+// and their versions.
+func overlayOf(buffers []*Editor) (overlay map[string][]byte, versions map[string]int) {
+	overlay = make(map[string][]byte)
+	versions = make(map[string]int)
+	for _, e := range buffers {
+		if e.filename == "" || e.lang == nil || e.lang.name != "go" {
+			continue
+		}
+		filename, err := filepath.Abs(e.filename)
+		if err != nil {
+			continue
+		}
+		overlay[filename] = e.bytes()
+		versions[filename] = e.version
+	}
+	return overlay, versions
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeModule writes the files in dir and changes the working directory to it
+// until the test finishes.
+func writeModule(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestReferences(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/a.go": `package a
+
+type T struct{ Name string }
+
+func New() T { return T{Name: "x"} }
+`,
+		"a/a_test.go": `package a
+
+import "testing"
+
+func TestNew(t *testing.T) { _ = New().Name }
+`,
+		"b/b.go": `package b
+
+import "example.com/m/a"
+
+func f() string {
+	t := a.New()
+	return t.Name
+}
+`,
+		"testdata/c.go": "package c\n\nvar _ = a.New\n",
+	}
+	writeModule(t, dir, files)
+	defer checker.reset()
+
+	filename := filepath.Join(dir, "b", "b.go")
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		row, col int
+		wantName string
+		want     []string
+	}{
+		{
+			name: "function", row: 5, col: 9, wantName: "New",
+			want: []string{
+				"a/a.go:5: func New() T { return T{Name: \"x\"} }",
+				"a/a_test.go:5: func TestNew(t *testing.T) { _ = New().Name }",
+				"b/b.go:6: t := a.New()",
+			},
+		},
+		{
+			name: "field", row: 6, col: 11, wantName: "Name",
+			want: []string{
+				"a/a.go:3: type T struct{ Name string }",
+				"a/a.go:5: func New() T { return T{Name: \"x\"} }",
+				"a/a_test.go:5: func TestNew(t *testing.T) { _ = New().Name }",
+				"b/b.go:7: return t.Name",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, refs, err := references(filename, map[string][]byte{filename: src}, tt.row, tt.col)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tt.wantName {
+				t.Errorf("name = %s, want %s", name, tt.wantName)
+			}
+			var got []string
+			for _, r := range refs {
+				got = append(got, filepath.ToSlash(r.String()))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("references = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultsPanel(t *testing.T) {
+	p := newResultsPanel()
+	var items []reference
+	for i := 0; i < 20; i++ {
+		items = append(items, reference{location: location{"a.go", pos{i, 0}}, text: fmt.Sprint(i)})
+	}
+	p.show("title", items)
+	p.SetPos(0, 10, 80, resultsHeight)
+
+	p.move(12)
+	if p.index != 12 || p.top != 4 {
+		t.Errorf("after moving down: index = %d, top = %d, want 12, 4", p.index, p.top)
+	}
+	p.move(-100)
+	if p.index != 0 || p.top != 0 {
+		t.Errorf("after moving up: index = %d, top = %d, want 0, 0", p.index, p.top)
+	}
+
+	var opened location
+	p.open = func(loc location) { opened = loc }
+	p.Click(5, 13)
+	if opened.cursor.row != 2 {
+		t.Errorf("clicked the row %d, want 2", opened.cursor.row)
+	}
+
+	p.hide()
+	if p.Visible() {
+		t.Error("the panel is visible after hiding")
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// renaming is the result of renaming an object, to be previewed and applied
+type renaming struct {
+	old, new string
+	sites    []reference // sorted by location
+	// the versions of the open buffers the sites are found in
+	versions map[string]int
+}
+
+// rename finds every site of the object at the row and column of the file
+// in the module, with overlay in place of the files on disk, and checks that
+// the new name does not conflict with other declarations.
+func rename(filename string, overlay map[string][]byte, row, col int, newName string) (*renaming, error) {
+	if !token.IsIdentifier(newName) {
+		return nil, fmt.Errorf("%q is not a valid identifier", newName)
+	}
+	r := &renaming{new: newName}
+	var conflict error
+	var declared bool // the object is declared in the module
+	checked := make(map[types.Object]bool)
+	obj, err := eachReference(filename, overlay, row, col, func(p *goPackage, id *ast.Ident) {
+		name, row, col := p.position(id.Pos())
+		r.sites = append(r.sites, reference{location: location{name, pos{row, col}}})
+		// an embedded field is both the field and the type it is named after
+		for _, obj := range []types.Object{p.info.Defs[id], p.info.Uses[id]} {
+			if obj == nil || conflict != nil {
+				continue
+			}
+			if obj.Pkg() != p.pkg {
+				// a qualified identifier, such as pkg.Name
+				if !token.IsExported(newName) {
+					conflict = fmt.Errorf("%s is used in package %s, it cannot be unexported", obj.Name(), p.pkg.Name())
+				}
+				continue
+			}
+			if v, ok := obj.(*types.Var); !ok || !v.Embedded() {
+				declared = true
+			}
+			if !checked[obj] {
+				checked[obj] = true
+				conflict = renameConflict(p, obj, newName)
+			}
+			if conflict == nil {
+				conflict = shadowConflict(p, id, obj, newName)
+			}
+		}
+	}, func(p *goPackage, obj types.Object) {
+		if conflict == nil {
+			conflict = implementsConflict(p, obj)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if obj.Name() == newName {
+		return nil, errors.New("the name is unchanged")
+	}
+	if _, ok := obj.(*types.PkgName); ok {
+		return nil, errors.New("renaming imports is not supported")
+	}
+	if !declared {
+		return nil, fmt.Errorf("%s is declared outside the module", obj.Name())
+	}
+	if conflict != nil {
+		return nil, conflict
+	}
+	r.old = obj.Name()
+	sortReferences(r.sites)
+	return r, nil
+}
+
+// renameConflict checks that the new name is not declared in the scope of obj,
+// and that the uses of the new name in the scope would not refer to obj.
+func renameConflict(p *goPackage, obj types.Object, newName string) error {
+	scope := obj.Parent()
+	if scope == nil {
+		// methods and fields
+		var t types.Type
+		if f, ok := obj.(*types.Func); ok {
+			if recv := f.Type().(*types.Signature).Recv(); recv != nil {
+				t = recv.Type()
+			}
+		} else {
+			t = structOf(p, obj)
+		}
+		if t == nil {
+			return nil
+		}
+		if found, _, _ := types.LookupFieldOrMethod(t, true, p.pkg, newName); found != nil {
+			return declConflict(p, found)
+		}
+		return nil
+	}
+	if found := scope.Lookup(newName); found != nil {
+		return declConflict(p, found)
+	}
+	for id, used := range p.info.Uses {
+		if id.Name != newName || used.Parent() == nil || !within(scope, used.Parent()) || used.Parent() == scope {
+			continue
+		}
+		// the package scope covers all files, the local scopes start at the declaration
+		if scope != p.pkg.Scope() && (!scope.Contains(id.Pos()) || id.Pos() < obj.Pos()) {
+			continue
+		}
+		name, row, col := p.position(id.Pos())
+		return fmt.Errorf("%s at %s would refer to the renamed %s", newName, relativePath(name, row, col), obj.Name())
+	}
+	return nil
+}
+
+// implementsConflict checks that renaming the method keeps the types known
+// to the package implementing the interfaces known to it, the named types
+// declared or used in the package.
+func implementsConflict(p *goPackage, method types.Object) error {
+	f, ok := method.(*types.Func)
+	if !ok || f.Type().(*types.Signature).Recv() == nil {
+		return nil
+	}
+	recv := f.Type().(*types.Signature).Recv().Type()
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+	}
+	named, ok := recv.(*types.Named)
+	if !ok {
+		return nil
+	}
+	// the receiver type in this package
+	decl := p.fset.Position(named.Obj().Pos())
+	var recvName *types.TypeName
+	var known []*types.TypeName
+	seen := make(map[*types.TypeName]bool)
+	for _, uses := range []map[*ast.Ident]types.Object{p.info.Defs, p.info.Uses} {
+		for _, obj := range uses {
+			tn, ok := obj.(*types.TypeName)
+			if !ok || seen[tn] || tn.IsAlias() {
+				continue
+			}
+			seen[tn] = true
+			if declaredAt(p, tn, decl) {
+				recvName = tn
+				continue
+			}
+			// generic types are not instantiated to be checked
+			if n, ok := tn.Type().(*types.Named); ok && n.TypeParams().Len() == 0 {
+				known = append(known, tn)
+			}
+		}
+	}
+	if recvName == nil {
+		return nil
+	}
+	t := recvName.Type()
+	qualifier := types.RelativeTo(p.pkg)
+	if iface, ok := t.Underlying().(*types.Interface); ok {
+		// the method of an interface is needed by the types implementing it
+		for _, tn := range known {
+			if !types.IsInterface(tn.Type()) && implements(tn.Type(), iface) {
+				return fmt.Errorf("renaming %s would stop %s from implementing %s",
+					f.Name(), types.TypeString(tn.Type(), qualifier), types.TypeString(t, qualifier))
+			}
+		}
+		return nil
+	}
+	for _, tn := range known {
+		iface, ok := tn.Type().Underlying().(*types.Interface)
+		if !ok {
+			continue
+		}
+		if m, _, _ := types.LookupFieldOrMethod(iface, false, recvName.Pkg(), f.Name()); m == nil {
+			continue
+		}
+		if implements(t, iface) {
+			return fmt.Errorf("renaming %s would stop %s from implementing %s",
+				f.Name(), types.TypeString(t, qualifier), types.TypeString(tn.Type(), qualifier))
+		}
+	}
+	return nil
+}
+
+// implements reports whether the type or its pointer implements the interface
+func implements(t types.Type, iface *types.Interface) bool {
+	return types.Implements(t, iface) || types.Implements(types.NewPointer(t), iface)
+}
+
+// shadowConflict checks that the new name at the site of obj would not refer
+// to another object declared in a scope inside the scope of obj.
+func shadowConflict(p *goPackage, id *ast.Ident, obj types.Object, newName string) error {
+	if obj.Parent() == nil {
+		// selected by a value, not in a lexical scope
+		return nil
+	}
+	scope := p.pkg.Scope().Innermost(id.Pos())
+	if scope == nil {
+		return nil
+	}
+	_, found := scope.LookupParent(newName, id.Pos())
+	if found == nil || found.Parent() == nil || !within(found.Parent(), obj.Parent()) {
+		return nil
+	}
+	return declConflict(p, found)
+}
+
+// within reports whether the scope is outer or the same
+func within(scope, outer *types.Scope) bool {
+	for s := scope; s != nil; s = s.Parent() {
+		if s == outer {
+			return true
+		}
+	}
+	return false
+}
+
+func declConflict(p *goPackage, found types.Object) error {
+	if !found.Pos().IsValid() {
+		return fmt.Errorf("%s conflicts with the predeclared %s", found.Name(), found.Name())
+	}
+	name, row, col := p.position(found.Pos())
+	return fmt.Errorf("%s conflicts with the declaration at %s", found.Name(), relativePath(name, row, col))
+}
+
+// structOf returns the named type of the struct having the field, or nil
+func structOf(p *goPackage, field types.Object) types.Type {
+	for _, obj := range p.info.Defs {
+		t, ok := obj.(*types.TypeName)
+		if !ok {
+			continue
+		}
+		s, ok := t.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < s.NumFields(); i++ {
+			if s.Field(i) == field {
+				return t.Type()
+			}
+		}
+	}
+	return nil
+}
+
+// relativePath formats the position as "file:line:column", the file is relative
+// to the working directory if it is inside.
+func relativePath(filename string, row, col int) string {
+	return fmt.Sprintf("%s:%d:%d", relativeName(filename), row+1, col+1)
+}
+
+// files returns the files to change
+func (r *renaming) files() []string {
+	var files []string
+	for _, site := range r.sites {
+		if len(files) == 0 || files[len(files)-1] != site.filename {
+			files = append(files, site.filename)
+		}
+	}
+	return files
+}
+
+// preview returns the changed lines, the source of files is read by src
+func (r *renaming) preview(src func(filename string) []byte) []reference {
+	var lines []reference
+	for _, file := range r.files() {
+		content := src(file)
+		for _, row := range r.rows(file) {
+			line := []rune(rawLine(content, row))
+			line = r.replace(line, r.cols(file, row))
+			lines = append(lines, reference{
+				location: location{file, pos{row, 0}},
+				text:     strings.TrimSpace(string(line)),
+			})
+		}
+	}
+	return lines
+}
+
+// rows returns the changed rows of the file, in ascending order
+func (r *renaming) rows(filename string) []int {
+	var rows []int
+	for _, site := range r.sites {
+		if site.filename == filename && (len(rows) == 0 || rows[len(rows)-1] != site.cursor.row) {
+			rows = append(rows, site.cursor.row)
+		}
+	}
+	return rows
+}
+
+// cols returns the columns of the sites in the row of the file, in descending order
+func (r *renaming) cols(filename string, row int) []int {
+	var cols []int
+	for _, site := range r.sites {
+		if site.filename == filename && site.cursor.row == row {
+			cols = append(cols, site.cursor.col)
+		}
+	}
+	slices.Reverse(cols)
+	return cols
+}
+
+// replace renames the sites at the columns of the line, in descending order
+func (r *renaming) replace(line []rune, cols []int) []rune {
+	n := len([]rune(r.old))
+	for _, col := range cols {
+		if col+n > len(line) {
+			continue
+		}
+		line = slices.Replace(line, col, col+n, []rune(r.new)...)
+	}
+	return line
+}
+
+// apply renames the sites in the open buffers as undoable changes,
+// and in the files on disk that are not open.
+func (r *renaming) apply(buffers []*Editor) error {
+	if readOnly {
+		return errReadOnly
+	}
+	for _, file := range r.files() {
+		if e := findBuffer(buffers, file); e != nil {
+			if v, ok := r.versions[file]; ok && v != e.version {
+				return fmt.Errorf("%s has changed, rename again", filepath.Base(file))
+			}
+		}
+	}
+	// the files on disk are all checked before any of them is changed
+	type change struct {
+		filename string
+		data     []byte
+		mode     fs.FileMode
+	}
+	var changes []change
+	for _, file := range r.files() {
+		if findBuffer(buffers, file) != nil {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		data, err := r.renameInFile(file)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change{file, data, info.Mode()})
+	}
+	for _, c := range changes {
+		if err := writeFileAtomic(c.filename, c.data, c.mode); err != nil {
+			return err
+		}
+	}
+	for _, file := range r.files() {
+		if e := findBuffer(buffers, file); e != nil {
+			r.applyBuffer(e, file)
+		}
+	}
+	// the files on disk have changed
+	checker.reset()
+	return nil
+}
+
+// applyBuffer renames the sites in the buffer in one change, keeping the cursor
+// at the same place of the text.
+func (r *renaming) applyBuffer(e *Editor, filename string) {
+	n := len([]rune(r.old))
+	var actions []Action
+	cursor := e.cursor
+	for _, row := range r.rows(filename) {
+		for _, col := range r.cols(filename, row) {
+			if row >= len(e.buf) || col+n > len(e.buf[row]) {
+				continue
+			}
+			actions = append(actions,
+				Delete(e, pos{row, col}, pos{row, col + n}),
+				Insert(e, pos{row, col}, r.new),
+			)
+			if row == e.cursor.row && col+n <= e.cursor.col {
+				cursor.col += len([]rune(r.new)) - n
+			}
+		}
+	}
+	if cursor != e.cursor {
+		actions = append(actions, Move(e, cursor))
+	}
+	e.do(actions...)
+}
+
+// renameInFile returns the content of the file on disk with the sites renamed,
+// it fails if a site no longer holds the old name.
+func (r *renaming) renameInFile(filename string) ([]byte, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(b), "\n")
+	n := len([]rune(r.old))
+	for _, row := range r.rows(filename) {
+		if row >= len(lines) {
+			return nil, fmt.Errorf("%s has changed, rename again", filepath.Base(filename))
+		}
+		line := []rune(lines[row])
+		cols := r.cols(filename, row)
+		for _, col := range cols {
+			if col+n > len(line) || string(line[col:col+n]) != r.old {
+				return nil, fmt.Errorf("%s has changed, rename again", filepath.Base(filename))
+			}
+		}
+		lines[row] = string(r.replace(line, cols))
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// findBuffer returns the buffer of the file, or nil if it is not open
+func findBuffer(buffers []*Editor, filename string) *Editor {
+	for _, e := range buffers {
+		if e.filename != "" && sameFile(e.filename, filename) {
+			return e
+		}
+	}
+	return nil
+}
+
+// renameBar prompts for the new name of the identifier under the cursor
+type renameBar struct {
+	BaseView
+	old  string
+	name []rune
+}
+
+func (b *renameBar) Draw(screen tcell.Screen) {
+	style := theme.prompt
+	prompt := []rune(fmt.Sprintf(" rename %s to: ", b.old))
+	text := append(prompt, b.name...)
+	drawPopupRow(screen, b.x, b.y, b.width, text, style)
+	b.cursorX, b.cursorY = b.x+min(len(text), b.width-1), b.y
+	if b.Focused() {
+		screen.ShowCursor(b.cursorX, b.cursorY)
+	}
+}
+
+func (b *renameBar) FixedSize() bool { return true }
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRename(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/a.go": `package a
+
+import "fmt"
+
+type T struct{ Name, Other string }
+
+func New() T {
+	name := "x"
+	fmt.Println(name)
+	return T{Name: name}
+}
+
+func helper() {}
+`,
+		"b/b.go": `package b
+
+import "example.com/m/a"
+
+func f() string {
+	t := a.New()
+	return t.Name
+}
+`,
+	})
+	defer checker.reset()
+	a := filepath.Join(dir, "a", "a.go")
+	b := filepath.Join(dir, "b", "b.go")
+
+	conflicts := []struct {
+		name     string
+		row, col int
+		newName  string
+		want     string
+	}{
+		{name: "invalid", row: 6, col: 5, newName: "func", want: "not a valid identifier"},
+		{name: "collision", row: 6, col: 5, newName: "helper", want: "conflicts with the declaration at a/a.go:13:6"},
+		{name: "field", row: 4, col: 15, newName: "Other", want: "conflicts with the declaration at a/a.go:5:22"},
+		{name: "unexported", row: 6, col: 5, newName: "create", want: "is used in package b"},
+		{name: "shadowed import", row: 7, col: 1, newName: "fmt", want: "fmt at a/a.go:9:2 would refer to the renamed name"},
+		{name: "outside", row: 8, col: 6, newName: "Print", want: "declared outside the module"},
+	}
+	for _, tt := range conflicts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := rename(a, nil, tt.row, tt.col, tt.newName)
+			if err == nil || !strings.Contains(filepath.ToSlash(err.Error()), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// a is open and b is on disk
+	src, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestEditor(a, strings.Split(string(src), "\n")...)
+	e.status = new(bindStr)
+	e.cursor = pos{9, 16}
+	r, err := rename(a, map[string][]byte{a: src}, 4, 15, "Title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(r.sites); got != 3 {
+		t.Errorf("%d sites, want 3", got)
+	}
+	preview := r.preview(func(name string) []byte {
+		b, _ := os.ReadFile(name)
+		return b
+	})
+	if len(preview) != 3 || preview[1].text != "return T{Title: name}" || preview[2].text != "return t.Title" {
+		t.Errorf("preview = %v", preview)
+	}
+
+	// nothing is changed if a file on disk has changed since
+	before, err := os.ReadFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, append([]byte("// moved\n"), before...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.apply([]*Editor{e}); err == nil || !strings.Contains(err.Error(), "has changed") {
+		t.Errorf("apply after b has changed: %v", err)
+	}
+	if got := string(e.buf[4]); got != "type T struct{ Name, Other string }" {
+		t.Errorf("the buffer is changed to %q", got)
+	}
+	if err := os.WriteFile(b, before, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.apply([]*Editor{e}); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(e.buf[9]); got != "\treturn T{Title: name}" {
+		t.Errorf("buffer line = %q", got)
+	}
+	if e.cursor != (pos{9, 17}) {
+		t.Errorf("cursor = %v, want {9 17}", e.cursor)
+	}
+	got, err := os.ReadFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "return t.Title\n") {
+		t.Errorf("file on disk:\n%s", got)
+	}
+
+	// a single undo reverts the buffer
+	e.undo()
+	if got := string(e.buf[4]); got != "type T struct{ Name, Other string }" {
+		t.Errorf("after undo: %q", got)
+	}
+}
+
+func TestRenameEmbeddedAndInterfaces(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/a.go": `package a
+
+type Base struct{ ID int }
+
+func (b Base) Key() string { return "" }
+
+// Keyer is implemented by Base
+type Keyer interface{ Key() string }
+
+type Plain struct{}
+
+func (Plain) Value() int { return 0 }
+`,
+		"b/b.go": `package b
+
+import (
+	"fmt"
+
+	"example.com/m/a"
+)
+
+type T struct {
+	a.Base
+}
+
+func f(t T) string {
+	fmt.Println(t.Base.ID)
+	return t.Base.Key()
+}
+
+type named struct{ n int }
+
+func (x named) String() string { return "" }
+
+var _ fmt.Stringer = named{}
+`,
+	})
+	defer checker.reset()
+	a := filepath.Join(dir, "a", "a.go")
+	b := filepath.Join(dir, "b", "b.go")
+
+	conflicts := []struct {
+		name     string
+		file     string
+		row, col int
+		newName  string
+		want     string
+	}{
+		{name: "method", file: a, row: 4, col: 14, newName: "Name", want: "renaming Key would stop Base from implementing Keyer"},
+		{name: "interface method", file: a, row: 7, col: 22, newName: "Name", want: "renaming Key would stop Base from implementing Keyer"},
+		{name: "method of another package", file: b, row: 19, col: 15, newName: "Name", want: "renaming String would stop named from implementing fmt.Stringer"},
+		{name: "unexported embedded", file: a, row: 2, col: 5, newName: "base", want: "is used in package b"},
+	}
+	for _, tt := range conflicts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := rename(tt.file, nil, tt.row, tt.col, tt.newName)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := rename(a, nil, 11, 13, "Number"); err != nil {
+		t.Errorf("renaming a method of no interface: %v", err)
+	}
+
+	// a is open with a line inserted above the type, and not saved
+	src, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := map[string][]byte{a: []byte(strings.Replace(string(src), "\n\n", "\n\n// moved\n", 1))}
+	want := []reference{
+		{location: location{a, pos{3, 5}}},
+		{location: location{a, pos{5, 8}}},
+		{location: location{b, pos{9, 3}}},
+		{location: location{b, pos{13, 15}}},
+		{location: location{b, pos{14, 10}}},
+	}
+	// the type, or the field embedding it
+	for _, at := range []location{{a, pos{3, 5}}, {b, pos{13, 15}}} {
+		r, err := rename(at.filename, overlay, at.cursor.row, at.cursor.col, "Root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r.sites, want) {
+			t.Errorf("renaming at %v: sites = %v, want %v", at, r.sites, want)
+		}
+	}
+}
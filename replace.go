@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// replaceEdit replaces a hit of the project search with the text
+type replaceEdit struct {
+	hit  findMatch
+	line string // the line of the hit when searched
+	text string
+}
+
+// edits returns the replacements of the included hits in the file, in order
+func (p *searchPanel) edits(f *searchFile) []replaceEdit {
+	var edits []replaceEdit
+	for _, l := range f.lines {
+		for _, h := range l.hits {
+			if f.excluded[h] {
+				continue
+			}
+			m := f.hits[h]
+			edits = append(edits, replaceEdit{m, l.text, expandMatch(p.re, p.opts, l.text, m, string(p.replace))})
+		}
+	}
+	return edits
+}
+
+// exclude toggles the selected hit, or all the hits of its file if file is true
+func (p *searchPanel) exclude(file bool) {
+	if p.index >= len(p.hits) {
+		return
+	}
+	ref := p.hits[p.index]
+	f := p.files[ref.file]
+	if f.excluded == nil {
+		f.excluded = make(map[int]bool)
+	}
+	if !file {
+		if f.excluded[ref.hit] {
+			delete(f.excluded, ref.hit)
+		} else {
+			f.excluded[ref.hit] = true
+		}
+		return
+	}
+	if f.included() == 0 {
+		clear(f.excluded)
+		return
+	}
+	for h := range f.hits {
+		f.excluded[h] = true
+	}
+}
+
+// replaceAll replaces the included hits in the open buffers as undoable changes,
+// one for each buffer, and in the other files on disk atomically.
+// It returns the numbers of changed files and hits.
+func (p *searchPanel) replaceAll(buffers []*Editor) (files, hits int, err error) {
+	if p.running {
+		return 0, 0, errors.New("the search is not finished")
+	}
+	if readOnly {
+		return 0, 0, errReadOnly
+	}
+	for _, f := range p.files {
+		if e := findBuffer(buffers, f.filename); e != nil {
+			if v, ok := p.versions[f.filename]; !ok || v != e.version {
+				return 0, 0, fmt.Errorf("%s has changed, search again", filepath.Base(f.filename))
+			}
+		}
+	}
+	var errs []error
+	for _, f := range p.files {
+		edits := p.edits(f)
+		if len(edits) == 0 {
+			continue
+		}
+		if e := findBuffer(buffers, f.filename); e != nil {
+			replaceInBuffer(e, edits)
+		} else if err := replaceInFile(f.filename, edits); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		files++
+		hits += len(edits)
+	}
+	// the files on disk may have changed
+	checker.reset()
+	return files, hits, errors.Join(errs...)
+}
+
+// replaceInBuffer applies the edits to the buffer in one change,
+// keeping the cursor at the same place of the text.
+func replaceInBuffer(e *Editor, edits []replaceEdit) {
+	var actions []Action
+	cursor := e.cursor
+	// from the bottom, so that the hits above are not moved
+	for i := len(edits) - 1; i >= 0; i-- {
+		m := edits[i].hit
+		actions = append(actions, e.replaceMatch(m, edits[i].text)...)
+		cursor = shiftAfter(cursor, m, textEnd(pos{m.row, m.col}, edits[i].text))
+	}
+	e.do(append(actions, Move(e, cursor))...)
+}
+
+// replaceInFile applies the edits to the file on disk, it fails if the lines
+// have changed since the search.
+func replaceInFile(filename string, edits []replaceEdit) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(b), "\n")
+	for _, edit := range edits {
+		if edit.hit.row >= len(lines) || strings.TrimSuffix(lines[edit.hit.row], "\r") != edit.line {
+			return fmt.Errorf("%s has changed since the search", filepath.Base(filename))
+		}
+	}
+	// from the end, so that the hits before are not moved
+	for i := len(edits) - 1; i >= 0; i-- {
+		m := edits[i].hit
+		line, cr := strings.CutSuffix(lines[m.row], "\r")
+		lines[m.row] = string(slices.Replace([]rune(line), m.col, m.col+m.len, []rune(edits[i].text)...))
+		if cr {
+			lines[m.row] += "\r"
+		}
+	}
+	return writeFileAtomic(filename, []byte(strings.Join(lines, "\n")), info.Mode())
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory,
+// then renames it to the file, so a failure does not leave a partial file.
+func writeFileAtomic(filename string, data []byte, mode fs.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), mode.Perm()); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
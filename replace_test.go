@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceInFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, map[string]string{
+		"a.txt": "x := fooBar(1)\r\nfoo(2) + foo(3)\n",
+		"b.txt": "foo(4)\n",
+		"c.txt": "foo(5)\n",
+	})
+	open := newTestEditor(filepath.Join(dir, "b.txt"), "foo(4)", "")
+	open.status = new(bindStr)
+	open.cursor = pos{0, 6}
+
+	p := newSearchPanel()
+	p.opts = findOptions{regex: true, matchCase: true}
+	p.re, _ = p.opts.compile(`foo(\w*)\((\d)\)`)
+	p.replace = []rune("bar${1}(${2}0)")
+	contents, versions := bufferContents([]*Editor{open})
+	if err := searchProject(context.Background(), ".", p.re, p.opts, contents, p.add); err != nil {
+		t.Fatal(err)
+	}
+	p.versions = versions
+	if len(p.hits) != 5 {
+		t.Fatalf("%d hits, want 5", len(p.hits))
+	}
+	// exclude foo(3) and the file c.txt
+	p.index = 2
+	p.exclude(false)
+	p.index = 4
+	p.exclude(true)
+
+	files, hits, err := p.replaceAll([]*Editor{open})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 2 || hits != 3 {
+		t.Errorf("replaced %d hits in %d files, want 3 in 2", hits, files)
+	}
+	for name, want := range map[string]string{
+		"a.txt": "x := barBar(10)\r\nbar(20) + foo(3)\n",
+		"b.txt": "foo(4)\n", // open in the buffer
+		"c.txt": "foo(5)\n",
+	} {
+		b, _ := os.ReadFile(name)
+		if string(b) != want {
+			t.Errorf("%s: %q, want %q", name, b, want)
+		}
+	}
+	if got := string(open.bytes()); got != "bar(40)\n" {
+		t.Errorf("buffer: %q", got)
+	}
+	// the cursor stays at the end of the line
+	if open.cursor != (pos{0, 7}) {
+		t.Errorf("cursor %v, want {0 7}", open.cursor)
+	}
+	open.undo()
+	if got := string(open.bytes()); got != "foo(4)\n" {
+		t.Errorf("undo: %q", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("%d files in the directory, want no temporary files", len(entries))
+	}
+
+	// the file changed since the search
+	if err := os.WriteFile("c.txt", []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p.exclude(true)
+	if _, _, err := p.replaceAll(nil); err == nil {
+		t.Error("want the error of a changed file")
+	}
+}
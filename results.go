@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// resultsPanel lists locations below the editors, such as references.
+// It is hidden when its height is 0.
+type resultsPanel struct {
+	BaseView
+	title string
+	items []reference
+	index int // the selected item
+	top   int // the first visible item
+	// open is called to open the selected item
+	open func(location)
+	// apply is called to confirm the items if it is not nil, such as a rename preview
+	apply func()
+}
+
+// the height of the results panel, including the title
+const resultsHeight = 10
+
+func newResultsPanel() *resultsPanel {
+	p := new(resultsPanel)
+	p.fixedSize = true
+	return p
+}
+
+// show lists the items under the title
+func (p *resultsPanel) show(title string, items []reference) {
+	p.title = title
+	p.items = items
+	p.index = 0
+	p.top = 0
+	p.apply = nil
+	p.height = resultsHeight
+}
+
+// hide collapses the panel
+func (p *resultsPanel) hide() {
+	p.height = 0
+}
+
+func (p *resultsPanel) Visible() bool { return p.height > 0 }
+
+func (p *resultsPanel) Draw(screen tcell.Screen) {
+	if p.height == 0 {
+		return
+	}
+	title := []rune(" " + p.title)
+	drawPopupRow(screen, p.x, p.y, p.width, title, theme.bar)
+	keymap := []rune("<enter> open, <esc> close ")
+	if p.apply != nil {
+		keymap = []rune("<enter> apply, <esc> cancel ")
+	}
+	if len(title)+len(keymap) < p.width {
+		for i, c := range keymap {
+			screen.SetContent(p.x+p.width-len(keymap)+i, p.y, c, nil, theme.bar.Foreground(theme.barHint))
+		}
+	}
+
+	style := tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorReset)
+	for i := 0; i < p.rows(); i++ {
+		j := p.top + i
+		var text []rune
+		if j < len(p.items) {
+			text = []rune(" " + p.items[j].String())
+		}
+		s := style
+		if j == p.index && j < len(p.items) {
+			s = style.Background(theme.selection)
+		}
+		drawPopupRow(screen, p.x, p.y+1+i, p.width, text, s)
+	}
+	p.cursorX, p.cursorY = p.x, p.y+1+p.index-p.top
+	if p.Focused() {
+		screen.ShowCursor(p.cursorX, p.cursorY)
+	}
+}
+
+// the number of visible items
+func (p *resultsPanel) rows() int { return max(0, p.height-1) }
+
+// String formats the reference as "file:line: text", or the text if it has no file
+func (r reference) String() string {
+	if r.filename == "" {
+		return r.text
+	}
+	return fmt.Sprintf("%s:%d: %s", relativeName(r.filename), r.cursor.row+1, r.text)
+}
+
+// relativeName returns the file name relative to the working directory if it is inside
+func relativeName(filename string) string {
+	if wd, err := filepath.Abs("."); err == nil {
+		if rel, err := filepath.Rel(wd, filename); err == nil && filepath.IsLocal(rel) {
+			return rel
+		}
+	}
+	return filename
+}
+
+// move selects the item n after the current one, n may be negative
+func (p *resultsPanel) move(n int) {
+	if len(p.items) == 0 {
+		return
+	}
+	p.index = max(0, min(p.index+n, len(p.items)-1))
+	if p.index < p.top {
+		p.top = p.index
+	} else if p.index >= p.top+p.rows() {
+		p.top = p.index - p.rows() + 1
+	}
+}
+
+// openSelected opens the selected item
+func (p *resultsPanel) openSelected() {
+	if p.index < len(p.items) && p.items[p.index].filename != "" && p.open != nil {
+		p.open(p.items[p.index].location)
+	}
+}
+
+func (p *resultsPanel) Click(x, y int) {
+	i := p.top + y - p.y - 1
+	if y == p.y || i >= len(p.items) {
+		return
+	}
+	p.index = i
+	p.openSelected()
+}
+
+func (p *resultsPanel) ScrollUp(delta int) bool {
+	if p.top == 0 {
+		return false
+	}
+	p.top = max(0, p.top-delta)
+	return true
+}
+
+func (p *resultsPanel) ScrollDown(delta int) bool {
+	last := max(0, len(p.items)-p.rows())
+	if p.top >= last {
+		return false
+	}
+	p.top = min(last, p.top+delta)
+	return true
+}
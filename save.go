@@ -11,7 +11,7 @@ type saveBar struct {
 }
 
 func (s *saveBar) Draw(screen tcell.Screen) {
-	style := tcell.StyleDefault.Background(tcell.ColorLightYellow).Foreground(tcell.ColorBlack)
+	style := theme.prompt
 	for y := s.y; y < s.y+s.height; y++ {
 		for x := s.x; x < s.x+s.width; x++ {
 			screen.SetContent(x, y, ' ', nil, style)
@@ -28,7 +28,7 @@ func (s *saveBar) Draw(screen tcell.Screen) {
 	if len(s.name) == 0 {
 		placeholder := "file name"
 		for i, c := range placeholder {
-			screen.SetContent(s.cursorX+i, s.cursorY, c, nil, style.Foreground(tcell.ColorGray))
+			screen.SetContent(s.cursorX+i, s.cursorY, c, nil, style.Foreground(theme.barHint))
 		}
 	} else {
 		for _, c := range s.name {
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	// the lines shown before and after a hit of the project search
+	searchContext = 1
+	// the larger files are skipped by the project search
+	maxSearchFileSize = 8 << 20
+	// the project search stops after so many hits
+	maxSearchHits = 10000
+)
+
+// searchLine is a line shown in the results of the project search,
+// a line of hits or the context around them.
+type searchLine struct {
+	row  int
+	text string
+	hits []int // the indexes of the hits in the line
+}
+
+// searchFile is the hits of the project search in a file
+type searchFile struct {
+	filename string
+	hits     []findMatch
+	lines    []searchLine // in order
+	excluded map[int]bool // the hits not to replace
+}
+
+// included returns the number of hits to replace
+func (f *searchFile) included() int {
+	return len(f.hits) - len(f.excluded)
+}
+
+// searchSource returns the hits of the pattern in the source of the file, or nil
+func searchSource(re *regexp.Regexp, opts findOptions, filename string, src []byte) *searchFile {
+	lines := strings.Split(string(src), "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		// the final newline
+		lines = lines[:len(lines)-1]
+	}
+	f := &searchFile{filename: filename}
+	var rows []int // the rows of hits
+	for row, line := range lines {
+		hits := matchLine(re, opts, row, strings.TrimSuffix(line, "\r"))
+		if len(hits) > 0 {
+			f.hits = append(f.hits, hits...)
+			rows = append(rows, row)
+		}
+	}
+	if len(f.hits) == 0 {
+		return nil
+	}
+
+	// the lines of hits with the context, each line once
+	next := 0 // the first row not added
+	h := 0
+	for _, row := range rows {
+		for r := max(next, row-searchContext); r <= min(row+searchContext, len(lines)-1); r++ {
+			l := searchLine{row: r, text: strings.TrimSuffix(lines[r], "\r")}
+			for h < len(f.hits) && f.hits[h].row == r {
+				l.hits = append(l.hits, h)
+				h++
+			}
+			f.lines = append(f.lines, l)
+			next = r + 1
+		}
+	}
+	return f
+}
+
+// isBinary reports whether the data looks binary, by a NUL byte in the beginning as git does
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// searchProject searches the files under root with overlay in place of the
+// files on disk, and calls found for each file with hits in the order of walking.
+// It skips the binary and large files, and stops when ctx is done.
+func searchProject(ctx context.Context, root string, re *regexp.Regexp, opts findOptions, overlay map[string][]byte, found func(*searchFile)) error {
+	return walkProject(ctx, root, func(path string) error {
+		filename, err := filepath.Abs(path)
+		if err != nil {
+			return nil
+		}
+		src, ok := overlay[filename]
+		if !ok {
+			if info, err := os.Stat(path); err != nil || info.Size() > maxSearchFileSize {
+				return nil
+			}
+			if src, err = os.ReadFile(path); err != nil || isBinary(src) {
+				return nil
+			}
+		}
+		if f := searchSource(re, opts, filename, src); f != nil {
+			found(f)
+		}
+		return nil
+	})
+}
+
+// bufferContents returns the content and version of the named buffers by absolute file name
+func bufferContents(buffers []*Editor) (contents map[string][]byte, versions map[string]int) {
+	contents = make(map[string][]byte)
+	versions = make(map[string]int)
+	for _, e := range buffers {
+		if e.filename == "" {
+			continue
+		}
+		if filename, err := filepath.Abs(e.filename); err == nil {
+			contents[filename] = e.bytes()
+			versions[filename] = e.version
+		}
+	}
+	return contents, versions
+}
+
+// searchRow is a row of the results, a line of the file, or the file name
+// if line is headerRow, or a gap between the lines if line is gapRow
+type searchRow struct {
+	file, line int
+}
+
+const (
+	headerRow = -1
+	gapRow    = -2
+)
+
+// hitRef locates a hit in the results
+type hitRef struct {
+	file, hit int
+	row       int // the row of the results showing the hit
+}
+
+// searchPanel searches the files of the project, and lists the hits grouped
+// by file below the editors. It is hidden when its height is 0.
+type searchPanel struct {
+	BaseView
+	query []rune
+	opts  findOptions
+	err   error // the invalid pattern
+	re    *regexp.Regexp
+
+	replace     []rune
+	showReplace bool // the replace field is shown under the query, with the preview of replacements
+	replacing   bool // the replace field is focused
+
+	files   []*searchFile
+	rows    []searchRow
+	hits    []hitRef
+	index   int  // the selected hit
+	top     int  // the first visible row
+	running bool // the search is not finished
+	limited bool // the search stopped at maxSearchHits
+
+	gen      int // the generation of the search, the results of the previous ones are dropped
+	cancel   context.CancelFunc
+	versions map[string]int // the versions of the buffers searched
+	// open is called to open the selected hit
+	open func(filename string, hit findMatch)
+}
+
+// the height of the search panel, including the query
+const searchHeight = 15
+
+func newSearchPanel() *searchPanel {
+	p := new(searchPanel)
+	p.fixedSize = true
+	p.opts.matchCase = true
+	return p
+}
+
+func (p *searchPanel) Visible() bool { return p.height > 0 }
+
+// show expands the panel
+func (p *searchPanel) show() {
+	p.height = searchHeight
+}
+
+// hide stops the search and collapses the panel
+func (p *searchPanel) hide() {
+	p.stop()
+	p.height = 0
+}
+
+// stop cancels the running search
+func (p *searchPanel) stop() {
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+	p.running = false
+}
+
+// clear drops the results
+func (p *searchPanel) clear() {
+	p.files, p.rows, p.hits = nil, nil, nil
+	p.index, p.top = 0, 0
+	p.limited = false
+}
+
+// search starts searching the query in the background, the results are
+// posted to the screen as they are found. The previous search is cancelled.
+func (p *searchPanel) search(screen tcell.Screen, overlay map[string][]byte, versions map[string]int) {
+	p.stop()
+	p.clear()
+	p.gen++
+	p.err = nil
+	if len(p.query) == 0 {
+		return
+	}
+	re, err := p.opts.compile(string(p.query))
+	if err != nil {
+		p.err = err
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.running = true
+	p.re = re
+	p.versions = versions
+	gen, opts := p.gen, p.opts
+	go func() {
+		// post the files in batches, not to redraw for every file
+		var batch []*searchFile
+		last := time.Now()
+		hits := 0
+		flush := func(done bool, err error) {
+			files := batch
+			batch = nil
+			last = time.Now()
+			post(screen, func() {
+				if gen != p.gen {
+					return
+				}
+				for _, f := range files {
+					p.add(f)
+				}
+				if done {
+					p.running = false
+					p.limited = hits >= maxSearchHits
+				}
+				if err != nil {
+					message.Set("search: " + err.Error())
+				}
+			})
+		}
+		err := searchProject(ctx, ".", re, opts, overlay, func(f *searchFile) {
+			batch = append(batch, f)
+			hits += len(f.hits)
+			if hits >= maxSearchHits {
+				cancel()
+			}
+			if time.Since(last) > 50*time.Millisecond {
+				flush(false, nil)
+			}
+		})
+		if ctx.Err() != nil {
+			err = nil
+		}
+		flush(true, err)
+	}()
+}
+
+// add appends the hits of the file to the results
+func (p *searchPanel) add(f *searchFile) {
+	fi := len(p.files)
+	p.files = append(p.files, f)
+	p.rows = append(p.rows, searchRow{fi, headerRow})
+	for li, l := range f.lines {
+		if li > 0 && l.row > f.lines[li-1].row+1 {
+			p.rows = append(p.rows, searchRow{fi, gapRow})
+		}
+		p.rows = append(p.rows, searchRow{fi, li})
+		for _, h := range l.hits {
+			p.hits = append(p.hits, hitRef{fi, h, len(p.rows) - 1})
+		}
+	}
+}
+
+// status returns the summary of the results
+func (p *searchPanel) status() string {
+	if p.err != nil {
+		return p.err.Error()
+	}
+	if len(p.query) == 0 {
+		return ""
+	}
+	s := fmt.Sprintf("%d results in %d files", len(p.hits), len(p.files))
+	if p.running {
+		s = "searching... " + s
+	} else if p.limited {
+		s += " (limited)"
+	}
+	return s
+}
+
+func (p *searchPanel) Draw(screen tcell.Screen) {
+	if p.height == 0 {
+		return
+	}
+	input := []rune(" search: " + string(p.query))
+	inputStyle := theme.bar
+	if p.err != nil {
+		inputStyle = inputStyle.Foreground(theme.diagError)
+	}
+	drawPopupRow(screen, p.x, p.y, p.width, input, inputStyle)
+	p.cursorX, p.cursorY = p.x+len(input), p.y
+	if p.showReplace {
+		replace := []rune(" replace: " + string(p.replace))
+		drawPopupRow(screen, p.x, p.y+1, p.width, replace, theme.bar)
+		keymap := []rune("<ctrl+a> replace all, <del> exclude, <ctrl+d> exclude file ")
+		if len(replace)+len(keymap) < p.width {
+			for i, c := range keymap {
+				screen.SetContent(p.x+p.width-len(keymap)+i, p.y+1, c, nil, theme.bar.Foreground(theme.barHint))
+			}
+		}
+		if p.replacing {
+			p.cursorX, p.cursorY = p.x+len(replace), p.y+1
+		}
+	}
+
+	// the status and toggles on the right
+	toggles := []struct {
+		label string
+		on    bool
+	}{
+		{".*", p.opts.regex},
+		{"Aa", p.opts.matchCase},
+		{"ab", p.opts.wholeWord},
+	}
+	right := []rune(p.status() + " ")
+	x := p.x + p.width - 1 - len(toggles)*3 - len(right)
+	if x > p.cursorX {
+		for i, c := range right {
+			screen.SetContent(x+i, p.y, c, nil, theme.bar.Foreground(theme.barHint))
+		}
+	}
+	x = p.x + p.width - 1 - len(toggles)*3
+	for _, t := range toggles {
+		s := theme.bar.Foreground(theme.barHint)
+		if t.on {
+			s = theme.bar.Background(theme.barSelected)
+		}
+		if x > p.cursorX {
+			screen.SetContent(x+1, p.y, rune(t.label[0]), nil, s)
+			screen.SetContent(x+2, p.y, rune(t.label[1]), nil, s)
+		}
+		x += 3
+	}
+
+	style := tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorReset)
+	var selected hitRef
+	if p.index < len(p.hits) {
+		selected = p.hits[p.index]
+	}
+	for i := 0; i < p.visibleRows(); i++ {
+		y := p.y + p.inputRows() + i
+		j := p.top + i
+		if j >= len(p.rows) {
+			drawPopupRow(screen, p.x, y, p.width, nil, style)
+			continue
+		}
+		r := p.rows[j]
+		f := p.files[r.file]
+		switch r.line {
+		case headerRow:
+			count := fmt.Sprint(len(f.hits))
+			if len(f.excluded) > 0 {
+				count = fmt.Sprintf("%d of %d", f.included(), len(f.hits))
+			}
+			text := []rune(fmt.Sprintf(" %s (%s)", relativeName(f.filename), count))
+			drawPopupRow(screen, p.x, y, p.width, text, style.Bold(true))
+		case gapRow:
+			drawPopupRow(screen, p.x, y, p.width, []rune("   ⋯"), style.Foreground(theme.barHint))
+		default:
+			rowStyle := style
+			current := -1 // the selected hit in the line
+			if j == selected.row && len(p.hits) > 0 {
+				rowStyle = style.Background(theme.selection)
+				current = selected.hit
+			}
+			p.drawLine(screen, y, f, f.lines[r.line], rowStyle, current)
+		}
+	}
+	if p.Focused() {
+		screen.ShowCursor(p.cursorX, p.cursorY)
+	}
+}
+
+// drawLine draws the line with the line number, the hits are highlighted
+// and the context is dimmed. In replace mode, the included hits are shown
+// struck through, followed by the replacements.
+// A tab is drawn as a space to keep the columns.
+func (p *searchPanel) drawLine(screen tcell.Screen, y int, f *searchFile, l searchLine, style tcell.Style, current int) {
+	number := []rune(fmt.Sprintf("%6d  ", l.row+1))
+	drawPopupRow(screen, p.x, y, p.width, number, style.Foreground(theme.barHint))
+	x := p.x + len(number)
+	put := func(c rune, s tcell.Style) {
+		if x < p.x+p.width {
+			if c == '\t' {
+				c = ' '
+			}
+			screen.SetContent(x, y, c, nil, s)
+			x++
+		}
+	}
+	textStyle := style
+	if len(l.hits) == 0 {
+		textStyle = style.Foreground(theme.barHint)
+	}
+	text := []rune(l.text)
+	hi := 0 // the next hit in the line
+	for col := 0; col < len(text); col++ {
+		if hi == len(l.hits) || col < f.hits[l.hits[hi]].col {
+			put(text[col], textStyle)
+			continue
+		}
+		h := l.hits[hi]
+		m := f.hits[h]
+		s := style.Background(theme.match)
+		if h == current {
+			s = style.Background(theme.matchCurrent)
+		}
+		preview := p.showReplace && !f.excluded[h]
+		if preview {
+			s = s.Foreground(theme.diffRemoved).StrikeThrough(true)
+		}
+		for _, c := range text[m.col:min(m.col+m.len, len(text))] {
+			put(c, s)
+		}
+		if preview {
+			for _, c := range expandMatch(p.re, p.opts, l.text, m, string(p.replace)) {
+				put(c, s.Foreground(theme.diffAdded).StrikeThrough(false))
+			}
+		}
+		col = m.col + m.len - 1
+		hi++
+	}
+}
+
+// the number of visible rows of results
+func (p *searchPanel) visibleRows() int { return max(0, p.height-p.inputRows()) }
+
+// inputRows returns the rows of the query and the replacement
+func (p *searchPanel) inputRows() int {
+	if p.showReplace {
+		return 2
+	}
+	return 1
+}
+
+// move selects the hit n after the current one, n may be negative
+func (p *searchPanel) move(n int) {
+	if len(p.hits) == 0 {
+		return
+	}
+	p.index = max(0, min(p.index+n, len(p.hits)-1))
+	p.scrollTo(p.hits[p.index].row)
+}
+
+// scrollTo scrolls the row into view, with the file name of the first hit
+func (p *searchPanel) scrollTo(row int) {
+	if p.index == 0 {
+		row = 0
+	}
+	if row < p.top {
+		p.top = row
+	} else if row >= p.top+p.visibleRows() {
+		p.top = row - p.visibleRows() + 1
+	}
+}
+
+// openSelected opens the selected hit
+func (p *searchPanel) openSelected() {
+	if p.index < len(p.hits) && p.open != nil {
+		h := p.hits[p.index]
+		f := p.files[h.file]
+		p.open(f.filename, f.hits[h.hit])
+	}
+}
+
+// Click opens the first hit in the clicked row
+func (p *searchPanel) Click(x, y int) {
+	row := p.top + y - p.y - p.inputRows()
+	if y < p.y+p.inputRows() || row >= len(p.rows) {
+		return
+	}
+	for i, h := range p.hits {
+		if h.row == row {
+			p.index = i
+			p.openSelected()
+			return
+		}
+	}
+}
+
+func (p *searchPanel) ScrollUp(delta int) bool {
+	if p.top == 0 {
+		return false
+	}
+	p.top = max(0, p.top-delta)
+	return true
+}
+
+func (p *searchPanel) ScrollDown(delta int) bool {
+	last := max(0, len(p.rows)-p.visibleRows())
+	if p.top >= last {
+		return false
+	}
+	p.top = min(last, p.top+delta)
+	return true
+}
+
+// openHit opens the file at the hit, with the matches of the pattern highlighted
+func (g *EditorGroup) openHit(filename string, hit findMatch, pattern string, opts findOptions) {
+	g.openAt(location{filename, pos{hit.row, hit.col}})
+	e := g.editor
+	e.find.line = hit.row
+	if err := e.Find(pattern, opts); err != nil {
+		return
+	}
+	for i, m := range e.find.match {
+		if m.row == hit.row && m.col == hit.col {
+			e.find.index = i
+			e.showMatch()
+			break
+		}
+	}
+	g.Draw(g.screen)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSearchSource(t *testing.T) {
+	re, _ := findOptions{}.compile("foo")
+	src := "a\nfoo b\nc\nd\ne\nf\nfoo foo\n"
+	f := searchSource(re, findOptions{}, "a.txt", []byte(src))
+	if want := []findMatch{{1, 0, 3}, {6, 0, 3}, {6, 4, 3}}; !reflect.DeepEqual(f.hits, want) {
+		t.Errorf("hits %v, want %v", f.hits, want)
+	}
+	var rows []int
+	for _, l := range f.lines {
+		rows = append(rows, l.row)
+	}
+	// the context lines around the hits, the final newline is not a line
+	if want := []int{0, 1, 2, 5, 6}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("lines %v, want %v", rows, want)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(f.lines[4].hits, want) {
+		t.Errorf("hits of the last line %v, want %v", f.lines[4].hits, want)
+	}
+	if searchSource(re, findOptions{}, "a.txt", []byte("bar")) != nil {
+		t.Error("want nil without hits")
+	}
+}
+
+func TestSearchProject(t *testing.T) {
+	writeModule(t, t.TempDir(), map[string]string{
+		"a.txt":       "hello",
+		"b.bin":       "hello\x00",
+		"sub/c.txt":   "say hello",
+		"ignored.txt": "hello",
+		".gitignore":  "ignored.txt\n",
+	})
+	a, _ := filepath.Abs("a.txt")
+	// the unsaved buffer
+	overlay := map[string][]byte{a: []byte("bye")}
+
+	re, _ := findOptions{}.compile("hello")
+	var got []string
+	err := searchProject(context.Background(), ".", re, findOptions{}, overlay, func(f *searchFile) {
+		got = append(got, filepath.ToSlash(relativeName(f.filename)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sub/c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"log"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+)
+
+// classes of identifiers resolved by type checking
+const (
+	tcPackage = "package"
+	tcMethod  = "method"
+	tcParam   = "param"
+	tcLocal   = "local"
+	tcField   = "field"
+	tcUnused  = "unused"
+)
+
+// semToken is an identifier classified by type checking,
+// it is drawn over the lexical token if the name is still there.
+type semToken struct {
+	tokenInfo
+	name string
+}
+
+// semanticTokens classifies the identifiers in the file by their role, keyed by row
+func semanticTokens(p *goPackage, filename string) map[int][]semToken {
+	f, ok := p.files[filename]
+	if !ok {
+		return nil
+	}
+
+	params := make(map[types.Object]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		var lists []*ast.FieldList
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			lists = []*ast.FieldList{n.Recv, n.Type.Params, n.Type.Results}
+		case *ast.FuncLit:
+			lists = []*ast.FieldList{n.Type.Params, n.Type.Results}
+		default:
+			return true
+		}
+		for _, list := range lists {
+			if list == nil {
+				continue
+			}
+			for _, field := range list.List {
+				for _, name := range field.Names {
+					if obj := p.info.Defs[name]; obj != nil {
+						params[obj] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+	used := make(map[types.Object]bool)
+	for _, obj := range p.info.Uses {
+		used[obj] = true
+	}
+
+	tokens := make(map[int][]semToken)
+	ast.Inspect(f, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj, def := p.info.Defs[id], true
+		if obj == nil {
+			obj, def = p.info.Uses[id], false
+		}
+		if obj == nil {
+			return true
+		}
+		class := identClass(obj, def && !used[obj] && id.Name != "_", params[obj])
+		if class == "" {
+			return true
+		}
+		_, row, col := p.position(id.Pos())
+		tokens[row] = append(tokens[row], semToken{
+			tokenInfo: tokenInfo{class: class, off: col, len: utf8.RuneCountInString(id.Name)},
+			name:      id.Name,
+		})
+		return true
+	})
+	return tokens
+}
+
+// identClass returns the class of an identifier denoting obj,
+// unused is true for a declaration without uses.
+func identClass(obj types.Object, unused, param bool) string {
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		return tcPackage
+	case *types.TypeName:
+		return tcType
+	case *types.Func:
+		if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() != nil {
+			return tcMethod
+		}
+		return tcFunction
+	case *types.Builtin:
+		return tcFuncBuiltin
+	case *types.Const, *types.Nil:
+		return tcConstant
+	case *types.Var:
+		if obj.IsField() {
+			return tcField
+		}
+		local := obj.Pkg() != nil && obj.Parent() != nil && obj.Parent() != obj.Pkg().Scope()
+		switch {
+		case param:
+			return tcParam
+		case local && unused:
+			return tcUnused
+		case local:
+			return tcLocal
+		}
+	}
+	return ""
+}
+
+// how long to wait after the last change before analyzing the buffer
+const analysisDelay = 300 * time.Millisecond
+
+// scheduleAnalysis type-checks the buffer in the background after a delay,
+// a following change postpones it.
+func (e *Editor) scheduleAnalysis() {
+	if e.lang == nil || e.lang.name != "go" || e.filename == "" {
+		return
+	}
+	if e.analysis != nil {
+		e.analysis.Stop()
+	}
+	e.analysis = time.AfterFunc(analysisDelay, func() {
+		post(e.screen, e.analyze)
+	})
+}
+
+// analyze takes a snapshot of the buffer in the event loop,
+// and type-checks it in another goroutine.
+func (e *Editor) analyze() {
+	version := e.version
+	filename, err := filepath.Abs(e.filename)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	src := e.bytes()
+	go func() {
+		p, err := checker.check(filename, map[string][]byte{filename: src})
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		tokens := semanticTokens(p, filename)
+		diags := diagnosticsOf(p)
+		post(e.screen, func() {
+			// outdated
+			if e.version != version {
+				return
+			}
+			e.semantic = tokens
+			e.setDiagnostics(filename, diags)
+		})
+	}()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSemanticTokens(t *testing.T) {
+	src := `package p
+
+import "strings"
+
+type T struct{ name string }
+
+const max = 3
+
+func (t *T) Upper(n int) string {
+	var unused int
+	s := strings.Repeat(t.name, n)
+	return s
+}
+`
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "p.go")
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := new(goChecker).check(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := semanticTokens(p, filename)
+
+	// row -> "name:class"
+	want := map[int][]string{
+		4:  {"T:type", "name:field", "string:type"},
+		6:  {"max:constant"},
+		8:  {"t:param", "T:type", "Upper:method", "n:param", "int:type", "string:type"},
+		9:  {"unused:unused", "int:type"},
+		10: {"s:local", "strings:package", "Repeat:func", "t:param", "name:field", "n:param"},
+		11: {"s:local"},
+	}
+	for row, w := range want {
+		var got []string
+		for _, t := range tokens[row] {
+			got = append(got, t.name+":"+t.class)
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("row %d: got %v, want %v", row, got, w)
+		}
+	}
+}
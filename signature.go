@@ -0,0 +1,296 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// signatureHelp shows the signature of the call around the cursor
+type signatureHelp struct {
+	paren  pos // the '(' of the call
+	label  string
+	params [][2]int // rune ranges of the parameters in label
+	active int      // the parameter at the cursor, -1 for none
+	// the last parameter takes the rest of arguments, such as "args ...any"
+	variadic bool
+}
+
+// the number of rows scanned upward for the call around the cursor
+const maxCallRows = 30
+
+// enclosingCall returns the '(' of the call around the cursor,
+// and the index of the argument where the cursor is.
+func (e *Editor) enclosingCall() (paren pos, arg int, ok bool) {
+	lex := e.lexer()
+	var depth int
+	for row := e.cursor.row; row >= 0 && row > e.cursor.row-maxCallRows; row-- {
+		line := e.buf[row]
+		col := len(line)
+		if row == e.cursor.row {
+			col = e.cursor.col
+		}
+		// brackets in strings and comments do not count
+		skip := make([]bool, len(line))
+		if lex != nil {
+			tokens, _ := lex.Lex(line, e.lexStates.get(e.buf, row, lex))
+			for _, t := range tokens {
+				switch t.class {
+				case tcString, tcRune, tcComment:
+					for i := t.off; i < t.off+t.len && i < len(line); i++ {
+						skip[i] = true
+					}
+				}
+			}
+		}
+		for i := col - 1; i >= 0; i-- {
+			if skip[i] {
+				continue
+			}
+			switch line[i] {
+			case ')', ']', '}':
+				depth++
+			case '(', '[', '{':
+				if depth > 0 {
+					depth--
+					continue
+				}
+				// such as composite literals and function bodies
+				if line[i] != '(' {
+					return pos{}, 0, false
+				}
+				return pos{row, i}, arg, true
+			case ',':
+				if depth == 0 {
+					arg++
+				}
+			}
+		}
+	}
+	return pos{}, 0, false
+}
+
+// loadSignature resolves the signature of the call around the cursor
+// in the background, or updates the current parameter if it is known.
+func (e *Editor) loadSignature() {
+	paren, arg, ok := e.enclosingCall()
+	if !ok || e.lang == nil || e.lang.name != "go" || e.filename == "" {
+		e.signature = nil
+		return
+	}
+	if e.signature != nil && e.signature.paren == paren {
+		e.signature.setActive(arg)
+		return
+	}
+	e.signature = nil
+
+	filename, err := filepath.Abs(e.filename)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	src := e.bytes()
+	// close the call so that it parses, such as "f(a, )"
+	closed := slices.Insert(slices.Clone(src), e.offset(e.cursor), ')')
+	go func() {
+		help, err := callSignature(filename, src, paren)
+		if err == nil && help == nil {
+			help, err = callSignature(filename, closed, paren)
+		}
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		if help == nil {
+			return
+		}
+		post(e.screen, func() {
+			p, arg, ok := e.enclosingCall()
+			if !ok || p != paren {
+				// the cursor is gone
+				return
+			}
+			help.setActive(arg)
+			e.signature = help
+		})
+	}()
+}
+
+// offset returns the byte offset of the position in the buffer
+func (e *Editor) offset(p pos) int {
+	var off int
+	for i := 0; i < p.row; i++ {
+		off += len(string(e.buf[i])) + 1
+	}
+	return off + len(string(e.buf[p.row][:p.col]))
+}
+
+// setActive highlights the parameter for the argument at index arg
+func (s *signatureHelp) setActive(arg int) {
+	switch {
+	case arg < len(s.params):
+		s.active = arg
+	case s.variadic:
+		s.active = len(s.params) - 1
+	default:
+		s.active = -1
+	}
+}
+
+// callSignature type-checks src as the content of the file, and returns
+// the signature of the call whose '(' is at paren, or nil if there is none.
+func callSignature(filename string, src []byte, paren pos) (*signatureHelp, error) {
+	p, err := checker.check(filename, map[string][]byte{filename: src})
+	if err != nil {
+		return nil, err
+	}
+	lparen := p.pos(filename, paren.row, paren.col)
+	var call *ast.CallExpr
+	ast.Inspect(p.files[filename], func(n ast.Node) bool {
+		if c, ok := n.(*ast.CallExpr); ok && c.Lparen == lparen {
+			call = c
+		}
+		return call == nil
+	})
+	if call == nil {
+		return nil, nil
+	}
+	tv, ok := p.info.Types[call.Fun]
+	if !ok || tv.IsType() {
+		// conversion
+		return nil, nil
+	}
+	sig, ok := tv.Type.(*types.Signature)
+	if !ok {
+		return nil, nil
+	}
+
+	var name string
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		name = fun.Name
+	case *ast.SelectorExpr:
+		name = fun.Sel.Name
+	default:
+		name = "func"
+	}
+	return newSignatureHelp(name, sig, types.RelativeTo(p.pkg)), nil
+}
+
+// newSignatureHelp formats the signature, such as "Printf(format string, a ...any) (int, error)"
+func newSignatureHelp(name string, sig *types.Signature, qualifier types.Qualifier) *signatureHelp {
+	help := &signatureHelp{variadic: sig.Variadic(), active: -1}
+	var b strings.Builder
+	b.WriteString(name + "(")
+	params := sig.Params()
+	for i := 0; i < params.Len(); i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		start := utf8.RuneCountInString(b.String())
+		v := params.At(i)
+		if v.Name() != "" {
+			b.WriteString(v.Name() + " ")
+		}
+		if help.variadic && i == params.Len()-1 {
+			if s, ok := v.Type().(*types.Slice); ok {
+				b.WriteString("..." + types.TypeString(s.Elem(), qualifier))
+			} else {
+				// such as append([]byte, string...)
+				b.WriteString(types.TypeString(v.Type(), qualifier) + "...")
+			}
+		} else {
+			b.WriteString(types.TypeString(v.Type(), qualifier))
+		}
+		help.params = append(help.params, [2]int{start, utf8.RuneCountInString(b.String())})
+	}
+	b.WriteString(")")
+	results := sig.Results()
+	switch {
+	case results.Len() == 1 && results.At(0).Name() == "":
+		b.WriteString(" " + types.TypeString(results.At(0).Type(), qualifier))
+	case results.Len() > 0:
+		b.WriteString(" " + types.TypeString(results, qualifier))
+	}
+	help.label = b.String()
+	return help
+}
+
+// trackSignature updates the signature help after a key,
+// it closes when the cursor leaves the call.
+func (e *Editor) trackSignature(key tcell.Key, r rune) {
+	var before signatureHelp
+	if e.signature != nil {
+		before = *e.signature
+	}
+	switch {
+	case key == tcell.KeyRune && (r == '(' || r == ','):
+		e.loadSignature()
+	case e.signature == nil:
+		return
+	case key == tcell.KeyRune && r == ')':
+		e.signature = nil
+	default:
+		paren, arg, ok := e.enclosingCall()
+		if !ok || paren != e.signature.paren {
+			e.signature = nil
+		} else {
+			e.signature.setActive(arg)
+		}
+	}
+	if e.signature == nil && before.label != "" || e.signature != nil && e.signature.active != before.active {
+		e.Draw(e.screen)
+	}
+}
+
+// showSignature draws the signature help above the cursor line,
+// or below it if there is no room or the suggestions are listed above.
+func (e *Editor) showSignature(screen tcell.Screen) {
+	s := e.signature
+	y := e.cursorY - 1
+	if e.suggest != nil {
+		if _, up := e.suggestLayout(); up {
+			y = e.cursorY + 1
+		} else if y < e.by1 {
+			// no room without overlapping the suggestions
+			return
+		}
+	}
+	if y < e.by1 {
+		y = e.cursorY + 1
+	}
+	if y > e.by2 {
+		return
+	}
+
+	text := []rune(s.label)
+	width := min(len(text)+1, e.bx2-e.bx1+1)
+	line := e.buf[s.paren.row]
+	// align the callee name with the call
+	x := e.bx1 + padCol(line, s.paren.col) - len(wordBefore(line, s.paren.col))
+	x = max(e.bx1, min(x, e.bx2-width+1))
+	drawPopupRow(screen, x, y, width, text, theme.bar)
+	if s.active >= 0 {
+		r := s.params[s.active]
+		for j := r[0]; j < r[1] && j < width; j++ {
+			screen.SetContent(x+j, y, text[j], nil, theme.bar.Background(theme.barSelected))
+		}
+	}
+}
+
+// drawPopupRow draws the text padded to width
+func drawPopupRow(screen tcell.Screen, x, y, width int, text []rune, style tcell.Style) {
+	for j := 0; j < width; j++ {
+		c := ' '
+		if j < len(text) {
+			c = text[j]
+		}
+		screen.SetContent(x+j, y, c, nil, style)
+	}
+}
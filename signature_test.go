@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnclosingCall(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		cursor  pos
+		want    pos
+		wantArg int
+		wantOK  bool
+	}{
+		{name: "first argument", lines: []string{"f(a"}, cursor: pos{0, 3}, want: pos{0, 1}, wantOK: true},
+		{name: "after commas", lines: []string{"f(a, g(b, c), "}, cursor: pos{0, 14}, want: pos{0, 1}, wantArg: 2, wantOK: true},
+		{name: "nested call", lines: []string{"f(a, g(b, "}, cursor: pos{0, 10}, want: pos{0, 6}, wantArg: 1, wantOK: true},
+		{name: "string", lines: []string{`f("(,", `}, cursor: pos{0, 8}, want: pos{0, 1}, wantArg: 1, wantOK: true},
+		{name: "multiple lines", lines: []string{"f(a,", "\tb, "}, cursor: pos{1, 4}, want: pos{0, 1}, wantArg: 2, wantOK: true},
+		{name: "composite literal", lines: []string{"f(T{a, "}, cursor: pos{0, 7}},
+		{name: "closed", lines: []string{"f(a) "}, cursor: pos{0, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Editor{lang: languageByName("go")}
+			for _, line := range tt.lines {
+				e.buf = append(e.buf, []rune(line))
+			}
+			e.cursor = tt.cursor
+			paren, arg, ok := e.enclosingCall()
+			if ok != tt.wantOK || ok && (paren != tt.want || arg != tt.wantArg) {
+				t.Errorf("enclosingCall() = %v, %d, %v, want %v, %d, %v", paren, arg, ok, tt.want, tt.wantArg, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCallSignature(t *testing.T) {
+	src := `package p
+
+import "fmt"
+
+type T struct{}
+
+func (T) Join(sep string, elems ...string) (s string, err error) { return }
+
+func f(t T) {
+	fmt.Printf("%d", 1)
+	t.Join(",", 
+}
+`
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "p.go")
+	if err := os.WriteFile(filename, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		src       string
+		paren     pos
+		arg       int
+		wantLabel string
+		wantParam string
+	}{
+		{
+			name:      "variadic function",
+			src:       src,
+			paren:     pos{9, 11},
+			arg:       3,
+			wantLabel: "Printf(format string, a ...any) (n int, err error)",
+			wantParam: "a ...any",
+		},
+		{
+			name:      "incomplete method call",
+			src:       src[:len(src)-3] + ")\n}\n",
+			paren:     pos{10, 7},
+			arg:       1,
+			wantLabel: "Join(sep string, elems ...string) (s string, err error)",
+			wantParam: "elems ...string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			help, err := callSignature(filename, []byte(tt.src), tt.paren)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if help == nil {
+				t.Fatal("no signature")
+			}
+			if help.label != tt.wantLabel {
+				t.Errorf("label = %q, want %q", help.label, tt.wantLabel)
+			}
+			help.setActive(tt.arg)
+			r := help.params[help.active]
+			if got := string([]rune(help.label)[r[0]:r[1]]); got != tt.wantParam {
+				t.Errorf("active parameter = %q, want %q", got, tt.wantParam)
+			}
+		})
+	}
+}
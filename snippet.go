@@ -0,0 +1,477 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// snippet is a template expanded in place of its prefix. The body has
+// tab stops like $1 and ${1:placeholder}, the later ones of the same
+// number mirror the first one, and $0 is the final cursor position.
+type snippet struct {
+	Prefix      string      `json:"prefix"`
+	Body        snippetBody `json:"body"`
+	Description string      `json:"description"`
+}
+
+// snippetBody is a string or lines in the config file
+type snippetBody string
+
+func (b *snippetBody) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*b = snippetBody(strings.Join(lines, "\n"))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("snippet body must be a string or an array of strings")
+	}
+	*b = snippetBody(s)
+	return nil
+}
+
+// built-in snippets keyed by language
+var builtinSnippets = map[string][]snippet{
+	"go": {
+		{Prefix: "iferr", Description: "return if error", Body: "if err != nil {\n\treturn ${1:err}\n}\n$0"},
+		{Prefix: "if", Description: "if statement", Body: "if ${1:cond} {\n\t$0\n}"},
+		{Prefix: "for", Description: "for loop", Body: "for ${1:i} := 0; $1 < ${2:n}; $1++ {\n\t$0\n}"},
+		{Prefix: "forr", Description: "for range loop", Body: "for ${1:_}, ${2:v} := range ${3:s} {\n\t$0\n}"},
+		{Prefix: "func", Description: "function", Body: "func ${1:name}($2) ${3:error} {\n\t$0\n}"},
+		{Prefix: "meth", Description: "method", Body: "func (${1:r} *${2:T}) ${3:Method}($4) {\n\t$0\n}"},
+		{Prefix: "switch", Description: "switch statement", Body: "switch ${1:x} {\ncase ${2:value}:\n\t$0\n}"},
+		{Prefix: "struct", Description: "struct type", Body: "type ${1:T} struct {\n\t$0\n}"},
+		{Prefix: "main", Description: "main function", Body: "func main() {\n\t$0\n}"},
+		{Prefix: "tt", Description: "table-driven test", Body: `func Test${1:Name}(t *testing.T) {
+	tests := []struct {
+		name string
+		${2:in}  ${3:string}
+		want ${4:string}
+	}{
+		{name: "${5:case}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			$0
+		})
+	}
+}`},
+	},
+}
+
+// snippets loaded by language, the user's ones override
+// the built-in ones with the same prefix
+var snippets = make(map[string][]snippet)
+
+// snippetsFor returns the snippets of the language, loading them on first use
+func snippetsFor(lang *language) []snippet {
+	if lang == nil {
+		return nil
+	}
+	if list, ok := snippets[lang.name]; ok {
+		return list
+	}
+	list := slices.Clone(builtinSnippets[lang.name])
+	user, err := loadSnippets(snippetFile(lang.name))
+	if err != nil {
+		log.Print(err)
+		message.Set(err.Error())
+	}
+	for _, s := range user {
+		i := slices.IndexFunc(list, func(b snippet) bool { return b.Prefix == s.Prefix })
+		if i >= 0 {
+			list[i] = s
+		} else {
+			list = append(list, s)
+		}
+	}
+	snippets[lang.name] = list
+	return list
+}
+
+// snippetFile returns the path of the user's snippets of the language,
+// such as ~/.config/jo/snippets/go.json
+func snippetFile(lang string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "jo", "snippets", lang+".json")
+}
+
+// loadSnippets reads the snippets keyed by name from the file, the format is
+// compatible with VS Code, such as {"name": {"prefix": "p", "body": ["line"]}}.
+// A missing file is not an error.
+func loadSnippets(filename string) ([]snippet, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]snippet
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	var list []snippet
+	for name, s := range m {
+		if s.Prefix == "" {
+			s.Prefix = name
+		}
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b snippet) int { return strings.Compare(a.Prefix, b.Prefix) })
+	return list, nil
+}
+
+// findSnippet returns the snippet of the language with the prefix
+func findSnippet(lang *language, prefix string) (snippet, bool) {
+	for _, s := range snippetsFor(lang) {
+		if s.Prefix == prefix {
+			return s, true
+		}
+	}
+	return snippet{}, false
+}
+
+// span is a field of the expanded snippet in a line, all in runes
+type span struct {
+	row, col, len int
+}
+
+// tabStop is where the cursor goes on Tab, the text typed in the
+// first span is mirrored to the others.
+type tabStop struct {
+	n     int
+	spans []span
+}
+
+// parseSnippet returns the text of the snippet body, with every line but
+// the first indented, and the tab stops in order, positioned relative to
+// the beginning of the text. The final stop $0 is at the end if it is absent.
+func parseSnippet(body, indent string) (string, []tabStop) {
+	// the first pass finds the placeholders, for the mirrors before them
+	p := &snippetParser{body: []rune(body), indent: []rune(indent), defaults: make(map[int]string)}
+	p.parse(false)
+	p = &snippetParser{body: []rune(body), indent: []rune(indent), defaults: p.defaults}
+	p.parse(false)
+
+	var stops []tabStop
+	for n, spans := range p.fields {
+		stops = append(stops, tabStop{n: n, spans: spans})
+	}
+	slices.SortFunc(stops, func(a, b tabStop) int {
+		// $0 is the last one
+		if a.n == 0 || b.n == 0 {
+			return b.n - a.n
+		}
+		return a.n - b.n
+	})
+	if len(stops) == 0 || stops[len(stops)-1].n != 0 {
+		stops = append(stops, tabStop{n: 0, spans: []span{{row: p.row, col: p.col}}})
+	}
+	return string(p.out), stops
+}
+
+type snippetParser struct {
+	body     []rune
+	i        int
+	indent   []rune
+	defaults map[int]string // placeholder text by number
+
+	out      []rune
+	row, col int
+	fields   map[int][]span
+}
+
+// parse emits the body until the end, or the '}' closing a placeholder if nested
+func (p *snippetParser) parse(nested bool) {
+	for p.i < len(p.body) {
+		c := p.body[p.i]
+		switch {
+		case c == '\\' && p.i+1 < len(p.body) && strings.ContainsRune(`$}\`, p.body[p.i+1]):
+			p.emit(p.body[p.i+1])
+			p.i += 2
+		case c == '}' && nested:
+			p.i++
+			return
+		case c == '$' && p.i+1 < len(p.body) && unicode.IsDigit(p.body[p.i+1]):
+			p.i++
+			p.mirror(p.number())
+		case c == '$' && p.i+2 < len(p.body) && p.body[p.i+1] == '{' && unicode.IsDigit(p.body[p.i+2]):
+			p.i += 2
+			n := p.number()
+			if p.i >= len(p.body) {
+				p.mirror(n)
+				return
+			}
+			switch p.body[p.i] {
+			case ':':
+				p.i++
+				p.placeholder(n)
+			case '|':
+				// choices, the first one is the placeholder
+				end := slices.Index(p.body[p.i:], '}')
+				if end < 0 {
+					end = len(p.body) - p.i
+				}
+				choices := strings.Trim(string(p.body[p.i:p.i+end]), "|")
+				p.i += end + 1
+				p.defaults[n] = strings.Split(choices, ",")[0]
+				p.mirror(n)
+			default:
+				p.i++ // '}'
+				p.mirror(n)
+			}
+		default:
+			p.emit(c)
+			p.i++
+		}
+	}
+}
+
+// number consumes the digits
+func (p *snippetParser) number() int {
+	start := p.i
+	for p.i < len(p.body) && unicode.IsDigit(p.body[p.i]) {
+		p.i++
+	}
+	n, _ := strconv.Atoi(string(p.body[start:p.i]))
+	return n
+}
+
+// placeholder emits the placeholder of the tab stop n, until its closing '}'
+func (p *snippetParser) placeholder(n int) {
+	i := p.addSpan(n)
+	row, col, start := p.row, p.col, len(p.out)
+	p.parse(true)
+	if p.row == row {
+		p.fields[n][i].len = p.col - col
+	}
+	if _, ok := p.defaults[n]; !ok {
+		p.defaults[n] = string(p.out[start:])
+	}
+}
+
+// mirror emits the text of the tab stop n
+func (p *snippetParser) mirror(n int) {
+	i := p.addSpan(n)
+	for _, c := range p.defaults[n] {
+		if c == '\n' {
+			// the mirror of multiple lines is not tracked
+			p.fields[n][i].len = 0
+		}
+		p.emit(c)
+	}
+	if p.fields[n][i].row == p.row {
+		p.fields[n][i].len = p.col - p.fields[n][i].col
+	}
+}
+
+// addSpan starts a span of the tab stop n at the end of output, and returns its index
+func (p *snippetParser) addSpan(n int) int {
+	if p.fields == nil {
+		p.fields = make(map[int][]span)
+	}
+	p.fields[n] = append(p.fields[n], span{row: p.row, col: p.col})
+	return len(p.fields[n]) - 1
+}
+
+func (p *snippetParser) emit(c rune) {
+	p.out = append(p.out, c)
+	if c != '\n' {
+		p.col++
+		return
+	}
+	p.out = append(p.out, p.indent...)
+	p.row++
+	p.col = len(p.indent)
+}
+
+// snippetSession tracks the tab stops of the expanded snippet being filled in
+type snippetSession struct {
+	stops []tabStop
+	i     int // the current stop
+}
+
+// expandSnippet replaces the word before cursor with the snippet as one
+// undo step, and selects the first tab stop.
+func (e *Editor) expandSnippet(s snippet) {
+	line := e.buf[e.cursor.row]
+	word := wordBefore(line, e.cursor.col)
+	start := pos{e.cursor.row, e.cursor.col - len(word)}
+	indent := string(line[:leadingTabs(line)])
+	text, stops := parseSnippet(string(s.Body), indent)
+	for i := range stops {
+		for j := range stops[i].spans {
+			sp := &stops[i].spans[j]
+			if sp.row == 0 {
+				sp.col += start.col
+			}
+			sp.row += start.row
+		}
+	}
+	first := stops[0].spans[0]
+	e.do(
+		Delete(e, start, e.cursor),
+		InsertText(e, start, text),
+		Move(e, pos{first.row, first.col + first.len}),
+	)
+	e.snippet = &snippetSession{stops: stops, i: -1}
+	e.nextStop()
+}
+
+// nextStop selects the next tab stop, the session ends at the final one
+func (e *Editor) nextStop() {
+	s := e.snippet
+	if s.i+1 < len(s.stops) {
+		s.i++
+	}
+	e.selectStop()
+}
+
+// prevStop selects the previous tab stop
+func (e *Editor) prevStop() {
+	if e.snippet.i > 0 {
+		e.snippet.i--
+	}
+	e.selectStop()
+}
+
+func (e *Editor) selectStop() {
+	stop := e.snippet.stops[e.snippet.i]
+	sp := stop.spans[0]
+	Move(e, pos{sp.row, sp.col + sp.len}).Do()
+	e.selection = nil
+	if sp.len > 0 {
+		e.selection = &struct{ start, stop pos }{
+			start: pos{sp.row, sp.col},
+			stop:  pos{sp.row, sp.col + sp.len},
+		}
+	}
+	if stop.n == 0 {
+		e.snippet = nil
+	}
+}
+
+// snippetKey handles the keys moving between tab stops,
+// it returns false if the key is not handled.
+func (e *Editor) snippetKey(ev *tcell.EventKey) bool {
+	if e.suggest != nil {
+		return false
+	}
+	switch ev.Key() {
+	case tcell.KeyTab:
+		e.nextStop()
+		return true
+	case tcell.KeyBacktab:
+		e.prevStop()
+		return true
+	case tcell.KeyESC:
+		e.snippet = nil
+	}
+	return false
+}
+
+// trackSnippet is called after a key is handled in a snippet session. The
+// arguments are the state before the key. The session follows the edit in
+// the current tab stop and updates its mirrors, or ends if the cursor leaves it.
+func (e *Editor) trackSnippet(key tcell.Key, version, rows, lineLen int) {
+	s := e.snippet
+	if s == nil {
+		return
+	}
+	field := &s.stops[s.i].spans[0]
+	inField := func() bool {
+		return e.cursor.row == field.row && field.col <= e.cursor.col && e.cursor.col <= field.col+field.len
+	}
+	if e.version == version {
+		if !inField() {
+			e.snippet = nil
+		}
+		return
+	}
+	if key == tcell.KeyCtrlZ || key == tcell.KeyCtrlR || len(e.buf) != rows || e.cursor.row != field.row {
+		e.snippet = nil
+		return
+	}
+
+	d := len(e.buf[field.row]) - lineLen
+	end := field.col + field.len
+	field.len += d
+	if field.len < 0 || !inField() {
+		e.snippet = nil
+		return
+	}
+	s.shift(field, end, d)
+
+	text := string(e.buf[field.row][field.col : field.col+field.len])
+	n := len([]rune(text))
+	var mirrors group
+	for i := range s.stops[s.i].spans[1:] {
+		m := &s.stops[s.i].spans[i+1]
+		if m.len == n && string(e.buf[m.row][m.col:m.col+m.len]) == text {
+			continue
+		}
+		cursor := e.cursor
+		if m.row == cursor.row && m.col < cursor.col {
+			cursor.col += n - m.len
+		}
+		g := group{Delete(e, pos{m.row, m.col}, pos{m.row, m.col + m.len})}
+		g.Do()
+		g = append(g, Insert(e, pos{m.row, m.col}, text), Move(e, cursor))
+		g[1:].Do()
+		mirrors = append(mirrors, g)
+
+		end, d := m.col+m.len, n-m.len
+		m.len = n
+		s.shift(m, end, d)
+	}
+	if len(mirrors) > 0 {
+		// undo the mirrors together with the edit
+		last := len(e.history) - 1
+		e.history[last] = append(group{e.history[last]}, mirrors...)
+		e.changed()
+		e.Draw(e.screen)
+	}
+}
+
+// shift moves the spans after the column of the row by d, except the given one
+func (s *snippetSession) shift(except *span, col, d int) {
+	for i := range s.stops {
+		for j := range s.stops[i].spans {
+			sp := &s.stops[i].spans[j]
+			if sp != except && sp.row == except.row && sp.col >= col {
+				sp.col += d
+			}
+		}
+	}
+}
+
+// snippetItems returns the snippets whose prefix starts with the word, for the popup
+func (e *Editor) snippetItems(word string) []completionItem {
+	var items []completionItem
+	for _, s := range snippetsFor(e.lang) {
+		if strings.HasPrefix(s.Prefix, word) {
+			text, _ := parseSnippet(string(s.Body), "")
+			items = append(items, completionItem{label: s.Prefix, kind: "snippet", detail: s.Description, doc: text})
+		}
+	}
+	return items
+}
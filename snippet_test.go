@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestParseSnippet(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		indent    string
+		wantText  string
+		wantStops []tabStop
+	}{
+		{
+			name:     "mirrors",
+			body:     "for ${1:i} := 0; $1 < ${2:n}; $1++ {\n\t$0\n}",
+			indent:   "\t",
+			wantText: "for i := 0; i < n; i++ {\n\t\t\n\t}",
+			wantStops: []tabStop{
+				{n: 1, spans: []span{{0, 4, 1}, {0, 12, 1}, {0, 19, 1}}},
+				{n: 2, spans: []span{{0, 16, 1}}},
+				{n: 0, spans: []span{{1, 2, 0}}},
+			},
+		},
+		{
+			name:     "mirror before placeholder",
+			body:     "$1 = ${1:x}",
+			wantText: "x = x",
+			wantStops: []tabStop{
+				{n: 1, spans: []span{{0, 0, 1}, {0, 4, 1}}},
+				{n: 0, spans: []span{{0, 5, 0}}},
+			},
+		},
+		{
+			name:     "nested, escaped and choices",
+			body:     `${1:a ${2:b}} \$1 ${3|x,y|}`,
+			wantText: "a b $1 x",
+			wantStops: []tabStop{
+				{n: 1, spans: []span{{0, 0, 3}}},
+				{n: 2, spans: []span{{0, 2, 1}}},
+				{n: 3, spans: []span{{0, 7, 1}}},
+				{n: 0, spans: []span{{0, 8, 0}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, stops := parseSnippet(tt.body, tt.indent)
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+			if !reflect.DeepEqual(stops, tt.wantStops) {
+				t.Errorf("stops = %v, want %v", stops, tt.wantStops)
+			}
+		})
+	}
+}
+
+func TestUserSnippets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	config := `{
+	"if": {"prefix": "if", "body": ["if ${1:ok} {", "\t$0", "}"]},
+	"Print": {"prefix": "pf", "body": "fmt.Printf(\"$1\\n\")", "description": "printf"}
+}`
+	filename := snippetFile("go")
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	delete(snippets, "go")
+	defer delete(snippets, "go")
+
+	golang := languageByName("go")
+	if s, ok := findSnippet(golang, "if"); !ok || s.Body != "if ${1:ok} {\n\t$0\n}" {
+		t.Errorf("the built-in snippet is not overridden: %q", s.Body)
+	}
+	if s, ok := findSnippet(golang, "pf"); !ok || s.Body != `fmt.Printf("$1\n")` {
+		t.Errorf("user snippet = %q, %v", s.Body, ok)
+	}
+	if _, ok := findSnippet(golang, "iferr"); !ok {
+		t.Error("the built-in snippet is missing")
+	}
+}
+
+func TestExpandSnippet(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	e := newEditor(screen, "", BindStr("", nil))
+	e.SetPos(0, 0, 80, 24)
+	e.lang = languageByName("go")
+	e.buf = [][]rune{[]rune("\tfor")}
+	e.cursor = pos{0, 4}
+	key := func(k tcell.Key, r rune) {
+		e.HandleEventKey(tcell.NewEventKey(k, r, 0), screen)
+	}
+	lines := func() []string {
+		var a []string
+		for _, line := range e.buf {
+			a = append(a, string(line))
+		}
+		return a
+	}
+
+	key(tcell.KeyTab, 0)
+	want := []string{"\tfor i := 0; i < n; i++ {", "\t\t", "\t}"}
+	if got := lines(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after expanding: %q, want %q", got, want)
+	}
+	if e.selection == nil || e.selection.start != (pos{0, 5}) || e.selection.stop != (pos{0, 6}) {
+		t.Errorf("the first placeholder is not selected: %v", e.selection)
+	}
+
+	// typing over the placeholder updates the mirrors
+	key(tcell.KeyRune, 'j')
+	key(tcell.KeyRune, 'k')
+	want = []string{"\tfor jk := 0; jk < n; jk++ {", "\t\t", "\t}"}
+	if got := lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after typing: %q, want %q", got, want)
+	}
+
+	// the next stop, then the final position
+	key(tcell.KeyTab, 0)
+	if e.selection == nil || e.selection.start != (pos{0, 19}) {
+		t.Errorf("the second placeholder is not selected: %v", e.selection)
+	}
+	key(tcell.KeyTab, 0)
+	if e.cursor != (pos{1, 2}) || e.snippet != nil {
+		t.Errorf("cursor = %v, session = %v, want the final position without session", e.cursor, e.snippet)
+	}
+
+	// one undo step for each key, and one for the expansion
+	key(tcell.KeyCtrlZ, 0)
+	key(tcell.KeyCtrlZ, 0)
+	want = []string{"\tfor i := 0; i < n; i++ {", "\t\t", "\t}"}
+	if got := lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after undoing typing: %q, want %q", got, want)
+	}
+	key(tcell.KeyCtrlZ, 0)
+	if got := lines(); !reflect.DeepEqual(got, []string{"\tfor"}) || e.cursor != (pos{0, 4}) {
+		t.Errorf("after undoing expansion: %q, cursor %v", got, e.cursor)
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// the smallest split, with the title bar and a line or a few columns
+const (
+	minSplitWidth  = 10
+	minSplitHeight = 3
+)
+
+// direction is where the split next to another one is
+type direction int
+
+const (
+	dirLeft direction = iota
+	dirRight
+	dirUp
+	dirDown
+)
+
+// splitNode is a node of the split tree, a leaf showing an editor group,
+// or the children side by side or stacked, sharing the space by weight.
+type splitNode struct {
+	group    *EditorGroup
+	split    split // how the children are laid out
+	children []*splitNode
+	parent   *splitNode
+	weight   float64 // the share in the parent
+
+	// the area laid out
+	x, y, width, height int
+}
+
+func (n *splitNode) leaves() []*splitNode {
+	if n.group != nil {
+		return []*splitNode{n}
+	}
+	var all []*splitNode
+	for _, c := range n.children {
+		all = append(all, c.leaves()...)
+	}
+	return all
+}
+
+func (n *splitNode) index() int {
+	return slices.Index(n.parent.children, n)
+}
+
+// size returns the width of the node if s is side by side, otherwise the height
+func (n *splitNode) size(s split) int {
+	if s == splitVertical {
+		return n.width
+	}
+	return n.height
+}
+
+// minSize returns the smallest size of the node along s
+func (n *splitNode) minSize(s split) int {
+	if n.group != nil {
+		if s == splitVertical {
+			return minSplitWidth
+		}
+		return minSplitHeight
+	}
+	var size int
+	for _, c := range n.children {
+		if n.split == s {
+			size += c.minSize(s)
+		} else {
+			size = max(size, c.minSize(s))
+		}
+	}
+	if n.split == s {
+		// the borders
+		size += len(n.children) - 1
+	}
+	return size
+}
+
+// place lays out the node and its children in the area,
+// with a border between the children.
+func (n *splitNode) place(x, y, width, height int) {
+	n.x, n.y, n.width, n.height = x, y, width, height
+	if n.group != nil {
+		n.group.SetPos(x, y, width, height)
+		return
+	}
+	var total float64
+	for _, c := range n.children {
+		total += c.weight
+	}
+	avail := max(0, n.size(n.split)-(len(n.children)-1))
+	var sum float64
+	start := 0
+	for i, c := range n.children {
+		sum += c.weight
+		end := int(float64(avail)*sum/total + 0.5)
+		if i == len(n.children)-1 {
+			end = avail
+		}
+		if n.split == splitVertical {
+			c.place(x+start+i, y, end-start, height)
+		} else {
+			c.place(x, y+start+i, width, end-start)
+		}
+		start = end
+	}
+}
+
+// splitTree lays out the editor groups in nested splits, side by side or
+// stacked, with the borders between them to be dragged by the mouse.
+type splitTree struct {
+	BaseView
+	root   *splitNode
+	zoomed *EditorGroup // shown alone
+
+	// the border dragged, after the child of the node
+	dragging *splitNode
+	border   int
+}
+
+// newSplitTree lays out the groups side by side, or stacked by splitHorizontal
+func newSplitTree(groups []*EditorGroup, s split) *splitTree {
+	t := &splitTree{root: &splitNode{group: groups[0], weight: 1}}
+	for i := 1; i < len(groups); i++ {
+		t.splitGroup(groups[i-1], groups[i], s)
+	}
+	t.equalize()
+	// no cursor while arranging the splits
+	t.cursorX, t.cursorY = -1, -1
+	return t
+}
+
+// groups returns the groups in order, from left to right and top to bottom
+func (t *splitTree) groups() []*EditorGroup {
+	var groups []*EditorGroup
+	for _, n := range t.root.leaves() {
+		groups = append(groups, n.group)
+	}
+	return groups
+}
+
+// visible returns the groups drawn, the zoomed one or all of them
+func (t *splitTree) visible() []*EditorGroup {
+	if t.zoomed != nil {
+		return []*EditorGroup{t.zoomed}
+	}
+	return t.groups()
+}
+
+func (t *splitTree) leaf(g *EditorGroup) *splitNode {
+	for _, n := range t.root.leaves() {
+		if n.group == g {
+			return n
+		}
+	}
+	return nil
+}
+
+// splitGroup shows the new group after g, side by side or stacked,
+// in half of the space of g.
+func (t *splitTree) splitGroup(g, newGroup *EditorGroup, s split) {
+	n := t.leaf(g)
+	if n == nil {
+		return
+	}
+	t.zoomed = nil
+	if p := n.parent; p != nil && p.split == s {
+		n.weight /= 2
+		p.children = slices.Insert(p.children, n.index()+1, &splitNode{group: newGroup, parent: p, weight: n.weight})
+	} else {
+		n.children = []*splitNode{
+			{group: g, parent: n, weight: 1},
+			{group: newGroup, parent: n, weight: 1},
+		}
+		n.group = nil
+		n.split = s
+	}
+	t.layout()
+}
+
+// remove removes the split of g, its space is shared by the others.
+// It reports false if g is the last one.
+func (t *splitTree) remove(g *EditorGroup) bool {
+	n := t.leaf(g)
+	if n == nil || n.parent == nil {
+		return false
+	}
+	if t.zoomed == g {
+		t.zoomed = nil
+	}
+	p := n.parent
+	p.children = slices.Delete(p.children, n.index(), n.index()+1)
+	if len(p.children) == 1 {
+		// the only child takes the place of the parent
+		only := p.children[0]
+		p.group, p.split, p.children = only.group, only.split, only.children
+		for _, c := range p.children {
+			c.parent = p
+		}
+		if gp := p.parent; gp != nil && p.group == nil && p.split == gp.split {
+			// merge the children into the grandparent split the same way
+			var total float64
+			for _, c := range p.children {
+				total += c.weight
+			}
+			for _, c := range p.children {
+				c.weight = p.weight * c.weight / total
+				c.parent = gp
+			}
+			i := p.index()
+			gp.children = slices.Replace(gp.children, i, i+1, p.children...)
+		}
+	}
+	t.layout()
+	return true
+}
+
+func (t *splitTree) layout() {
+	if t.zoomed != nil {
+		t.zoomed.SetPos(t.x, t.y, t.width, t.height)
+		return
+	}
+	t.root.place(t.x, t.y, t.width, t.height)
+}
+
+// toggleZoom shows g alone, or all the splits again
+func (t *splitTree) toggleZoom(g *EditorGroup) {
+	if t.zoomed == nil && t.root.group == nil {
+		t.zoomed = g
+	} else {
+		t.zoomed = nil
+	}
+	t.layout()
+}
+
+func (t *splitTree) unzoom() {
+	if t.zoomed != nil {
+		t.zoomed = nil
+		t.layout()
+	}
+}
+
+// equalize shares the space equally between the splits
+func (t *splitTree) equalize() {
+	var walk func(n *splitNode)
+	walk = func(n *splitNode) {
+		n.weight = 1
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(t.root)
+	t.layout()
+}
+
+// neighbour returns the group next to g in the direction, the nearest one
+// overlapping g, preferring the one aligned with it.
+func (t *splitTree) neighbour(g *EditorGroup, d direction) *EditorGroup {
+	from := t.leaf(g)
+	if from == nil || t.zoomed != nil {
+		return nil
+	}
+	var best *splitNode
+	var bestDist, bestOffset int
+	for _, n := range t.root.leaves() {
+		if n == from {
+			continue
+		}
+		var dist, a1, a2, b1, b2 int
+		switch d {
+		case dirLeft:
+			dist = from.x - (n.x + n.width)
+		case dirRight:
+			dist = n.x - (from.x + from.width)
+		case dirUp:
+			dist = from.y - (n.y + n.height)
+		case dirDown:
+			dist = n.y - (from.y + from.height)
+		}
+		if d == dirLeft || d == dirRight {
+			a1, a2, b1, b2 = n.y, n.y+n.height, from.y, from.y+from.height
+		} else {
+			a1, a2, b1, b2 = n.x, n.x+n.width, from.x, from.x+from.width
+		}
+		if dist < 0 || a2 <= b1 || b2 <= a1 {
+			continue
+		}
+		offset := max(a1-b1, b1-a1)
+		if best == nil || dist < bestDist || dist == bestDist && offset < bestOffset {
+			best, bestDist, bestOffset = n, dist, offset
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.group
+}
+
+// swap swaps g with the group next to it in the direction
+func (t *splitTree) swap(g *EditorGroup, d direction) bool {
+	other := t.neighbour(g, d)
+	if other == nil {
+		return false
+	}
+	a, b := t.leaf(g), t.leaf(other)
+	a.group, b.group = b.group, a.group
+	t.layout()
+	return true
+}
+
+// resize grows the split of g by delta columns if s is splitVertical,
+// otherwise by delta rows, or shrinks it by a negative delta.
+// The space is taken from the next split, or the previous one for the last.
+func (t *splitTree) resize(g *EditorGroup, s split, delta int) bool {
+	n := t.leaf(g)
+	if n == nil || t.zoomed != nil {
+		return false
+	}
+	for ; n.parent != nil; n = n.parent {
+		p := n.parent
+		if p.split != s {
+			continue
+		}
+		if i := n.index(); i < len(p.children)-1 {
+			return t.moveBorder(p, i, delta)
+		}
+		return t.moveBorder(p, n.index()-1, -delta)
+	}
+	return false
+}
+
+// moveBorder moves the border after the i-th child of n by delta cells,
+// keeping both sides of it no smaller than their minimum size.
+func (t *splitTree) moveBorder(n *splitNode, i, delta int) bool {
+	a, b := n.children[i], n.children[i+1]
+	sa, sb := a.size(n.split), b.size(n.split)
+	delta = max(delta, a.minSize(n.split)-sa)
+	delta = min(delta, sb-b.minSize(n.split))
+	if delta == 0 || sa+delta < a.minSize(n.split) {
+		return false
+	}
+	// the weights are the sizes as laid out, to move the border exactly
+	for _, c := range n.children {
+		c.weight = float64(c.size(n.split))
+	}
+	a.weight += float64(delta)
+	b.weight -= float64(delta)
+	t.layout()
+	return true
+}
+
+// borderAt returns the node and the index of the child before the border
+// at the point.
+func (t *splitTree) borderAt(x, y int) (*splitNode, int, bool) {
+	if t.zoomed != nil {
+		return nil, 0, false
+	}
+	n := t.root
+	for n.group == nil {
+		var next *splitNode
+		for i, c := range n.children {
+			if n.split == splitVertical && x == c.x+c.width && i < len(n.children)-1 {
+				return n, i, true
+			}
+			if n.split == splitHorizontal && y == c.y+c.height && i < len(n.children)-1 {
+				return n, i, true
+			}
+			if c.x <= x && x < c.x+c.width && c.y <= y && y < c.y+c.height {
+				next = c
+			}
+		}
+		if next == nil {
+			return nil, 0, false
+		}
+		n = next
+	}
+	return nil, 0, false
+}
+
+// Press starts dragging the border at the point, if any
+func (t *splitTree) Press(x, y int) bool {
+	n, i, ok := t.borderAt(x, y)
+	t.dragging, t.border = n, i
+	return ok
+}
+
+// Drag moves the border dragged to the point
+func (t *splitTree) Drag(x, y int) {
+	if t.dragging == nil {
+		return
+	}
+	c := t.dragging.children[t.border]
+	if t.dragging.split == splitVertical {
+		t.moveBorder(t.dragging, t.border, x-(c.x+c.width))
+	} else {
+		t.moveBorder(t.dragging, t.border, y-(c.y+c.height))
+	}
+}
+
+func (t *splitTree) Draw(screen tcell.Screen) {
+	t.layout()
+	if t.zoomed != nil {
+		t.zoomed.Draw(screen)
+		return
+	}
+	// the borders next to the current group are highlighted while arranging
+	var active *splitNode
+	if t.focused {
+		active = t.leaf(recentE)
+	}
+	style := tcell.StyleDefault.Background(tcell.ColorReset).Foreground(theme.lineNumber)
+	highlight := style.Foreground(theme.tabActive)
+	next := func(x, y int) bool {
+		if active == nil {
+			return false
+		}
+		nx, ny := x >= active.x-1 && x <= active.x+active.width, y >= active.y-1 && y <= active.y+active.height
+		return nx && ny
+	}
+	var draw func(n *splitNode)
+	draw = func(n *splitNode) {
+		if n.group != nil {
+			n.group.Draw(screen)
+			return
+		}
+		for i, c := range n.children {
+			draw(c)
+			if i == len(n.children)-1 {
+				continue
+			}
+			if n.split == splitVertical {
+				x := c.x + c.width
+				for y := n.y; y < n.y+n.height; y++ {
+					s := style
+					if next(x, y) {
+						s = highlight
+					}
+					screen.SetContent(x, y, '│', nil, s)
+				}
+			} else {
+				y := c.y + c.height
+				for x := n.x; x < n.x+n.width; x++ {
+					s := style
+					if next(x, y) {
+						s = highlight
+					}
+					screen.SetContent(x, y, '─', nil, s)
+				}
+			}
+		}
+	}
+	draw(t.root)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func newTestGroups(t *testing.T, n int) []*EditorGroup {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(screen.Fini)
+	groups := make([]*EditorGroup, n)
+	for i := range groups {
+		groups[i] = NewEditorGroup(screen, BindStr("", nil))
+	}
+	return groups
+}
+
+// rect returns the area of the group
+func rect(g *EditorGroup) [4]int {
+	x, y, w, h := g.Pos()
+	return [4]int{x, y, w, h}
+}
+
+func TestSplitTree(t *testing.T) {
+	groups := newTestGroups(t, 3)
+	a, b, c := groups[0], groups[1], groups[2]
+	tree := newSplitTree([]*EditorGroup{a, b}, splitVertical)
+	tree.SetPos(0, 0, 81, 24)
+	tree.splitGroup(b, c, splitHorizontal)
+
+	// a border between the splits
+	for i, want := range [][4]int{
+		{0, 0, 40, 24},
+		{41, 0, 40, 12},
+		{41, 13, 40, 11},
+	} {
+		if got := rect(groups[i]); got != want {
+			t.Errorf("group %d is laid out at %v, want %v", i, got, want)
+		}
+	}
+
+	tests := []struct {
+		from *EditorGroup
+		dir  direction
+		want *EditorGroup
+	}{
+		{a, dirRight, b}, // aligned with a
+		{c, dirLeft, a},
+		{c, dirUp, b},
+		{b, dirDown, c},
+		{a, dirLeft, nil},
+		{b, dirUp, nil},
+	}
+	for _, tt := range tests {
+		if got := tree.neighbour(tt.from, tt.dir); got != tt.want {
+			t.Errorf("neighbour of group %d in direction %d is group %d, want %d",
+				slices.Index(groups, tt.from), tt.dir, slices.Index(groups, got), slices.Index(groups, tt.want))
+		}
+	}
+
+	// dragging the borders
+	if !tree.Press(40, 5) {
+		t.Fatal("no border pressed between a and b")
+	}
+	tree.Drag(30, 5)
+	if got := rect(a); got != [4]int{0, 0, 30, 24} {
+		t.Errorf("after dragging the border, a is at %v", got)
+	}
+	if !tree.Press(50, 12) {
+		t.Fatal("no border pressed between b and c")
+	}
+	tree.Drag(50, 9)
+	if got := rect(c); got != [4]int{31, 10, 50, 14} {
+		t.Errorf("after dragging the border, c is at %v", got)
+	}
+	if tree.Press(5, 5) {
+		t.Error("pressed a border in a")
+	}
+
+	// resizing by keyboard, no smaller than the minimum
+	tree.resize(a, splitVertical, -100)
+	if _, _, w, _ := a.Pos(); w != minSplitWidth {
+		t.Errorf("the width of a is %d, want %d", w, minSplitWidth)
+	}
+	// the last one takes the space of the previous one
+	tree.resize(c, splitHorizontal, 2)
+	if _, _, _, h := c.Pos(); h != 16 {
+		t.Errorf("the height of c is %d, want 16", h)
+	}
+
+	tree.toggleZoom(c)
+	if got := rect(c); !reflect.DeepEqual(tree.visible(), []*EditorGroup{c}) || got != [4]int{0, 0, 81, 24} {
+		t.Errorf("the zoomed split is at %v, showing %d groups", got, len(tree.visible()))
+	}
+	tree.toggleZoom(c)
+	if _, _, _, h := c.Pos(); h != 16 {
+		t.Errorf("after zooming back, the height of c is %d", h)
+	}
+
+	if !tree.swap(a, dirRight) {
+		t.Fatal("a is not swapped")
+	}
+	if got, want := tree.groups(), []*EditorGroup{b, a, c}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after swapping a and b, the groups are %v", got)
+	}
+
+	if !tree.remove(a) {
+		t.Fatal("a is not removed")
+	}
+	if got := rect(c); got != [4]int{minSplitWidth + 1, 0, 81 - minSplitWidth - 1, 24} {
+		t.Errorf("after removing a, c is at %v", got)
+	}
+	tree.remove(b)
+	if tree.remove(c) {
+		t.Error("removed the last group")
+	}
+	if got := rect(c); got != [4]int{0, 0, 81, 24} {
+		t.Errorf("the last group is at %v", got)
+	}
+}
+
+func TestSplitTreeMerge(t *testing.T) {
+	groups := newTestGroups(t, 4)
+	a, b, c, d := groups[0], groups[1], groups[2], groups[3]
+	tree := newSplitTree([]*EditorGroup{a, b}, splitVertical)
+	tree.SetPos(0, 0, 80, 24)
+	tree.splitGroup(b, c, splitHorizontal)
+	tree.splitGroup(c, d, splitVertical)
+
+	// c and d side by side take the place of b and c stacked,
+	// so they are merged into the splits of a
+	tree.remove(b)
+	root := tree.root
+	if root.split != splitVertical || len(root.children) != 3 {
+		t.Fatalf("the root has %d children, split %d", len(root.children), root.split)
+	}
+	for i, g := range []*EditorGroup{a, c, d} {
+		if n := root.children[i]; n.group != g || n.parent != root {
+			t.Errorf("child %d of the root is not group %d", i, slices.Index(groups, g))
+		}
+	}
+	// c and d share the half of b and c
+	if _, _, w, _ := c.Pos(); w != 20 {
+		t.Errorf("the width of c is %d, want 20", w)
+	}
+}
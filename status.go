@@ -1,14 +1,22 @@
 package main
 
 import (
+	"time"
+
 	"github.com/gdamore/tcell/v2"
 )
 
 type statusBar struct {
 	BaseView
 	Status *bindStr
+
+	// when the message was set
+	msgTime time.Time
 }
 
+// how long a message stays in the status bar
+const messageTimeout = 5 * time.Second
+
 func newStatusBar() *statusBar {
 	b := &statusBar{}
 	b.height = 1
@@ -18,7 +26,7 @@ func newStatusBar() *statusBar {
 func (b *statusBar) FixedSize() bool { return true }
 
 func (b *statusBar) Draw(screen tcell.Screen) {
-	style := tcell.StyleDefault.Background(tcell.ColorLightGray).Foreground(tcell.ColorBlack)
+	style := theme.bar
 	for y := b.y; y <= b.y+b.height-1; y++ {
 		for x := b.x; x <= b.x+b.width-1; x++ {
 			screen.SetContent(x, y, ' ', nil, style)
@@ -29,7 +37,10 @@ func (b *statusBar) Draw(screen tcell.Screen) {
 		screen.SetContent(b.x+i, b.y, c, nil, style)
 	}
 
-	keymap := "<ctrl+s> save, <ctrl+w> close, <ctrl+q> force quit"
+	keymap := []rune("<ctrl+s> save, <ctrl+w> close, <ctrl+q> force quit")
+	if message.Get() != "" && time.Since(b.msgTime) < messageTimeout {
+		keymap = []rune(message.Get())
+	}
 	for i, c := range keymap {
 		if i > b.width-1 {
 			break
@@ -38,8 +49,12 @@ func (b *statusBar) Draw(screen tcell.Screen) {
 		x := b.x + b.width - 1 - len(keymap) + i
 		if x <= b.x+len(b.Status.Get()) {
 			// do not cover the line number
-			break
+			continue
 		}
 		screen.SetContent(x, b.y, c, nil, style)
 	}
 }
+
+// message is shown in the status bar in place of the keymap for a while,
+// set it to notify the user.
+var message = BindStr("", nil)
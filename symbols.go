@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// symbol is a declaration of a Go file, for the goto bar
+type symbol struct {
+	name string // qualified with the receiver for a method, such as "Editor.Draw"
+	kind string // func, method, type, field, const or var
+	loc  location
+}
+
+// fileSymbols parses src as the content of the file, and returns its top-level
+// declarations, the methods and the fields of the structs, in order.
+// A file with syntax errors yields the declarations parsed.
+func fileSymbols(filename string, src []byte) []symbol {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if f == nil {
+		return nil
+	}
+	var symbols []symbol
+	add := func(name, kind string, p token.Pos) {
+		if name == "_" || !p.IsValid() {
+			return
+		}
+		position := fset.Position(p)
+		col := position.Column - 1
+		if start := position.Offset - col; start >= 0 && position.Offset <= len(src) {
+			col = utf8.RuneCount(src[start:position.Offset])
+		}
+		symbols = append(symbols, symbol{name, kind, location{filename, pos{position.Line - 1, col}}})
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				add(d.Name.Name, "func", d.Name.Pos())
+				continue
+			}
+			add(receiverName(d.Recv.List[0].Type)+"."+d.Name.Name, "method", d.Name.Pos())
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name.Name, "type", s.Name.Pos())
+					if st, ok := s.Type.(*ast.StructType); ok {
+						for _, field := range st.Fields.List {
+							for _, name := range field.Names {
+								add(s.Name.Name+"."+name.Name, "field", name.Pos())
+							}
+						}
+					}
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range s.Names {
+						add(name.Name, kind, name.Pos())
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// receiverName returns the type name of the receiver, without the pointer and type parameters
+func receiverName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return "?"
+		}
+	}
+}
+
+// workspaceSymbols returns the symbols of the Go files, with overlay in place
+// of the files on disk by absolute name. It stops when ctx is done.
+func workspaceSymbols(ctx context.Context, files []string, overlay map[string][]byte) []symbol {
+	var symbols []symbol
+	for _, name := range files {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			continue
+		}
+		src, ok := overlay[abs]
+		if !ok {
+			if src, err = os.ReadFile(abs); err != nil {
+				continue
+			}
+		}
+		symbols = append(symbols, fileSymbols(abs, src)...)
+	}
+	return symbols
+}
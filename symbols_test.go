@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFileSymbols(t *testing.T) {
+	src := `package p
+
+const Max, _ = 10, 0
+
+var (
+	name = "ü"
+)
+
+type List[T any] struct {
+	items []T
+	size  int
+}
+
+func (l *List[T]) Len() int { return l.size }
+
+func /* é */ New() {}
+`
+	var got []string
+	var cursors []pos
+	for _, s := range fileSymbols("p.go", []byte(src)) {
+		got = append(got, s.kind+" "+s.name)
+		cursors = append(cursors, s.loc.cursor)
+	}
+	want := []string{"const Max", "var name", "type List", "field List.items", "field List.size", "method List.Len", "func New"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("fileSymbols = %q, want %q", got, want)
+	}
+	// the columns are counted in runes
+	if c := cursors[len(cursors)-1]; c != (pos{15, 13}) {
+		t.Errorf("the location of New is %v, want {15 13}", c)
+	}
+
+	// the declarations before a syntax error
+	if got := fileSymbols("p.go", []byte("package p\n\nfunc A() {}\n\nfunc B( {")); len(got) == 0 || got[0].name != "A" {
+		t.Errorf("fileSymbols with a syntax error = %v", got)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"golang.org/x/term"
+)
+
+// palette holds the colors of the syntax token classes and the UI.
+type palette struct {
+	name string
+
+	syntax map[string]tcell.Style
+
+	bar          tcell.Style // status bar, find bar, goto bar
+	barHint      tcell.Color // placeholder text in bars
+	barSelected  tcell.Color // selected option
+	doc          tcell.Style // documentation pane of suggestions
+	prompt       tcell.Style // save bar
+	tabActive    tcell.Color
+	selection    tcell.Color
+	match        tcell.Color
+	matchCurrent tcell.Color
+	lineNumber   tcell.Color
+	diagError    tcell.Color
+	diagWarning  tcell.Color
+	diffAdded    tcell.Color // the replacement in previews
+	diffRemoved  tcell.Color
+}
+
+var lightPalette = palette{
+	name: "light",
+	syntax: map[string]tcell.Style{
+		tcKeyword:     (tcell.Style{}).Foreground(tcell.ColorDarkRed).Italic(true),
+		tcType:        (tcell.Style{}).Foreground(tcell.ColorDarkRed),
+		tcOperator:    (tcell.Style{}).Foreground(tcell.ColorDarkRed),
+		tcInt:         (tcell.Style{}).Foreground(tcell.ColorRoyalBlue),
+		tcFloat:       (tcell.Style{}).Foreground(tcell.ColorRoyalBlue),
+		tcImag:        (tcell.Style{}).Foreground(tcell.ColorRoyalBlue),
+		tcRune:        (tcell.Style{}).Foreground(tcell.ColorRoyalBlue),
+		tcConstant:    (tcell.Style{}).Foreground(tcell.ColorRoyalBlue),
+		tcString:      (tcell.Style{}).Foreground(tcell.ColorRebeccaPurple),
+		tcFunction:    (tcell.Style{}).Foreground(tcell.ColorDarkGreen),
+		tcFuncBuiltin: (tcell.Style{}).Foreground(tcell.ColorRebeccaPurple),
+		tcComment:     (tcell.Style{}).Foreground(tcell.ColorGray),
+		tcPackage:     (tcell.Style{}).Foreground(tcell.ColorDarkCyan),
+		tcMethod:      (tcell.Style{}).Foreground(tcell.ColorSeaGreen),
+		tcParam:       (tcell.Style{}).Foreground(tcell.ColorSaddleBrown),
+		tcLocal:       (tcell.Style{}).Foreground(tcell.ColorNavy),
+		tcField:       (tcell.Style{}).Foreground(tcell.ColorDarkSlateBlue),
+		tcUnused:      (tcell.Style{}).Foreground(tcell.ColorGray).Underline(true),
+	},
+	bar:          tcell.StyleDefault.Background(tcell.ColorLightGray).Foreground(tcell.ColorBlack),
+	barHint:      tcell.ColorGray,
+	barSelected:  tcell.ColorLightBlue,
+	doc:          tcell.StyleDefault.Background(tcell.NewHexColor(0xeeeeee)).Foreground(tcell.ColorBlack),
+	prompt:       tcell.StyleDefault.Background(tcell.ColorLightYellow).Foreground(tcell.ColorBlack),
+	tabActive:    tcell.ColorLightGray,
+	selection:    tcell.ColorLightGray,
+	match:        tcell.ColorLightGray,
+	matchCurrent: tcell.ColorYellow,
+	lineNumber:   tcell.ColorGray,
+	diagError:    tcell.ColorRed,
+	diagWarning:  tcell.ColorDarkOrange,
+	diffAdded:    tcell.ColorGreen,
+	diffRemoved:  tcell.ColorRed,
+}
+
+var darkPalette = palette{
+	name: "dark",
+	syntax: map[string]tcell.Style{
+		tcKeyword:     (tcell.Style{}).Foreground(tcell.NewHexColor(0xff7b72)).Italic(true),
+		tcType:        (tcell.Style{}).Foreground(tcell.NewHexColor(0xffa657)),
+		tcOperator:    (tcell.Style{}).Foreground(tcell.NewHexColor(0xff7b72)),
+		tcInt:         (tcell.Style{}).Foreground(tcell.NewHexColor(0x79c0ff)),
+		tcFloat:       (tcell.Style{}).Foreground(tcell.NewHexColor(0x79c0ff)),
+		tcImag:        (tcell.Style{}).Foreground(tcell.NewHexColor(0x79c0ff)),
+		tcRune:        (tcell.Style{}).Foreground(tcell.NewHexColor(0x79c0ff)),
+		tcConstant:    (tcell.Style{}).Foreground(tcell.NewHexColor(0x79c0ff)),
+		tcString:      (tcell.Style{}).Foreground(tcell.NewHexColor(0xa5d6ff)),
+		tcFunction:    (tcell.Style{}).Foreground(tcell.NewHexColor(0xd2a8ff)),
+		tcFuncBuiltin: (tcell.Style{}).Foreground(tcell.NewHexColor(0x7ee787)),
+		tcComment:     (tcell.Style{}).Foreground(tcell.NewHexColor(0x8b949e)),
+		tcPackage:     (tcell.Style{}).Foreground(tcell.NewHexColor(0x56d4dd)),
+		tcMethod:      (tcell.Style{}).Foreground(tcell.NewHexColor(0xbc8cff)),
+		tcParam:       (tcell.Style{}).Foreground(tcell.NewHexColor(0xffc680)),
+		tcLocal:       (tcell.Style{}).Foreground(tcell.NewHexColor(0xc9d1d9)),
+		tcField:       (tcell.Style{}).Foreground(tcell.NewHexColor(0x9ecbff)),
+		tcUnused:      (tcell.Style{}).Foreground(tcell.NewHexColor(0x6e7681)).Underline(true),
+	},
+	bar:          tcell.StyleDefault.Background(tcell.NewHexColor(0x3a3a3a)).Foreground(tcell.NewHexColor(0xd0d0d0)),
+	barHint:      tcell.NewHexColor(0x8a8a8a),
+	barSelected:  tcell.NewHexColor(0x005f87),
+	doc:          tcell.StyleDefault.Background(tcell.NewHexColor(0x262626)).Foreground(tcell.NewHexColor(0xd0d0d0)),
+	prompt:       tcell.StyleDefault.Background(tcell.NewHexColor(0x5f5f00)).Foreground(tcell.NewHexColor(0xeeeeee)),
+	tabActive:    tcell.NewHexColor(0x444444),
+	selection:    tcell.NewHexColor(0x444444),
+	match:        tcell.NewHexColor(0x444444),
+	matchCurrent: tcell.NewHexColor(0x806000),
+	lineNumber:   tcell.NewHexColor(0x6e7681),
+	diagError:    tcell.NewHexColor(0xf85149),
+	diagWarning:  tcell.NewHexColor(0xd29922),
+	diffAdded:    tcell.NewHexColor(0x3fb950),
+	diffRemoved:  tcell.NewHexColor(0xf85149),
+}
+
+// the palette in use
+var theme = lightPalette
+
+// background describes how the terminal background was detected
+type background struct {
+	dark   bool
+	source string // "OSC 11", "COLORFGBG" or "default"
+	value  string // raw value reported by the source
+}
+
+func (b background) String() string {
+	if b.source == "default" {
+		return "no terminal background detected"
+	}
+	shade := "light"
+	if b.dark {
+		shade = "dark"
+	}
+	return fmt.Sprintf("%s background from %s (%s)", shade, b.source, b.value)
+}
+
+var detected = background{source: "default"}
+
+// detectBackground asks the terminal for its background color,
+// falling back to the COLORFGBG environment variable.
+// It must be called before the screen is initialized,
+// otherwise the terminal reply is consumed by tcell.
+func detectBackground() background {
+	if reply, err := queryOSC11(100 * time.Millisecond); err == nil {
+		if dark, ok := parseOSC11(reply); ok {
+			return background{dark: dark, source: "OSC 11", value: strings.Trim(reply, "\x1b\\\a")}
+		}
+	}
+	if v := os.Getenv("COLORFGBG"); v != "" {
+		if dark, ok := parseColorFGBG(v); ok {
+			return background{dark: dark, source: "COLORFGBG", value: v}
+		}
+	}
+	return background{source: "default"}
+}
+
+// setTheme picks the built-in palette matching the background
+func setTheme(b background) {
+	detected = b
+	if b.dark {
+		theme = darkPalette
+	} else {
+		theme = lightPalette
+	}
+}
+
+// queryOSC11 writes the OSC 11 query followed by a primary device attributes
+// request, which every terminal answers, so that we stop reading early
+// when the terminal ignores OSC 11.
+func queryOSC11(timeout time.Duration) (string, error) {
+	fd, err := syscall.Open("/dev/tty", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return "", err
+	}
+	// non-blocking descriptor makes read deadline work
+	tty := os.NewFile(uintptr(fd), "/dev/tty")
+	defer tty.Close()
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+
+	if _, err = tty.WriteString("\x1b]11;?\x1b\\\x1b[c"); err != nil {
+		return "", err
+	}
+	if err = tty.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+
+	var reply []byte
+	buf := make([]byte, 64)
+	for {
+		n, err := tty.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if err != nil {
+			return "", err
+		}
+		// the device attributes reply looks like "ESC [ ? ... c"
+		if i := strings.Index(string(reply), "\x1b[?"); i >= 0 && strings.HasSuffix(string(reply), "c") {
+			return string(reply[:i]), nil
+		}
+	}
+}
+
+// parseOSC11 reports whether the color in the OSC 11 reply is dark,
+// the reply looks like "ESC ] 11 ; rgb:RRRR/GGGG/BBBB ST".
+func parseOSC11(reply string) (dark, ok bool) {
+	i := strings.Index(reply, "rgb:")
+	if i < 0 {
+		return false, false
+	}
+	s := strings.TrimRight(reply[i+len("rgb:"):], "\x1b\\\a")
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return false, false
+	}
+	var rgb [3]float64
+	for j, p := range parts {
+		if len(p) == 0 || len(p) > 4 {
+			return false, false
+		}
+		v, err := strconv.ParseUint(p, 16, 16)
+		if err != nil {
+			return false, false
+		}
+		// each component has 1 to 4 hex digits
+		rgb[j] = float64(v) / float64(uint64(1)<<(4*len(p))-1)
+	}
+	luminance := 0.2126*rgb[0] + 0.7152*rgb[1] + 0.0722*rgb[2]
+	return luminance < 0.5, true
+}
+
+// parseColorFGBG reports whether the background in COLORFGBG is dark,
+// the value looks like "15;0" or "15;default;0", the last field is the background.
+func parseColorFGBG(v string) (dark, ok bool) {
+	fields := strings.Split(v, ";")
+	bg, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || bg < 0 || bg > 15 {
+		return false, false
+	}
+	// 7 is light gray and 9-15 are the bright colors
+	return bg <= 6 || bg == 8, true
+}
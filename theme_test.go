@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestParseOSC11(t *testing.T) {
+	tests := []struct {
+		reply    string
+		wantDark bool
+		wantOK   bool
+	}{
+		{reply: "\x1b]11;rgb:0000/0000/0000\x1b\\", wantDark: true, wantOK: true},
+		{reply: "\x1b]11;rgb:ffff/ffff/ffff\a", wantDark: false, wantOK: true},
+		{reply: "\x1b]11;rgb:1e/1e/1e\a", wantDark: true, wantOK: true},
+		{reply: "\x1b]11;rgb:fdf6/e3e3/f6f6\x1b\\", wantDark: false, wantOK: true},
+		{reply: "", wantOK: false},
+		{reply: "\x1b]11;rgb:zz/00/00\a", wantOK: false},
+	}
+	for _, tt := range tests {
+		dark, ok := parseOSC11(tt.reply)
+		if dark != tt.wantDark || ok != tt.wantOK {
+			t.Errorf("parseOSC11(%q) = %v, %v, want %v, %v", tt.reply, dark, ok, tt.wantDark, tt.wantOK)
+		}
+	}
+}
+
+func TestParseColorFGBG(t *testing.T) {
+	tests := []struct {
+		value    string
+		wantDark bool
+		wantOK   bool
+	}{
+		{value: "15;0", wantDark: true, wantOK: true},
+		{value: "0;15", wantDark: false, wantOK: true},
+		{value: "15;default;8", wantDark: true, wantOK: true},
+		{value: "0;7", wantDark: false, wantOK: true},
+		{value: "15;default", wantOK: false},
+	}
+	for _, tt := range tests {
+		dark, ok := parseColorFGBG(tt.value)
+		if dark != tt.wantDark || ok != tt.wantOK {
+			t.Errorf("parseColorFGBG(%q) = %v, %v, want %v, %v", tt.value, dark, ok, tt.wantDark, tt.wantOK)
+		}
+	}
+}
@@ -53,7 +53,7 @@ func (t *titleBar) Draw(screen tcell.Screen) {
 	for j, name := range t.names {
 		newstyle := style
 		if j == t.i {
-			newstyle = newstyle.Background(tcell.ColorLightGray).Italic(true)
+			newstyle = newstyle.Background(theme.tabActive).Italic(true)
 		}
 		for _, c := range name {
 			screen.SetContent(t.x+i, t.y, c, nil, newstyle)
@@ -1,11 +1,12 @@
 package main
 
 import (
-	"fmt"
+	"go/scanner"
 	gotoken "go/token"
 	"slices"
-	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/gdamore/tcell/v2"
 )
@@ -17,36 +18,30 @@ const (
 	tcKeyword     = "keyword"
 	tcOperator    = "operator"
 	tcInt         = "int"
+	tcFloat       = "float"
+	tcImag        = "imag"
 	tcRune        = "rune"
 	tcString      = "str"
+	tcConstant    = "constant"
 	tcFunction    = "func"
 	tcFuncBuiltin = "funcbuiltin"
 	tcComment     = "comment"
 )
 
+// predeclared identifiers, see https://go.dev/ref/spec#Predeclared_identifiers
 var (
-	delimiters = []rune{
-		' ', '\'', '[', ']', '{', '}', '"', '\t', '\n', '.', ',', '`', '(', ')',
-		'-', '+', '*', '&', '|', '=', '!', ':', '<', '>',
+	tokenTypes = []string{
+		"any", "bool", "byte", "comparable", "complex64", "complex128", "error",
+		"float32", "float64", "int", "int8", "int16", "int32", "int64", "rune",
+		"string", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
 	}
-	tokenTypes     = []string{"nil", "int", "string", "rune", "map"}
-	tokenOperators = []string{"=", "+", "-", "*", "/", ">", "<", "|", "&", "!", ":"}
+	tokenConstants = []string{"true", "false", "iota", "nil"}
 	tokenFunctions = []string{
-		"append", "cap", "clear", "close", "copy", "delete", "len", "make",
-		"max", "min", "new", "panic", "print", "println", "recover",
+		"append", "cap", "clear", "close", "complex", "copy", "delete", "imag",
+		"len", "make", "max", "min", "new", "panic", "print", "println", "real",
+		"recover",
 	}
 	defaultStyle = (tcell.Style{}).Foreground(tcell.ColorReset)
-	styles       = map[string]tcell.Style{
-		tcKeyword:     (tcell.Style{}).Foreground(tcell.ColorDarkRed).Italic(true),
-		tcType:        (tcell.Style{}).Foreground(tcell.ColorDarkRed),
-		tcOperator:    (tcell.Style{}).Foreground(tcell.ColorDarkRed),
-		tcInt:         (tcell.Style{}).Foreground(tcell.ColorRoyalBlue),
-		tcRune:        (tcell.Style{}).Foreground(tcell.ColorRoyalBlue),
-		tcString:      (tcell.Style{}).Foreground(tcell.ColorRebeccaPurple),
-		tcFunction:    (tcell.Style{}).Foreground(tcell.ColorDarkGreen),
-		tcFuncBuiltin: (tcell.Style{}).Foreground(tcell.ColorRebeccaPurple),
-		tcComment:     (tcell.Style{}).Foreground(tcell.ColorGray),
-	}
 )
 
 type tokenInfo struct {
@@ -56,168 +51,230 @@ type tokenInfo struct {
 }
 
 func (t *tokenInfo) Style() tcell.Style {
-	s, ok := styles[t.class]
+	s, ok := theme.syntax[t.class]
 	if !ok {
 		return defaultStyle
 	}
 	return s
 }
 
+// the lexer state at the end of a line
+const (
+	stateNone = iota
+	stateRawString
+	stateBlockComment
+	// the first of the states for multi-line strings with different delimiters
+	stateLongString
+)
+
+// parseToken parses a line as if it does not continue a raw string or block comment.
 func parseToken(line []rune) []tokenInfo {
+	tokens, _ := lexGo(line, stateNone)
+	return tokens
+}
+
+// lexGo parses a line of Go source starting in the given state,
+// and returns the tokens and the state at the end of line.
+// Offsets of tokens are rune indices.
+func lexGo(line []rune, state int) ([]tokenInfo, int) {
 	if len(line) == 0 {
-		return nil
+		return nil, state
 	}
 
-	s := make([]tokenInfo, 0, len(line))
-	newTokenInfo := func(token []rune, offset int, delim rune) tokenInfo {
-		tokenS := string(token)
-		var class string
-		if delim == '(' {
-			if slices.Contains(tokenFunctions, tokenS) {
-				class = tcFuncBuiltin
-			} else {
-				class = tcFunction
-			}
-		} else if gotoken.IsKeyword(tokenS) {
-			class = tcKeyword
-		} else if slices.Contains(tokenTypes, tokenS) {
-			class = tcType
-		} else if _, err := strconv.Atoi(tokenS); err == nil {
-			class = tcInt
-		} else if slices.Contains(tokenOperators, tokenS) {
-			class = tcOperator
+	src := string(line)
+	// the rune index of each byte offset
+	runeOff := make([]int, len(src)+1)
+	var n int
+	for i := 0; i < len(src); i++ {
+		runeOff[i] = n
+		if i+1 == len(src) || utf8.RuneStart(src[i+1]) {
+			n++
 		}
-		return tokenInfo{off: offset, len: len(token), class: class}
-	}
-	var token []rune
-	var off = 0
-	var lastDelim rune
-	for i := range line {
-		// string
-		if lastDelim == '"' || lastDelim == '`' || lastDelim == '\'' {
-			// find the next unescaped quote
-			if line[i] == lastDelim && line[i-1] != '\\' {
-				if lastDelim == '\'' {
-					s[len(s)-1].class = tcRune
-				} else {
-					s[len(s)-1].class = tcString
-				}
-				s[len(s)-1].len = i - s[len(s)-1].off + 1
-				lastDelim = 0
-				off = i + 1
-			}
-			continue
+	}
+	runeOff[len(src)] = n
+	newToken := func(class string, start, end int) tokenInfo {
+		return tokenInfo{class: class, off: runeOff[start], len: runeOff[end] - runeOff[start]}
+	}
+
+	var tokens []tokenInfo
+	var start int
+	switch state {
+	case stateRawString:
+		i := strings.IndexByte(src, '`')
+		if i < 0 {
+			return []tokenInfo{newToken(tcString, 0, len(src))}, stateRawString
+		}
+		tokens = append(tokens, newToken(tcString, 0, i+1))
+		start = i + 1
+	case stateBlockComment:
+		i := strings.Index(src, "*/")
+		if i < 0 {
+			return []tokenInfo{newToken(tcComment, 0, len(src))}, stateBlockComment
 		}
+		tokens = append(tokens, newToken(tcComment, 0, i+2))
+		start = i + 2
+	}
 
-		// comment
-		if line[i] == '/' && i+1 < len(line) && line[i+1] == '/' {
-			s = append(s, tokenInfo{class: tcComment, off: i, len: len(line) - i})
+	type rawToken struct {
+		tok        gotoken.Token
+		lit        string
+		start, end int
+	}
+	var raws []rawToken
+	fset := gotoken.NewFileSet()
+	file := fset.AddFile("", -1, len(src)-start)
+	var s scanner.Scanner
+	// errors such as unterminated literals are expected while typing
+	s.Init(file, []byte(src[start:]), nil, scanner.ScanComments)
+	state = stateNone
+	for {
+		p, tok, lit := s.Scan()
+		if tok == gotoken.EOF {
 			break
 		}
-
-		if !slices.Contains(delimiters, line[i]) {
-			token = append(token, line[i])
-			if i == len(line)-1 {
-				s = append(s, newTokenInfo(token, off, 0))
-			}
+		if tok == gotoken.SEMICOLON && lit == "\n" {
+			// automatically inserted
 			continue
 		}
+		off := start + file.Offset(p)
+		length := len(lit)
+		if lit == "" {
+			length = len(tok.String())
+		}
+		end := min(off+length, len(src))
+		raws = append(raws, rawToken{tok: tok, lit: lit, start: off, end: end})
 
-		delim := line[i]
-		if len(token) > 0 {
-			s = append(s, newTokenInfo(token, off, delim))
-			token = token[:0]
+		// a literal reaching the end of line may be unterminated
+		if end == len(src) {
+			switch {
+			case tok == gotoken.STRING && lit[0] == '`' && (len(lit) == 1 || lit[len(lit)-1] != '`'):
+				state = stateRawString
+			case tok == gotoken.COMMENT && lit[1] == '*' && (len(lit) < 4 || !strings.HasSuffix(lit, "*/")):
+				state = stateBlockComment
+			}
 		}
-		s = append(s, newTokenInfo(line[i:i+1], i, 0)) // delimiter
-		off = i + 1
-		lastDelim = line[i]
 	}
-	return s
-}
 
-func getToken(s []rune, i int) []rune {
-	for _, t := range parseToken(s) {
-		if t.off <= i && i < t.off+t.len {
-			token := s[t.off : t.off+t.len]
-			if gotoken.IsIdentifier(string(token)) {
-				return token
+	for i, t := range raws {
+		var class string
+		switch {
+		case t.tok == gotoken.IDENT:
+			switch {
+			case slices.Contains(tokenTypes, t.lit):
+				class = tcType
+			case slices.Contains(tokenConstants, t.lit):
+				class = tcConstant
+			case i+1 < len(raws) && raws[i+1].tok == gotoken.LPAREN:
+				if slices.Contains(tokenFunctions, t.lit) {
+					class = tcFuncBuiltin
+				} else {
+					class = tcFunction
+				}
 			}
+		case t.tok.IsKeyword():
+			class = tcKeyword
+		case t.tok == gotoken.INT:
+			class = tcInt
+		case t.tok == gotoken.FLOAT:
+			class = tcFloat
+		case t.tok == gotoken.IMAG:
+			class = tcImag
+		case t.tok == gotoken.CHAR:
+			class = tcRune
+		case t.tok == gotoken.STRING:
+			class = tcString
+		case t.tok == gotoken.COMMENT:
+			class = tcComment
+		case isOperator(t.tok):
+			class = tcOperator
 		}
+		tokens = append(tokens, newToken(class, t.start, t.end))
 	}
-	return nil
+	return tokens, state
 }
 
-// a tree intended for the token
-type node struct {
-	value    rune
-	parent   *node
-	children []*node
+// isOperator reports whether tok is an operator rather than punctuation
+func isOperator(tok gotoken.Token) bool {
+	switch tok {
+	case gotoken.LPAREN, gotoken.RPAREN, gotoken.LBRACK, gotoken.RBRACK,
+		gotoken.LBRACE, gotoken.RBRACE, gotoken.COMMA, gotoken.PERIOD,
+		gotoken.SEMICOLON, gotoken.COLON, gotoken.ELLIPSIS:
+		return false
+	}
+	return tok.IsOperator()
 }
 
-func (n *node) set(s string) {
-	nn := n
-	for s != "" {
-		c := rune(s[0])
-		var ok bool
-		for _, child := range nn.children {
-			if child.value == c {
-				nn = child
-				ok = true
-				break
-			}
-		}
-		if !ok {
-			newNode := &node{parent: nn, value: c}
-			nn.children = append(nn.children, newNode)
-			nn = newNode
-		}
-		s = s[1:]
-	}
+// lineStates caches the lexer state at the beginning of each line,
+// so that a line is highlighted without lexing the lines above it again.
+// After an edit, the states are recomputed from the edited row until
+// a state is the same as before the edit.
+type lineStates struct {
+	states []int // states[i] is the state at the beginning of line i
+	valid  int   // states[:valid] are up to date, the rest are stale
+	edited int   // the last row edited since states were up to date
 }
 
-func (n *node) get(s string) []string {
-	if s == "" {
-		return nil
-	}
-
-	var tokens []string
-	// the deepest node that matches s
-	var nodes = n.children
-	for _, c := range s {
-		debugC := fmt.Sprintf("%c", c)
-		_ = debugC
-		var match []*node
-		for _, node := range nodes {
-			if node.value == c || unicode.ToLower(node.value) == c {
-				match = append(match, node.children...)
-			}
-		}
-		if len(match) == 0 {
-			return nil
-		}
-		nodes = match
+// invalidate is called before the row is edited without adding or removing lines
+func (c *lineStates) invalidate(row int) {
+	if c.valid == len(c.states) {
+		c.edited = row
+	} else {
+		c.edited = max(c.edited, row)
 	}
+	c.valid = min(c.valid, row+1)
+}
+
+// truncate is called before the rows from the row are replaced,
+// adding or removing lines, the stale states no longer belong to the same lines.
+func (c *lineStates) truncate(row int) {
+	c.invalidate(row)
+	c.states = c.states[:c.valid]
+}
 
-	for _, node := range nodes {
-		for _, l := range node.leafs() {
-			pValues := []rune{l.value}
-			for p := l.parent; p != nil && p.value != 0; p = p.parent {
-				pValues = append([]rune{p.value}, pValues...)
+// get returns the state at the beginning of the row,
+// lexing the lines above it whose states are not up to date.
+func (c *lineStates) get(buf [][]rune, row int, lex Lexer) int {
+	if len(c.states) == 0 {
+		c.states = append(c.states, stateNone)
+		c.valid = 1
+	}
+	for c.valid <= row && c.valid <= len(buf) {
+		i := c.valid - 1
+		_, state := lex.Lex(buf[i], c.states[i])
+		if c.valid < len(c.states) {
+			if c.valid > c.edited && c.states[c.valid] == state {
+				// the lines below are not affected by the edit
+				c.valid = len(c.states)
+				break
 			}
-			tokens = append(tokens, string(pValues))
+			c.states[c.valid] = state
+		} else {
+			c.states = append(c.states, state)
 		}
+		c.valid++
 	}
-	return tokens
+	return c.states[row]
 }
 
-func (n *node) leafs() []*node {
-	if len(n.children) == 0 {
-		return []*node{n}
+// changedBelow reports whether an edit of the row changes
+// the state at the beginning of the next line.
+func (c *lineStates) changedBelow(buf [][]rune, row int, lex Lexer) bool {
+	if row+1 >= len(c.states) || row+1 >= len(buf) {
+		return false
 	}
+	old := c.states[row+1]
+	return c.get(buf, row+1, lex) != old
+}
 
-	var ls []*node
-	for _, child := range n.children {
-		ls = append(ls, child.leafs()...)
+// wordBefore returns the identifier or keyword ending at column i of the line
+func wordBefore(line []rune, i int) []rune {
+	start := i
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+	// an identifier does not start with a digit
+	for start < i && unicode.IsDigit(line[start]) {
+		start++
 	}
-	return ls
+	return line[start:i]
 }
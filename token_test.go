@@ -16,30 +16,157 @@ func TestParseSyntax(t *testing.T) {
 	}
 }
 
-func Test_node_get(t *testing.T) {
-	buf := [][]rune{
-		[]rune("fmt.Println(1024)"),
-		[]rune("println(1024)"),
-	}
-	n := new(node)
-	buildTokenTree(n, buf)
-
-	type args struct {
-		s string
+func TestLexGo(t *testing.T) {
+	type tok struct {
+		text  string
+		class string
 	}
 	tests := []struct {
-		name string
-		args args
-		want []string
+		name      string
+		line      string
+		state     int
+		want      []tok
+		wantState int
 	}{
-		{args: args{s: "fm"}, want: []string{"fmt"}},
-		{name: "insensitive case", args: args{s: "pri"}, want: []string{"Println", "println"}},
+		{
+			name: "escaped backslash before closing quote",
+			line: `s := "a\\" + x`,
+			want: []tok{{"s", ""}, {":=", tcOperator}, {`"a\\"`, tcString}, {"+", tcOperator}, {"x", ""}},
+		},
+		{
+			name: "escaped quote",
+			line: `i := "h\"i"`,
+			want: []tok{{"i", ""}, {":=", tcOperator}, {`"h\"i"`, tcString}},
+		},
+		{
+			name: "numbers",
+			line: `0x1F 1.5e3 2i 'a'`,
+			want: []tok{{"0x1F", tcInt}, {"1.5e3", tcFloat}, {"2i", tcImag}, {"'a'", tcRune}},
+		},
+		{
+			name: "division is not a comment",
+			line: `a / b // half`,
+			want: []tok{{"a", ""}, {"/", tcOperator}, {"b", ""}, {"// half", tcComment}},
+		},
+		{
+			name: "predeclared identifiers",
+			line: `var ok bool = len(s) > 0 && err != nil`,
+			want: []tok{
+				{"var", tcKeyword}, {"ok", ""}, {"bool", tcType}, {"=", tcOperator},
+				{"len", tcFuncBuiltin}, {"(", ""}, {"s", ""}, {")", ""}, {">", tcOperator},
+				{"0", tcInt}, {"&&", tcOperator}, {"err", ""}, {"!=", tcOperator}, {"nil", tcConstant},
+			},
+		},
+		{
+			name: "function call and conversion",
+			line: `f(string(b))`,
+			want: []tok{{"f", tcFunction}, {"(", ""}, {"string", tcType}, {"(", ""}, {"b", ""}, {")", ""}, {")", ""}},
+		},
+		{
+			name: "operators",
+			line: `x <<= 1; y &^= z; ch <- v; i++`,
+			want: []tok{
+				{"x", ""}, {"<<=", tcOperator}, {"1", tcInt}, {";", ""},
+				{"y", ""}, {"&^=", tcOperator}, {"z", ""}, {";", ""},
+				{"ch", ""}, {"<-", tcOperator}, {"v", ""}, {";", ""},
+				{"i", ""}, {"++", tcOperator},
+			},
+		},
+		{
+			name:      "raw string starts",
+			line:      "s := `first",
+			want:      []tok{{"s", ""}, {":=", tcOperator}, {"`first", tcString}},
+			wantState: stateRawString,
+		},
+		{
+			name:      "raw string continues",
+			line:      "middle // not a comment",
+			state:     stateRawString,
+			want:      []tok{{"middle // not a comment", tcString}},
+			wantState: stateRawString,
+		},
+		{
+			name:  "raw string ends",
+			line:  "last` + x",
+			state: stateRawString,
+			want:  []tok{{"last`", tcString}, {"+", tcOperator}, {"x", ""}},
+		},
+		{
+			name:      "block comment starts",
+			line:      "x /* begin",
+			want:      []tok{{"x", ""}, {"/* begin", tcComment}},
+			wantState: stateBlockComment,
+		},
+		{
+			name:  "block comment ends",
+			line:  `end */ "s"`,
+			state: stateBlockComment,
+			want:  []tok{{"end */", tcComment}, {`"s"`, tcString}},
+		},
+		{
+			name: "block comment in a line",
+			line: `a /* b */ c`,
+			want: []tok{{"a", ""}, {"/* b */", tcComment}, {"c", ""}},
+		},
+		{
+			name: "non-ASCII",
+			line: `s := "世界" + t`,
+			want: []tok{{"s", ""}, {":=", tcOperator}, {`"世界"`, tcString}, {"+", tcOperator}, {"t", ""}},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := n.get(tt.args.s); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("node.get(%q) = %v, want %v", tt.args.s, got, tt.want)
+			line := []rune(tt.line)
+			tokens, state := lexGo(line, tt.state)
+			var got []tok
+			for _, token := range tokens {
+				got = append(got, tok{string(line[token.off : token.off+token.len]), token.class})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lexGo(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+			if state != tt.wantState {
+				t.Errorf("lexGo(%q) state = %d, want %d", tt.line, state, tt.wantState)
 			}
 		})
 	}
 }
+
+func TestLineStates(t *testing.T) {
+	buf := [][]rune{
+		[]rune("a := 1"),
+		[]rune("b := 2"),
+		[]rune("c := 3"),
+		[]rune("d := 4"),
+	}
+	var c lineStates
+	for i := range buf {
+		if got := c.get(buf, i, lexFunc(lexGo)); got != stateNone {
+			t.Fatalf("line %d: state = %d, want %d", i, got, stateNone)
+		}
+	}
+
+	// open a block comment on the second line
+	buf[1] = []rune("b := 2 /*")
+	c.invalidate(1)
+	if !c.changedBelow(buf, 1, lexFunc(lexGo)) {
+		t.Error("changedBelow = false after opening a block comment")
+	}
+	if got := c.get(buf, 3, lexFunc(lexGo)); got != stateBlockComment {
+		t.Errorf("state = %d, want %d", got, stateBlockComment)
+	}
+
+	// an edit not affecting the state
+	buf[2] = []rune("c := 33")
+	c.invalidate(2)
+	if c.changedBelow(buf, 2, lexFunc(lexGo)) {
+		t.Error("changedBelow = true after editing inside a comment")
+	}
+
+	// close the comment in a new line
+	c.truncate(2)
+	buf = append(buf[:3], append([][]rune{[]rune("*/")}, buf[3:]...)...)
+	if got := c.get(buf, 4, lexFunc(lexGo)); got != stateNone {
+		t.Errorf("state = %d, want %d", got, stateNone)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// wordIndex collects the words of open buffers for completion.
+// Words are scoped by workspace, and dropped when their buffers close.
+type wordIndex struct {
+	buffers map[*Editor]*bufferWords
+	// accepted words, the larger the more recent
+	recent map[string]int
+	clock  int
+}
+
+// editedRows tracks the rows of a buffer edited since its words are indexed,
+// as the number of lines before them and after them to the end,
+// which stay the same when lines are added or removed between.
+type editedRows struct {
+	tracking   bool // false until indexed, such as after the text is loaded
+	head, tail int
+}
+
+// add records n rows of buf from the row as edited
+func (r *editedRows) add(buf [][]rune, row, n int) {
+	r.head = min(r.head, row)
+	r.tail = min(r.tail, max(0, len(buf)-row-n))
+}
+
+// reset starts tracking the rows edited after the words of buf are indexed
+func (r *editedRows) reset(buf [][]rune) {
+	r.tracking = true
+	r.head, r.tail = len(buf), len(buf)
+}
+
+type bufferWords struct {
+	workspace string
+	version   int            // version of the buffer indexed
+	lines     [][]string     // the words of each line, as many times as they appear
+	states    []int          // the lexer state at the beginning of each line
+	counts    map[string]int // how many times each word appears
+}
+
+var words = &wordIndex{
+	buffers: make(map[*Editor]*bufferWords),
+	recent:  make(map[string]int),
+}
+
+// index the words of the buffer, unless it has not changed since.
+// Only the rows edited since the last time are lexed again,
+// and the rows below whose lexer states are changed by the edit.
+func (w *wordIndex) index(e *Editor) {
+	b, ok := w.buffers[e]
+	if ok && b.version == e.version {
+		return
+	}
+	head, tail := e.edits.head, e.edits.tail
+	if !ok || !e.edits.tracking {
+		b = &bufferWords{
+			workspace: workspaceOf(e.filename),
+			counts:    make(map[string]int),
+		}
+		head, tail = 0, 0
+	}
+	head = min(head, len(b.lines), len(e.buf))
+	oldEnd := max(head, len(b.lines)-tail)
+	newEnd := max(head, len(e.buf)-tail)
+	lex := e.lexer()
+	state := func(row int) int {
+		if lex == nil {
+			return stateNone
+		}
+		return e.lexStates.get(e.buf, row, lex)
+	}
+	for newEnd < len(e.buf) && oldEnd < len(b.states) && state(newEnd) != b.states[oldEnd] {
+		newEnd++
+		oldEnd++
+	}
+	for _, line := range b.lines[head:oldEnd] {
+		for _, word := range line {
+			if b.counts[word]--; b.counts[word] == 0 {
+				delete(b.counts, word)
+			}
+		}
+	}
+	lines := make([][]string, newEnd-head)
+	states := make([]int, newEnd-head)
+	for i, line := range e.buf[head:newEnd] {
+		states[i] = state(head + i)
+		var tokens []tokenInfo
+		if lex != nil {
+			tokens, _ = lex.Lex(line, states[i])
+		}
+		lines[i] = lineWords(line, tokens)
+		for _, word := range lines[i] {
+			b.counts[word]++
+		}
+	}
+	b.lines = slices.Replace(b.lines, head, oldEnd, lines...)
+	b.states = slices.Replace(b.states, head, oldEnd, states...)
+	b.version = e.version
+	e.edits.reset(e.buf)
+	w.buffers[e] = b
+}
+
+// lineWords returns the words of the line outside the comments and strings
+// of its tokens, a word does not start with a digit.
+func lineWords(line []rune, tokens []tokenInfo) []string {
+	var words []string
+	skip := func(i int) bool {
+		for _, t := range tokens {
+			if t.off <= i && i < t.off+t.len {
+				return t.class == tcComment || t.class == tcString
+			}
+		}
+		return false
+	}
+	for i := 0; i < len(line); {
+		if !isWordRune(line[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && isWordRune(line[i]) {
+			i++
+		}
+		if !unicode.IsDigit(line[start]) && !skip(start) {
+			words = append(words, string(line[start:i]))
+		}
+	}
+	return words
+}
+
+// remove the words of a closed buffer
+func (w *wordIndex) remove(e *Editor) {
+	delete(w.buffers, e)
+}
+
+// accept records the word accepted from suggestion, to rank it higher later
+func (w *wordIndex) accept(word string) {
+	w.clock++
+	w.recent[word] = w.clock
+}
+
+// the number of suggestions
+const maxSuggestions = 10
+
+// the rows from the cursor where the words rank higher
+const maxDistance = 100
+
+// suggest returns the words fuzzy matching the prefix before cursor of the buffer,
+// from the buffers in the same workspace. They are ranked by the matching score,
+// the distance to the cursor, how recently they were accepted and how often
+// they appear. Ties are broken by the word, so the result is deterministic.
+func (w *wordIndex) suggest(e *Editor, prefix string) []string {
+	for b := range w.buffers {
+		w.index(b)
+	}
+	w.index(e)
+	workspace := w.buffers[e].workspace
+	type candidate struct {
+		word  string
+		score int
+	}
+	scores := make(map[string]int)
+	counts := make(map[string]int)
+	f := newFuzzyMatcher(prefix)
+	for _, b := range w.buffers {
+		if b.workspace != workspace {
+			continue
+		}
+		for word, n := range b.counts {
+			counts[word] += n
+			if _, ok := scores[word]; ok {
+				continue
+			}
+			if word == prefix {
+				continue
+			}
+			score, _, ok := f.score(word)
+			if !ok {
+				continue
+			}
+			scores[word] = score
+		}
+	}
+
+	// the distance of the words near the cursor, farther ones get no bonus
+	distances := make(map[string]int)
+	lines := w.buffers[e].lines
+	for row := max(0, e.cursor.row-maxDistance); row < min(len(lines), e.cursor.row+maxDistance); row++ {
+		for _, word := range lines[row] {
+			d := abs(row - e.cursor.row)
+			if old, ok := distances[word]; !ok || d < old {
+				distances[word] = d
+			}
+		}
+	}
+	var candidates []candidate
+	for word, score := range scores {
+		// the closer to the cursor the higher
+		if distance, ok := distances[word]; ok {
+			score += max(0, 20-distance/5)
+		}
+		if t, ok := w.recent[word]; ok {
+			// recently accepted words
+			score += max(0, 30-(w.clock-t))
+		}
+		score += min(counts[word], 10)
+		candidates = append(candidates, candidate{word, score})
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		return strings.Compare(a.word, b.word)
+	})
+
+	var result []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		result = append(result, candidates[i].word)
+	}
+	return result
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// workspaceOf returns the root directory of the project containing the file,
+// which has go.mod or .git, or the directory of the file if there is none.
+func workspaceOf(filename string) string {
+	if filename == "" {
+		filename = "untitled"
+	}
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return filepath.Dir(filename)
+	}
+	dir := filepath.Dir(path)
+	for d := dir; ; d = filepath.Dir(d) {
+		for _, marker := range []string{"go.mod", ".git"} {
+			if _, err := os.Stat(filepath.Join(d, marker)); err == nil {
+				return d
+			}
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestEditor(filename string, lines ...string) *Editor {
+	e := &Editor{filename: filename}
+	for _, line := range lines {
+		e.buf = append(e.buf, []rune(line))
+	}
+	return e
+}
+
+func TestWordIndexSuggest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := t.TempDir()
+
+	w := &wordIndex{buffers: make(map[*Editor]*bufferWords), recent: make(map[string]int)}
+	a := newTestEditor(filepath.Join(dir, "a.go"),
+		"fmt.Println(1024)",
+		"println(1024)",
+	)
+	b := newTestEditor(filepath.Join(dir, "sub", "b.go"), "printBuffer()")
+	c := newTestEditor(filepath.Join(other, "c.go"), "printOther()")
+	for _, e := range []*Editor{a, b, c} {
+		w.index(e)
+	}
+
+	if got, want := w.suggest(a, "pri"), []string{"println", "Println", "printBuffer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("suggest = %v, want %v", got, want)
+	}
+	// the same result for the same state
+	if got, want := w.suggest(a, "pri"), w.suggest(a, "pri"); !reflect.DeepEqual(got, want) {
+		t.Errorf("suggest is not deterministic: %v, %v", got, want)
+	}
+
+	// closer to the cursor ranks higher
+	a.editing(len(a.buf), 0, true)
+	a.buf = append(a.buf, make([][]rune, 200)...)
+	a.buf = append(a.buf, []rune("printRow()"))
+	a.version++
+	a.cursor.row = len(a.buf) - 1
+	if got := w.suggest(a, "pr"); len(got) == 0 || got[0] != "printRow" {
+		t.Errorf("suggest near the cursor = %v, want printRow first", got)
+	}
+
+	// recently accepted words rank higher
+	w.accept("printBuffer")
+	if got := w.suggest(a, "pr"); len(got) == 0 || got[0] != "printBuffer" {
+		t.Errorf("suggest after accept = %v, want printBuffer first", got)
+	}
+
+	// words of closed buffers are gone
+	w.remove(b)
+	for _, word := range w.suggest(a, "pr") {
+		if word == "printBuffer" {
+			t.Errorf("suggest has %q from the closed buffer", word)
+		}
+	}
+}
+
+func TestWordIndexEdits(t *testing.T) {
+	w := &wordIndex{buffers: make(map[*Editor]*bufferWords), recent: make(map[string]int)}
+	e := newTestEditor("a.go", "one two", "three", "four five", "")
+	e.lang = languageByName("go")
+	w.index(e)
+
+	// only the edited rows are indexed again, the same as indexing all of them
+	edits := []func() Action{
+		func() Action { return Insert(e, pos{1, 5}, " six") },
+		func() Action { return InsertText(e, pos{0, 3}, "\nseven\neight ") },
+		func() Action { return Delete(e, pos{3, 0}, pos{3, 5}) },
+		func() Action {
+			return replacement{e: e, start: 4, old: e.buf[4:5], new: [][]rune{[]rune("nine"), []rune("ten")}}
+		},
+		// the rows below become a comment
+		func() Action { return Insert(e, pos{1, 0}, "/*") },
+	}
+	for i, edit := range edits {
+		edit().Do()
+		e.version++
+		w.index(e)
+		full := &Editor{filename: e.filename, buf: e.buf, lang: e.lang}
+		w.index(full)
+		got, want := w.buffers[e], w.buffers[full]
+		if !reflect.DeepEqual(got.lines, want.lines) || !reflect.DeepEqual(got.counts, want.counts) {
+			t.Errorf("after edit %d: lines %q, counts %v, want %q, %v", i, got.lines, got.counts, want.lines, want.counts)
+		}
+		w.remove(full)
+	}
+}
+
+func TestLineWords(t *testing.T) {
+	tests := []struct {
+		lang  string
+		lines []string
+		want  [][]string
+	}{
+		{"go", []string{"x := `raw` + s.Name // note", "0x1F, héllo"}, [][]string{{"x", "s", "Name"}, {"héllo"}}},
+		// the rows inside a multi-line construct
+		{"python", []string{`s = """doc`, `text"""; from_x`}, [][]string{{"s"}, {"from_x"}}},
+		{"", []string{"plain-text 42nd _x"}, [][]string{{"plain", "text", "_x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			w := &wordIndex{buffers: make(map[*Editor]*bufferWords), recent: make(map[string]int)}
+			e := newTestEditor("", tt.lines...)
+			e.lang = languageByName(tt.lang)
+			w.index(e)
+			if got := w.buffers[e].lines; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("words = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceOf(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := workspaceOf(filepath.Join(root, "a", "b", "c.go")); got != root {
+		t.Errorf("workspaceOf = %q, want %q", got, root)
+	}
+	dir := t.TempDir()
+	if got := workspaceOf(filepath.Join(dir, "c.go")); got != dir {
+		t.Errorf("workspaceOf without marker = %q, want %q", got, dir)
+	}
+}